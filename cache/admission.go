@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	// MetricRejectedBySize - Number of entities not cached because they exceed Admission.MaxSize.
+	//                          └── Admission.MaxSizeを超えたためキャッシュされなかったエンティティの数。
+	MetricRejectedBySize = "rejected_by_size"
+
+	// MetricRejectedByKindSize - Number of entities not cached because they exceed Admission.MaxSizeByKind.
+	//                              └── Admission.MaxSizeByKindを超えたためキャッシュされなかったエンティティの数。
+	MetricRejectedByKindSize = "rejected_by_kind_size"
+
+	// MetricRejectedByAccessCount - Number of entities not cached because they were not looked up often enough.
+	//                                 └── 参照回数が足りないためキャッシュされなかったエンティティの数。
+	MetricRejectedByAccessCount = "rejected_by_access_count"
+
+	// defaultMaxTrackedKeys - Default of Admission.MaxTrackedKeys.
+	//                           └── Admission.MaxTrackedKeysのデフォルト値。
+	defaultMaxTrackedKeys = 100000
+)
+
+// Sizer - Optional interface of Cache that reports the size an entity takes in the cache.
+//           └── エンティティがキャッシュで占めるサイズを返す、Cacheの任意のインターフェイス。
+type Sizer interface {
+	// EncodedSize - Size in bytes of the entry written for entity, after encoding, compression and encryption.
+	//                 └── エンコード・圧縮・暗号化の後の、entityのために書き込まれるエントリのバイト数。
+	EncodedSize(projectID string, entity *datastore.EntityResult) (int, error)
+}
+
+// Admission - Decides whether entities found by Lookup are cached.
+//               └── Lookupで取得したエンティティをキャッシュするかを決める。
+// The size of an entity is the size of the entry stored in the cache if the Cache implements Sizer,
+// or the size of its Protocol Buffers encoding otherwise.
+//    └── エンティティのサイズは、CacheがSizerを実装している場合はキャッシュに保存されるエントリのサイズ、
+//    └── そうでない場合はProtocol Buffersでエンコードしたサイズ。
+type Admission struct {
+	// MaxSize - Entities larger than MaxSize bytes are not cached. Zero means unlimited.
+	//             └── MaxSizeバイトより大きいエンティティはキャッシュしない。0は無制限。
+	MaxSize int
+	// MaxSizeByKind - Limit of the size for each kind, applied in addition to MaxSize.
+	//                   └── kindごとのサイズの上限。MaxSizeに加えて適用される。
+	MaxSizeByKind map[string]int
+	// MinAccessCount - Entities are cached once they are looked up from Datastore this many times.
+	//                    └── Datastoreからこの回数参照されたエンティティをキャッシュする。
+	MinAccessCount int
+	// MaxTrackedKeys - Number of keys whose access count is kept. The counts are reset when it is exceeded.
+	//                    └── 参照回数を保持するキーの数。超えた場合は参照回数をリセットする。
+	MaxTrackedKeys int
+
+	mu           sync.Mutex
+	accessCounts map[string]int
+}
+
+// NewAdmission - Initialize Admission that caches all entities.
+//                  └── 全てのエンティティをキャッシュするAdmissionを初期化する。
+func NewAdmission() *Admission {
+	return &Admission{
+		MaxSizeByKind:  map[string]int{},
+		MaxTrackedKeys: defaultMaxTrackedKeys,
+	}
+}
+
+// admit - Report the metric explaining why entity is rejected, or "" if it is admitted.
+//           └── entityを拒否する理由のメトリクス名を返す。受け入れる場合は""を返す。
+// size is called only when a limit of the size is set.
+//    └── sizeはサイズの上限が設定されている場合のみ呼ばれる。
+func (a *Admission) admit(entity *datastore.EntityResult, size func(*datastore.EntityResult) int) string {
+	if a.MaxSize > 0 || len(a.MaxSizeByKind) > 0 {
+		size := size(entity)
+
+		if a.MaxSize > 0 && size > a.MaxSize {
+			return MetricRejectedBySize
+		}
+
+		if max, ok := a.MaxSizeByKind[KindOf(entity.GetEntity().GetKey())]; ok && size > max {
+			return MetricRejectedByKindSize
+		}
+	}
+
+	if a.MinAccessCount > 1 && a.countAccess(entity.GetEntity().GetKey()) < a.MinAccessCount {
+		return MetricRejectedByAccessCount
+	}
+
+	return ""
+}
+
+// sizeFunc - Function measuring the size of an entity in the cache for Admission.
+//              └── Admissionのためにキャッシュでのエンティティのサイズを測る関数。
+// The size of the Protocol Buffers encoding is used if the cache is not a Sizer or fails to encode the entity.
+//    └── キャッシュがSizerでない場合やエンコードに失敗した場合は、Protocol Buffersでエンコードしたサイズを使う。
+func (m *Middleware) sizeFunc(projectID string) func(*datastore.EntityResult) int {
+	sizer, ok := m.cache.(Sizer)
+
+	return func(entity *datastore.EntityResult) int {
+		if ok {
+			if size, err := sizer.EncodedSize(projectID, entity); err == nil {
+				return size
+			}
+		}
+
+		return protoSize(entity)
+	}
+}
+
+// protoSize - Size of the Protocol Buffers encoding of entity.
+//               └── entityをProtocol Buffersでエンコードしたサイズ。
+func protoSize(entity *datastore.EntityResult) int {
+	return proto.Size(entity)
+}
+
+// countAccess - Increment the access count of key and return it.
+//                 └── keyの参照回数を加算して返す。
+func (a *Admission) countAccess(key *datastore.Key) int {
+	b, err := proto.Marshal(key)
+	if err != nil {
+		return 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	maxTrackedKeys := a.MaxTrackedKeys
+	if maxTrackedKeys <= 0 {
+		maxTrackedKeys = defaultMaxTrackedKeys
+	}
+
+	if a.accessCounts == nil || len(a.accessCounts) >= maxTrackedKeys {
+		a.accessCounts = map[string]int{}
+	}
+
+	a.accessCounts[string(b)]++
+
+	return a.accessCounts[string(b)]
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/mock"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func newEntityResult(key *datastore.Key, size int) *datastore.EntityResult {
+	return &datastore.EntityResult{
+		Entity: &datastore.Entity{
+			Key: key,
+			Properties: map[string]*datastore.Value{
+				"text": {
+					ValueType: &datastore.Value_StringValue{StringValue: strings.Repeat("x", size)},
+				},
+			},
+		},
+		Version: 1,
+	}
+}
+
+func TestAdmission_admit(t *testing.T) {
+	a := NewAdmission()
+	a.MaxSize = 1000
+	a.MaxSizeByKind["b"] = 100
+
+	if reason := a.admit(newEntityResult(testKeys2[0], 10), protoSize); reason != "" {
+		t.Errorf("small entity was rejected: %s", reason)
+	}
+
+	if reason := a.admit(newEntityResult(testKeys2[0], 2000), protoSize); reason != MetricRejectedBySize {
+		t.Errorf("reason differed: %s (expected: %s)", reason, MetricRejectedBySize)
+	}
+
+	if reason := a.admit(newEntityResult(testKeys2[1], 500), protoSize); reason != MetricRejectedByKindSize {
+		t.Errorf("reason differed: %s (expected: %s)", reason, MetricRejectedByKindSize)
+	}
+
+	if reason := a.admit(newEntityResult(testKeys2[2], 500), protoSize); reason != "" {
+		t.Errorf("entity of other kind was rejected: %s", reason)
+	}
+}
+
+func TestAdmission_minAccessCount(t *testing.T) {
+	a := NewAdmission()
+	a.MinAccessCount = 2
+	a.MaxTrackedKeys = 2
+
+	if reason := a.admit(newEntityResult(testKeys2[0], 10), protoSize); reason != MetricRejectedByAccessCount {
+		t.Errorf("reason differed: %s (expected: %s)", reason, MetricRejectedByAccessCount)
+	}
+
+	if reason := a.admit(newEntityResult(testKeys2[0], 10), protoSize); reason != "" {
+		t.Errorf("entity looked up twice was rejected: %s", reason)
+	}
+
+	// tracking more keys than MaxTrackedKeys resets the counts
+	a.admit(newEntityResult(testKeys2[1], 10), protoSize)
+	a.admit(newEntityResult(testKeys2[2], 10), protoSize)
+
+	if reason := a.admit(newEntityResult(testKeys2[1], 10), protoSize); reason != MetricRejectedByAccessCount {
+		t.Errorf("reason differed: %s (expected: %s)", reason, MetricRejectedByAccessCount)
+	}
+}
+
+func TestCacheMiddleware_afterLookupWithAdmission(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	small := newEntityResult(testKeys2[0], 10)
+	large := newEntityResult(testKeys2[1], 2000)
+
+	m.EXPECT().
+		SetMulti(ctx, projectID, []*datastore.EntityResult{small}).
+		Return(nil)
+
+	metrics := NewCounters()
+
+	c := NewMiddleware(m)
+	c.Admission = NewAdmission()
+	c.Admission.MaxSize = 1000
+	c.Metrics = metrics
+
+	req := &datastore.LookupRequest{
+		ProjectId: projectID,
+		Keys:      testKeys2[:2],
+	}
+	reply := &datastore.LookupResponse{
+		Found: []*datastore.EntityResult{small, large},
+	}
+
+	if err := c.afterLookup(ctx, req, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := metrics.Get(MetricRejectedBySize, "b"); v != 1 {
+		t.Errorf("rejected entities differed: %d (expected: %d)", v, 1)
+	}
+}
+
+type sizingCache struct {
+	*mock.MockCache
+
+	size int
+}
+
+func (c *sizingCache) EncodedSize(_ string, _ *datastore.EntityResult) (int, error) {
+	return c.size, nil
+}
+
+func TestCacheMiddleware_admitEncodedSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	large := newEntityResult(testKeys2[0], 2000)
+	small := newEntityResult(testKeys2[0], 10)
+
+	// the size in the cache decides, such as that of a compressed or encrypted entry
+	//    └── 圧縮や暗号化したエントリなど、キャッシュでのサイズで判断する
+	c := NewMiddleware(&sizingCache{MockCache: mock.NewMockCache(ctrl), size: 100})
+	c.Admission = NewAdmission()
+	c.Admission.MaxSize = 1000
+
+	if admitted := c.admit(projectID, []*datastore.EntityResult{large}); len(admitted) != 1 {
+		t.Errorf("entity small in the cache was rejected")
+	}
+
+	c = NewMiddleware(&sizingCache{MockCache: mock.NewMockCache(ctrl), size: 5000})
+	c.Admission = NewAdmission()
+	c.Admission.MaxSize = 1000
+
+	if admitted := c.admit(projectID, []*datastore.EntityResult{small}); len(admitted) != 0 {
+		t.Errorf("entity large in the cache was admitted")
+	}
+}
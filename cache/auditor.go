@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	// MetricAuditSamples - Number of cached entities compared with Datastore by Auditor.
+	//                        └── AuditorがDatastoreと比較したキャッシュの数。
+	MetricAuditSamples = "audit_samples"
+
+	// MetricAuditDrifts - Number of sampled entities whose cache differed from Datastore.
+	//                       └── キャッシュがDatastoreと異なっていたサンプルの数。
+	// The drift rate of a kind is audit_drifts / audit_samples.
+	//    └── kindのドリフト率は audit_drifts / audit_samples となる。
+	MetricAuditDrifts = "audit_drifts"
+
+	// defaultAuditSampleSize - Default of Auditor.SampleSize.
+	//                            └── Auditor.SampleSizeのデフォルト値。
+	defaultAuditSampleSize = 100
+
+	// defaultAuditInterval - Default of Auditor.Interval.
+	//                          └── Auditor.Intervalのデフォルト値。
+	defaultAuditInterval = time.Minute
+)
+
+// Sampler - Optional interface of Cache that samples cached keys.
+//             └── キャッシュされているキーを抽出する、Cacheの任意のインターフェイス。
+type Sampler interface {
+	// Sample - Return up to n keys of projectID picked at random from the cache, without duplicates.
+	//            └── projectIDのキーを最大n個、重複なくキャッシュからランダムに選んで返す。
+	// projectID is made by keyenc.Project, so keys of a database other than the default one can be sampled.
+	//    └── projectIDはkeyenc.Projectで作られるため、デフォルト以外のデータベースのキーも抽出できる。
+	Sample(ctx context.Context, projectID string, n int) ([]*datastore.Key, error)
+}
+
+// AuditStats - Result of an audit for a kind.
+//                └── kindごとの監査の結果。
+type AuditStats struct {
+	// Samples - Number of cached entities compared with Datastore.
+	//             └── Datastoreと比較したキャッシュの数。
+	Samples int
+	// Drifts - Number of cached entities whose version differed from Datastore, or that were deleted in Datastore.
+	//            └── バージョンがDatastoreと異なっていた、またはDatastoreで削除されていたキャッシュの数。
+	Drifts int
+}
+
+// DriftRate - Ratio of Drifts to Samples.
+//               └── Samplesに対するDriftsの割合。
+func (s *AuditStats) DriftRate() float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return float64(s.Drifts) / float64(s.Samples)
+}
+
+// Auditor - Periodically compares sampled cache entries with Datastore and removes stale ones.
+//             └── 定期的にキャッシュのサンプルをDatastoreと比較し、古いものを削除する。
+// It detects drift caused by writes that are not made through Middleware,
+// such as other services, the console and Dataflow jobs.
+// Refreshed entities are written through PropertyPolicies and Admission of Middleware.
+//    └── 他のサービスやコンソール、Dataflowのジョブなど、Middlewareを経由しない書き込みによるずれを検出する。
+//    └── 更新するエンティティは、MiddlewareのPropertyPoliciesとAdmissionを通して書き込む。
+//
+// Pass a client whose connection is not hooked by Middleware, otherwise Lookups return the cache itself.
+//    └── Middlewareでフックされていない接続のクライアントを渡すこと。そうでない場合はLookupがキャッシュを返す。
+type Auditor struct {
+	middleware *Middleware
+	client     datastore.DatastoreClient
+
+	// DatabaseID - Database whose keys are audited. Empty means the default database.
+	//                └── キーを監査するデータベース。空の場合はデフォルトのデータベース。
+	DatabaseID string
+	// SampleSize - Number of keys sampled in each audit.
+	//                └── 1回の監査で抽出するキーの数。
+	SampleSize int
+	// Interval - Interval between audits in Run.
+	//              └── Runでの監査の間隔。
+	Interval time.Duration
+	// Refresh - Write the entities of Datastore after deleting stale entries.
+	//             └── 古いキャッシュを削除した後、Datastoreのエンティティを書き込む。
+	// Written entities are looked up again, and those committed meanwhile are deleted as the Warmer does.
+	//    └── Warmerと同様に、書き込んだエンティティを再度Lookupし、その間にCommitされたものは削除する。
+	Refresh bool
+	// Metrics - Receives audit_samples and audit_drifts. Nothing is reported if nil.
+	//             └── audit_samplesとaudit_driftsを受け取る。nilの場合は何も送らない。
+	Metrics Metrics
+	// Report - Called after each audit with the results indexed by kind. It must not block for long.
+	//            └── 監査ごとにkindで索引した結果とともに呼ばれる。長時間ブロックしてはいけない。
+	Report func(stats map[string]*AuditStats)
+	Logger *log.Logger
+}
+
+// NewAuditor - Initialize Auditor.
+//                └── Auditorを初期化する。
+// The cache of m must implement Sampler.
+//    └── mのキャッシュはSamplerを実装している必要がある。
+func NewAuditor(m *Middleware, client datastore.DatastoreClient) *Auditor {
+	return &Auditor{
+		middleware: m,
+		client:     client,
+		SampleSize: defaultAuditSampleSize,
+		Interval:   defaultAuditInterval,
+	}
+}
+
+// Run - Audit the cache of projectID every Interval until ctx is done.
+//         └── ctxが終了するまで、Intervalごとにキャッシュを監査する。
+// Errors of each audit are written to Logger, and the next audit is run.
+//    └── 各監査のエラーはLoggerに出力し、次の監査を行う。
+func (a *Auditor) Run(ctx context.Context, projectID string) error {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = defaultAuditInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.AuditOnce(ctx, projectID); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			a.logPrintError(xerrors.Errorf("audit failed: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// AuditOnce - Sample keys of projectID once, and delete or refresh stale entries.
+//               └── projectIDのキーを1回抽出し、古いキャッシュを削除または更新する。
+func (a *Auditor) AuditOnce(ctx context.Context, projectID string) (map[string]*AuditStats, error) {
+	sampler, ok := a.middleware.cache.(Sampler)
+	if !ok {
+		return nil, xerrors.New("cache does not implement Sampler")
+	}
+
+	size := a.SampleSize
+	if size <= 0 {
+		size = defaultAuditSampleSize
+	}
+	if size > maxWarmBatchSize {
+		size = maxWarmBatchSize
+	}
+
+	keys, err := sampler.Sample(ctx, keyenc.Project(projectID, a.DatabaseID), size)
+	if err != nil {
+		return nil, xerrors.Errorf("Sample failed: %w", err)
+	}
+
+	stats := map[string]*AuditStats{}
+	if len(keys) == 0 {
+		a.report(stats)
+		return stats, nil
+	}
+
+	cached, err := a.middleware.cache.GetMulti(ctx, projectID, keys)
+	if err != nil {
+		return nil, xerrors.Errorf("GetMulti failed: %w", err)
+	}
+	if len(cached) != len(keys) {
+		return nil, xerrors.Errorf("cache should return %d, but returned %d", len(keys), len(cached))
+	}
+
+	versions := make(map[string]int64, len(keys))
+	sampled := make([]*datastore.Key, 0, len(keys))
+	for i := range keys {
+		// the entry has expired or been deleted since it was sampled
+		if cached[i] == nil {
+			continue
+		}
+		versions[keyenc.Encode(projectID, keys[i])] = cached[i].Version
+		sampled = append(sampled, keys[i])
+	}
+
+	if len(sampled) == 0 {
+		a.report(stats)
+		return stats, nil
+	}
+
+	res, err := a.client.Lookup(ctx, &datastore.LookupRequest{
+		ProjectId:  projectID,
+		DatabaseId: a.DatabaseID,
+		Keys:       sampled,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("Lookup failed: %w", err)
+	}
+
+	var stale []*datastore.Key
+	var refreshed []*datastore.EntityResult
+
+	for _, e := range res.GetFound() {
+		key := e.GetEntity().GetKey()
+		setDatabase(a.DatabaseID, key)
+		drifted := versions[keyenc.Encode(projectID, key)] != e.Version
+
+		a.count(stats, key, drifted)
+		if drifted {
+			stale = append(stale, key)
+			refreshed = append(refreshed, e)
+		}
+	}
+	for _, e := range res.GetMissing() {
+		key := e.GetEntity().GetKey()
+		setDatabase(a.DatabaseID, key)
+
+		a.count(stats, key, true)
+		stale = append(stale, key)
+	}
+
+	if len(stale) > 0 {
+		if err := a.middleware.cache.DeleteMulti(ctx, projectID, stale); err != nil {
+			return nil, xerrors.Errorf("DeleteMulti failed: %w", err)
+		}
+	}
+
+	if a.Refresh {
+		refreshed = a.middleware.admit(projectID, a.middleware.transformBeforeCache(refreshed))
+	}
+
+	if a.Refresh && len(refreshed) > 0 {
+		if err := a.middleware.cache.SetMulti(ctx, projectID, refreshed); err != nil {
+			return nil, xerrors.Errorf("SetMulti failed: %w", err)
+		}
+
+		// entities committed after they were looked up must not be brought back
+		if _, err := invalidateChanged(ctx, a.client, a.middleware.cache, projectID, a.DatabaseID, refreshed); err != nil {
+			return nil, err
+		}
+	}
+
+	a.report(stats)
+
+	return stats, nil
+}
+
+// count - Count a sample of key in stats and Metrics.
+//           └── keyのサンプルをstatsとMetricsに数える。
+func (a *Auditor) count(stats map[string]*AuditStats, key *datastore.Key, drifted bool) {
+	kind := KindOf(key)
+
+	s, ok := stats[kind]
+	if !ok {
+		s = &AuditStats{}
+		stats[kind] = s
+	}
+
+	s.Samples++
+	if drifted {
+		s.Drifts++
+	}
+
+	if a.Metrics == nil {
+		return
+	}
+	a.Metrics.Add(MetricAuditSamples, kind, 1)
+	if drifted {
+		a.Metrics.Add(MetricAuditDrifts, kind, 1)
+	}
+}
+
+func (a *Auditor) report(stats map[string]*AuditStats) {
+	if a.Report != nil {
+		a.Report(stats)
+	}
+}
+
+func (a *Auditor) logPrintError(err error) {
+	if a.Logger == nil {
+		return
+	}
+	a.Logger.Printf("%v\n", err)
+}
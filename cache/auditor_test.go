@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/gcp-kit/datastore-cache-go/cache/mock"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+type samplingCache struct {
+	*mock.MockCache
+
+	keys      []*datastore.Key
+	projectID string
+}
+
+func (c *samplingCache) Sample(_ context.Context, projectID string, n int) ([]*datastore.Key, error) {
+	c.projectID = projectID
+
+	if n < len(c.keys) {
+		return c.keys[:n], nil
+	}
+	return c.keys, nil
+}
+
+func TestAuditor_AuditOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	upToDate := newUserEntity(testKeys2[0])
+	stale := newUserEntity(testKeys2[1])
+	latest := newUserEntity(testKeys2[1])
+	latest.Version = 2
+	deleted := newUserEntity(testKeys2[3])
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, testKeys2).
+		Return([]*datastore.EntityResult{upToDate, stale, nil, deleted}, nil)
+	m.EXPECT().
+		DeleteMulti(ctx, projectID, []*datastore.Key{testKeys2[1], testKeys2[3]}).
+		Return(nil)
+	m.EXPECT().
+		SetMulti(ctx, projectID, []*datastore.EntityResult{latest}).
+		Return(nil)
+
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{
+			"a": upToDate,
+			"b": latest,
+			"c": newUserEntity(testKeys2[2]),
+		},
+	}
+
+	counters := NewCounters()
+
+	a := NewAuditor(NewMiddleware(&samplingCache{MockCache: m, keys: testKeys2}), client)
+	a.Refresh = true
+	a.Metrics = counters
+
+	stats, err := a.AuditOnce(ctx, projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]AuditStats{
+		"a": {Samples: 1, Drifts: 0},
+		"b": {Samples: 1, Drifts: 1},
+		"d": {Samples: 1, Drifts: 1},
+	}
+
+	if len(stats) != len(expected) {
+		t.Errorf("audited kinds differed: %v", stats)
+	}
+
+	for kind, e := range expected {
+		if s := stats[kind]; s == nil || *s != e {
+			t.Errorf("stats of %s differed: %v (expected: %v)", kind, s, e)
+		}
+		if actual := counters.Get(MetricAuditDrifts, kind); actual != int64(e.Drifts) {
+			t.Errorf("%s of %s differed: %d (expected: %d)", MetricAuditDrifts, kind, actual, e.Drifts)
+		}
+	}
+
+	if rate := stats["b"].DriftRate(); rate != 1 {
+		t.Errorf("drift rate differed: %f", rate)
+	}
+
+	// the cache of "c" had gone before it was compared
+	if _, ok := stats["c"]; ok || client.lookups != 2 {
+		t.Errorf("entity without cache was audited: %v, %d lookups", stats["c"], client.lookups)
+	}
+}
+
+func TestAuditor_refreshWithPolicies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	stale := newUserEntity(testKeys2[0])
+	latest := newUserEntity(testKeys2[0])
+	latest.Version = 2
+	large := newEntityResult(testKeys2[1], 2000)
+	largeLatest := newEntityResult(testKeys2[1], 2000)
+	largeLatest.Version = 2
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, testKeys2[:2]).
+		Return([]*datastore.EntityResult{stale, large}, nil)
+	m.EXPECT().
+		DeleteMulti(ctx, projectID, testKeys2[:2]).
+		Return(nil)
+	m.EXPECT().
+		SetMulti(ctx, projectID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, items []*datastore.EntityResult) error {
+			if len(items) != 1 || items[0].Version != 2 || KindOf(items[0].Entity.Key) != "a" {
+				t.Fatalf("rejected entity was refreshed: %v", items)
+			}
+			if _, ok := items[0].Entity.Properties["Token"]; ok {
+				t.Errorf("excluded property was refreshed: %v", items[0])
+			}
+			return nil
+		})
+
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{"a": latest, "b": largeLatest},
+	}
+
+	middleware := NewMiddleware(&samplingCache{MockCache: m, keys: testKeys2[:2]})
+	middleware.PropertyPolicies = map[string]*PropertyPolicy{"a": {ExcludeProperties: []string{"Token"}}}
+	middleware.Admission = NewAdmission()
+	middleware.Admission.MaxSize = 1000
+
+	a := NewAuditor(middleware, client)
+	a.Refresh = true
+
+	if _, err := a.AuditOnce(ctx, projectID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditor_refreshConcurrentCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	stale := newUserEntity(testKeys2[0])
+	latest := newUserEntity(testKeys2[0])
+	latest.Version = 2
+
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{"a": latest},
+	}
+
+	// a is committed again between the Lookup of the audit and the refresh
+	client.afterLookup = func() {
+		committed := newUserEntity(testKeys2[0])
+		committed.Version = 3
+		client.entities["a"] = committed
+		client.afterLookup = nil
+	}
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, testKeys2[:1]).
+		Return([]*datastore.EntityResult{stale}, nil)
+	m.EXPECT().
+		DeleteMulti(ctx, projectID, testKeys2[:1]).
+		Return(nil).
+		Times(2)
+	m.EXPECT().
+		SetMulti(ctx, projectID, []*datastore.EntityResult{latest}).
+		Return(nil)
+
+	a := NewAuditor(NewMiddleware(&samplingCache{MockCache: m, keys: testKeys2[:1]}), client)
+	a.Refresh = true
+
+	if _, err := a.AuditOnce(ctx, projectID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditor_AuditOnceDatabase(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	key := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID, DatabaseId: "db"},
+		Path:        testKeys2[0].Path,
+	}
+	cached := newUserEntity(key)
+
+	// Datastore returns the key without the database
+	//    └── Datastoreはデータベースを持たないキーを返す
+	latest := newUserEntity(&datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID},
+		Path:        testKeys2[0].Path,
+	})
+	latest.Version = 2
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, []*datastore.Key{key}).
+		Return([]*datastore.EntityResult{cached}, nil)
+	m.EXPECT().
+		DeleteMulti(ctx, projectID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, keys []*datastore.Key) error {
+			if len(keys) != 1 || keys[0].GetPartitionId().GetDatabaseId() != "db" {
+				t.Errorf("key out of the database was deleted: %v", keys)
+			}
+			return nil
+		})
+
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{"a": latest},
+	}
+	sampler := &samplingCache{MockCache: m, keys: []*datastore.Key{key}}
+
+	a := NewAuditor(NewMiddleware(sampler), client)
+	a.DatabaseID = "db"
+
+	stats, err := a.AuditOnce(ctx, projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sampler.projectID != keyenc.Project(projectID, "db") || client.databaseID != "db" {
+		t.Errorf("database was not audited: sampled %q, looked up %q", sampler.projectID, client.databaseID)
+	}
+	if s := stats["a"]; s == nil || s.Drifts != 1 {
+		t.Errorf("drift in the database was not found: %v", s)
+	}
+}
+
+func TestAuditor_AuditOnceWithoutSampler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a := NewAuditor(NewMiddleware(mock.NewMockCache(ctrl)), &warmerClient{})
+
+	if _, err := a.AuditOnce(context.Background(), projectID); err == nil {
+		t.Errorf("cache without Sampler must be an error")
+	}
+}
@@ -20,6 +20,8 @@ import (
 //           └── データをキャッシュする機構。
 // It works by passing the one that satisfies this interface to middleware.
 //    └── このインターフェイスを満たしたものをmiddlewareに渡すことで動作する
+// Implementations can be tested with cachetest.RunConformance.
+//    └── 実装はcachetest.RunConformanceでテストできる。
 type Cache interface {
 	// GetMulti - get the cache.
 	//              └── キャッシュを取得する
@@ -33,6 +35,10 @@ type Cache interface {
 	//              └── キャッシュする
 	// Since an array of Entity of Datastore is passed, those data are cached.
 	//    └── datastoreのEntityの配列が渡されるので、それらのデータをキャッシュする。
+	// Entities in reserved projects or namespaces such as "__kind__" must not be cached.
+	//    └── "__kind__"のような予約されたプロジェクトや名前空間のエンティティはキャッシュしてはいけない。
+	// An older version must never replace a newer one.
+	//    └── 古いバージョンで新しいバージョンを置き換えてはいけない。
 	SetMulti(ctx context.Context, projectID string, items []*datastore.EntityResult) (err error)
 
 	// DeleteMulti - Delete from cache.
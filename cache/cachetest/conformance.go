@@ -0,0 +1,375 @@
+/*
+Package cachetest - This package provides a conformance test suite for implementations of cache.Cache.
+...
+このパッケージではcache.Cacheの実装に対する適合性テストを提供します。
+
+	func TestMyCache_Conformance(t *testing.T) {
+		cachetest.RunConformance(t, func(t *testing.T) cache.Cache {
+			return NewMyCache()
+		})
+	}
+*/
+package cachetest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// projectID - Project of the entities used in the suite.
+//               └── テストで使うエンティティのプロジェクト。
+const projectID = "cachetest-project"
+
+// concurrency - Number of goroutines in the concurrent access test.
+//                 └── 並行アクセスのテストのゴルーチンの数。
+const concurrency = 16
+
+// Factory - Create a Cache for a test.
+//             └── テスト用のCacheを作成する。
+// A new Cache may be returned every time, or the same one may be shared by the tests.
+// The suite writes entities to a namespace unique to each run, so existing data does not affect it.
+//    └── 毎回新しいCacheを返しても、同じものを共有しても良い。
+//    └── テストは実行ごとに固有の名前空間を使うため、既存のデータの影響を受けない。
+type Factory func(t *testing.T) cache.Cache
+
+// RunConformance - Test that the Cache created by factory satisfies the contract of cache.Cache.
+//                    └── factoryで作成したCacheがcache.Cacheの規約を満たしていることをテストする。
+func RunConformance(t *testing.T, factory Factory) {
+	s := &suite{
+		factory:   factory,
+		namespace: "cachetest-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+
+	t.Run("LengthAndOrder", s.testLengthAndOrder)
+	t.Run("EmptyKeys", s.testEmptyKeys)
+	t.Run("RoundTrip", s.testRoundTrip)
+	t.Run("Partitions", s.testPartitions)
+	t.Run("VersionMonotonicity", s.testVersionMonotonicity)
+	t.Run("ReservedPartitions", s.testReservedPartitions)
+	t.Run("DeleteThenGet", s.testDeleteThenGet)
+	t.Run("ConcurrentAccess", s.testConcurrentAccess)
+}
+
+type suite struct {
+	factory   Factory
+	namespace string
+}
+
+// key - Key of kind with the name in the namespace of the run.
+//         └── 実行ごとの名前空間にある、名前がnameのkindのキー。
+func (s *suite) key(kind, name string) *datastore.Key {
+	return &datastore.Key{
+		PartitionId: &datastore.PartitionId{
+			ProjectId:   projectID,
+			NamespaceId: s.namespace,
+		},
+		Path: []*datastore.Key_PathElement{
+			{Kind: kind, IdType: &datastore.Key_PathElement_Name{Name: name}},
+		},
+	}
+}
+
+// entity - EntityResult of key whose properties record the version.
+//            └── プロパティにバージョンを記録した、keyのEntityResult。
+func entity(key *datastore.Key, version int64) *datastore.EntityResult {
+	return &datastore.EntityResult{
+		Entity: &datastore.Entity{
+			Key: key,
+			Properties: map[string]*datastore.Value{
+				"Version": {ValueType: &datastore.Value_IntegerValue{IntegerValue: version}},
+				"Label": {
+					ValueType:          &datastore.Value_StringValue{StringValue: fmt.Sprintf("version %d", version)},
+					ExcludeFromIndexes: true,
+				},
+			},
+		},
+		Version: version,
+	}
+}
+
+func (s *suite) setMulti(t *testing.T, c cache.Cache, items ...*datastore.EntityResult) {
+	t.Helper()
+
+	if err := c.SetMulti(context.Background(), projectID, items); err != nil {
+		t.Fatalf("SetMulti failed: %+v", err)
+	}
+}
+
+func (s *suite) getMulti(t *testing.T, c cache.Cache, keys ...*datastore.Key) []*datastore.EntityResult {
+	t.Helper()
+
+	items, err := c.GetMulti(context.Background(), projectID, keys)
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+
+	if len(items) != len(keys) {
+		t.Fatalf("GetMulti must return %d items, but returned %d", len(keys), len(items))
+	}
+
+	return items
+}
+
+// expectVersion - Check that item is the entity of key at version, or a miss if version is 0.
+//                   └── itemがkeyのversionのエンティティであるか、versionが0の場合はミスであることを確かめる。
+func expectVersion(t *testing.T, item *datastore.EntityResult, key *datastore.Key, version int64) {
+	t.Helper()
+
+	if version == 0 {
+		if item != nil {
+			t.Errorf("%v must be a miss, but version %d was returned", key.Path, item.Version)
+		}
+		return
+	}
+
+	if item == nil {
+		t.Errorf("%v must be a hit at version %d, but was a miss", key.Path, version)
+		return
+	}
+
+	if !proto.Equal(item.GetEntity().GetKey(), key) {
+		t.Errorf("entity of %v must be returned, but %v was returned", key.Path, item.GetEntity().GetKey().GetPath())
+	}
+
+	if item.Version != version {
+		t.Errorf("%v must be at version %d, but %d was returned", key.Path, version, item.Version)
+	}
+}
+
+// testLengthAndOrder - items must have the same length and order as keys, with nil for misses.
+//                        └── itemsはkeysと同じ長さと順序で、ミスの場合はnilである必要がある。
+func (s *suite) testLengthAndOrder(t *testing.T) {
+	c := s.factory(t)
+
+	keys := make([]*datastore.Key, 6)
+	for i := range keys {
+		keys[i] = s.key("Order", strconv.Itoa(i))
+	}
+
+	for i, item := range s.getMulti(t, c, keys...) {
+		expectVersion(t, item, keys[i], 0)
+	}
+
+	s.setMulti(t, c, entity(keys[1], 11), entity(keys[3], 13), entity(keys[4], 14))
+
+	// reversed order with misses interleaved
+	reversed := []*datastore.Key{keys[5], keys[4], keys[3], keys[2], keys[1], keys[0]}
+	expected := []int64{0, 14, 13, 0, 11, 0}
+
+	for i, item := range s.getMulti(t, c, reversed...) {
+		expectVersion(t, item, reversed[i], expected[i])
+	}
+}
+
+// testEmptyKeys - GetMulti with no keys must return no items without errors.
+//                   └── キーの無いGetMultiはエラー無しで空の結果を返す必要がある。
+func (s *suite) testEmptyKeys(t *testing.T) {
+	c := s.factory(t)
+
+	if items := s.getMulti(t, c); len(items) != 0 {
+		t.Errorf("GetMulti returned %d items for no keys", len(items))
+	}
+
+	s.setMulti(t, c)
+
+	if err := c.DeleteMulti(context.Background(), projectID, nil); err != nil {
+		t.Errorf("DeleteMulti failed for no keys: %+v", err)
+	}
+}
+
+// testRoundTrip - Entities must be returned as they were set.
+//                   └── エンティティはSetした通りに返される必要がある。
+func (s *suite) testRoundTrip(t *testing.T) {
+	c := s.factory(t)
+
+	key := s.key("RoundTrip", "a:b\\c")
+	item := entity(key, 7)
+	item.Entity.Properties["Array"] = &datastore.Value{
+		ValueType: &datastore.Value_ArrayValue{ArrayValue: &datastore.ArrayValue{
+			Values: []*datastore.Value{
+				{ValueType: &datastore.Value_BlobValue{BlobValue: []byte{0, 1, 0xff}}},
+				{ValueType: &datastore.Value_NullValue{}},
+			},
+		}},
+	}
+
+	s.setMulti(t, c, item)
+
+	actual := s.getMulti(t, c, key)[0]
+	if !proto.Equal(actual, item) {
+		t.Errorf("entity differed:\nactual  : %v\nexpected: %v", actual, item)
+	}
+}
+
+// testPartitions - Entities with the same path in different namespaces or kinds must be distinct.
+//                    └── 名前空間やkindが異なる同じパスのエンティティは区別される必要がある。
+func (s *suite) testPartitions(t *testing.T) {
+	c := s.factory(t)
+
+	key := s.key("Partition", "same")
+	otherNamespace := s.key("Partition", "same")
+	otherNamespace.PartitionId.NamespaceId += "-other"
+	otherKind := s.key("Partition2", "same")
+	child := s.key("Partition", "same")
+	child.Path = append(child.Path, &datastore.Key_PathElement{
+		Kind: "Partition", IdType: &datastore.Key_PathElement_Name{Name: "same"},
+	})
+
+	s.setMulti(t, c, entity(key, 1), entity(otherNamespace, 2), entity(otherKind, 3), entity(child, 4))
+
+	keys := []*datastore.Key{key, otherNamespace, otherKind, child}
+	for i, item := range s.getMulti(t, c, keys...) {
+		expectVersion(t, item, keys[i], int64(i+1))
+	}
+}
+
+// testVersionMonotonicity - An older version must never replace a newer one.
+//                             └── 古いバージョンが新しいバージョンを置き換えてはいけない。
+func (s *suite) testVersionMonotonicity(t *testing.T) {
+	c := s.factory(t)
+
+	newer := s.key("Version", "newer-first")
+	older := s.key("Version", "older-first")
+
+	s.setMulti(t, c, entity(newer, 20), entity(older, 10))
+	s.setMulti(t, c, entity(newer, 10), entity(older, 20))
+
+	items := s.getMulti(t, c, newer, older)
+	expectVersion(t, items[0], newer, 20)
+	expectVersion(t, items[1], older, 20)
+
+	// the same version may be set again
+	s.setMulti(t, c, entity(newer, 20))
+	expectVersion(t, s.getMulti(t, c, newer)[0], newer, 20)
+}
+
+// testReservedPartitions - Entities in reserved projects or namespaces such as "__kind__" must not be cached.
+//                            └── "__kind__"のような予約されたプロジェクトや名前空間のエンティティはキャッシュしてはいけない。
+func (s *suite) testReservedPartitions(t *testing.T) {
+	c := s.factory(t)
+	ctx := context.Background()
+
+	normal := s.key("Reserved", "normal")
+	reservedNamespace := s.key("Reserved", "namespace")
+	reservedNamespace.PartitionId.NamespaceId = "__reserved__"
+	reservedProject := s.key("Reserved", "project")
+	reservedProject.PartitionId.ProjectId = "__reserved__"
+
+	s.setMulti(t, c, entity(normal, 1), entity(reservedNamespace, 2), entity(reservedProject, 3))
+
+	keys := []*datastore.Key{reservedNamespace, normal, reservedProject}
+	items := s.getMulti(t, c, keys...)
+	expectVersion(t, items[0], reservedNamespace, 0)
+	expectVersion(t, items[1], normal, 1)
+	expectVersion(t, items[2], reservedProject, 0)
+
+	// the project of the request applies to keys without a project
+	byRequest := s.key("Reserved", "request")
+	byRequest.PartitionId.ProjectId = ""
+
+	if err := c.SetMulti(ctx, "__reserved__", []*datastore.EntityResult{entity(byRequest, 4)}); err != nil {
+		t.Fatalf("SetMulti failed for a reserved project: %+v", err)
+	}
+
+	items, err := c.GetMulti(ctx, "__reserved__", []*datastore.Key{byRequest})
+	if err != nil {
+		t.Fatalf("GetMulti failed for a reserved project: %+v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("GetMulti must return 1 item for a reserved project, but returned %d", len(items))
+	}
+	expectVersion(t, items[0], byRequest, 0)
+
+	if err := c.DeleteMulti(ctx, "__reserved__", []*datastore.Key{byRequest}); err != nil {
+		t.Fatalf("DeleteMulti failed for a reserved project: %+v", err)
+	}
+
+	expectVersion(t, s.getMulti(t, c, normal)[0], normal, 1)
+}
+
+// testDeleteThenGet - Deleted entities must be misses, and deleting missing entities must succeed.
+//                       └── 削除したエンティティはミスとなり、存在しないエンティティの削除は成功する必要がある。
+func (s *suite) testDeleteThenGet(t *testing.T) {
+	c := s.factory(t)
+	ctx := context.Background()
+
+	deleted := s.key("Delete", "deleted")
+	kept := s.key("Delete", "kept")
+	missing := s.key("Delete", "missing")
+
+	s.setMulti(t, c, entity(deleted, 1), entity(kept, 1))
+
+	if err := c.DeleteMulti(ctx, projectID, []*datastore.Key{deleted, missing}); err != nil {
+		t.Fatalf("DeleteMulti failed: %+v", err)
+	}
+
+	items := s.getMulti(t, c, deleted, kept, missing)
+	expectVersion(t, items[0], deleted, 0)
+	expectVersion(t, items[1], kept, 1)
+	expectVersion(t, items[2], missing, 0)
+
+	// any version can be cached again after the deletion
+	s.setMulti(t, c, entity(deleted, 1))
+	expectVersion(t, s.getMulti(t, c, deleted)[0], deleted, 1)
+}
+
+// testConcurrentAccess - Concurrent calls must not fail or mix up entities.
+//                          └── 並行した呼び出しが失敗したり、エンティティを取り違えたりしてはいけない。
+func (s *suite) testConcurrentAccess(t *testing.T) {
+	c := s.factory(t)
+	ctx := context.Background()
+
+	shared := s.key("Concurrent", "shared")
+	errs := make(chan error, concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			own := s.key("Concurrent", strconv.Itoa(i))
+			version := int64(i + 1)
+
+			items := []*datastore.EntityResult{entity(own, version), entity(shared, version)}
+			if err := c.SetMulti(ctx, projectID, items); err != nil {
+				errs <- fmt.Errorf("SetMulti failed: %v", err)
+				return
+			}
+
+			items, err := c.GetMulti(ctx, projectID, []*datastore.Key{own, shared})
+			if err != nil {
+				errs <- fmt.Errorf("GetMulti failed: %v", err)
+				return
+			}
+
+			if len(items) != 2 || items[0] == nil ||
+				items[0].Version != version || !proto.Equal(items[0].Entity.Key, own) {
+				errs <- fmt.Errorf("goroutine %d got a wrong entity: %v", i, items)
+				return
+			}
+
+			if err := c.DeleteMulti(ctx, projectID, []*datastore.Key{own}); err != nil {
+				errs <- fmt.Errorf("DeleteMulti failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// the newest version wins regardless of the order of the writes
+	expectVersion(t, s.getMulti(t, c, shared)[0], shared, concurrency)
+}
@@ -0,0 +1,85 @@
+package cachetest_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/cachetest"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// mapCache - Minimal Cache that satisfies the contract.
+//              └── 規約を満たす最小限のCache。
+type mapCache struct {
+	mu       sync.Mutex
+	entities map[string]*datastore.EntityResult
+}
+
+func isReserved(id string) bool {
+	return strings.HasPrefix(id, "__") && strings.HasSuffix(id, "__")
+}
+
+func cacheKey(projectID string, key *datastore.Key) string {
+	if isReserved(projectID) ||
+		isReserved(key.GetPartitionId().GetProjectId()) || isReserved(key.GetPartitionId().GetNamespaceId()) {
+		return ""
+	}
+	return keyenc.Encode(projectID, key)
+}
+
+func (c *mapCache) GetMulti(
+	_ context.Context,
+	projectID string,
+	keys []*datastore.Key,
+) ([]*datastore.EntityResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := make([]*datastore.EntityResult, len(keys))
+	for i := range keys {
+		if e, ok := c.entities[cacheKey(projectID, keys[i])]; ok {
+			items[i] = proto.Clone(e).(*datastore.EntityResult)
+		}
+	}
+
+	return items, nil
+}
+
+func (c *mapCache) SetMulti(_ context.Context, projectID string, items []*datastore.EntityResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range items {
+		key := cacheKey(projectID, e.Entity.Key)
+		if key == "" {
+			continue
+		}
+		if current, ok := c.entities[key]; !ok || current.Version <= e.Version {
+			c.entities[key] = proto.Clone(e).(*datastore.EntityResult)
+		}
+	}
+
+	return nil
+}
+
+func (c *mapCache) DeleteMulti(_ context.Context, projectID string, keys []*datastore.Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.entities, cacheKey(projectID, key))
+	}
+
+	return nil
+}
+
+func TestRunConformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) cache.Cache {
+		return &mapCache{entities: map[string]*datastore.EntityResult{}}
+	})
+}
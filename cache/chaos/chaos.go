@@ -0,0 +1,290 @@
+/*
+Package chaos - This package provides a Cache wrapper that injects faults for chaos testing.
+...
+このパッケージではカオステストのために障害を注入するCacheのラッパーを提供します。
+
+	c := chaos.NewCache(redis.NewRedis(pool))
+	c.Set(chaos.OpGetMulti, &chaos.Faults{ErrorRate: 0.5, Latency: 100 * time.Millisecond})
+	middleware := cache.NewMiddleware(c)
+*/
+package chaos
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// ErrInjected - Error returned by injected failures when Faults.Err is nil.
+//                 └── Faults.Errがnilの場合に、注入した失敗が返すエラー。
+var ErrInjected = xerrors.New("chaos: injected failure")
+
+// Operation - Operation of Cache that faults are injected into.
+//               └── 障害を注入するCacheの操作。
+type Operation string
+
+const (
+	// OpGetMulti - Cache.GetMulti
+	OpGetMulti Operation = "GetMulti"
+	// OpSetMulti - Cache.SetMulti
+	OpSetMulti Operation = "SetMulti"
+	// OpDeleteMulti - Cache.DeleteMulti
+	OpDeleteMulti Operation = "DeleteMulti"
+)
+
+// Faults - Faults injected into an operation. Rates are probabilities from 0 to 1.
+//            └── 操作に注入する障害。割合は0から1の確率。
+type Faults struct {
+	// Latency - Delay added before the operation.
+	//             └── 操作の前に追加する遅延。
+	Latency time.Duration
+	// ErrorRate - Rate of calls that fail with Err without reaching the cache.
+	//               └── キャッシュに届かずにErrで失敗する呼び出しの割合。
+	ErrorRate float64
+	// Err - Error of failed calls. ErrInjected if nil.
+	//         └── 失敗した呼び出しのエラー。nilの場合はErrInjected。
+	Err error
+	// PartialRate - Rate of hits of GetMulti turned into misses.
+	//                 └── GetMultiのヒットをミスに変える割合。
+	PartialRate float64
+	// DropRate - Rate of entities or keys of SetMulti and DeleteMulti silently dropped.
+	//              └── SetMultiとDeleteMultiのエンティティやキーを黙って捨てる割合。
+	DropRate float64
+	// StaleRate - Rate of keys of GetMulti answered with the entity cached before the latest write or deletion.
+	//               └── GetMultiのキーに対し、最後の書き込みや削除の前にキャッシュされていたエンティティを返す割合。
+	// Only writes and deletions made through the wrapper are remembered.
+	//    └── ラッパーを経由した書き込みと削除のみが記憶される。
+	StaleRate float64
+}
+
+// Cache - Cache that injects faults into the wrapped Cache.
+//           └── ラップしたCacheに障害を注入するCache。
+// Faults can be changed at runtime, so that a test can break the cache in the middle of a scenario.
+//    └── 障害は実行中に変更できるため、テストのシナリオの途中でキャッシュを壊すことができる。
+type Cache struct {
+	cache cache.Cache
+
+	mu       sync.Mutex
+	faults   map[Operation]*Faults
+	rand     *rand.Rand
+	latest   map[string]*datastore.EntityResult
+	previous map[string]*datastore.EntityResult
+	injected map[Operation]int
+}
+
+var _ cache.Cache = &Cache{}
+
+// NewCache - Initialize Cache wrapping c. No faults are injected until Set is called.
+//              └── cをラップするCacheを初期化する。Setが呼ばれるまで障害は注入しない。
+func NewCache(c cache.Cache) *Cache {
+	return &Cache{
+		cache:    c,
+		faults:   map[Operation]*Faults{},
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		latest:   map[string]*datastore.EntityResult{},
+		previous: map[string]*datastore.EntityResult{},
+		injected: map[Operation]int{},
+	}
+}
+
+// Set - Inject faults into op. nil stops the injection.
+//         └── opにfaultsを注入する。nilの場合は注入を止める。
+func (c *Cache) Set(op Operation, faults *Faults) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if faults == nil {
+		delete(c.faults, op)
+		return
+	}
+
+	copied := *faults
+	c.faults[op] = &copied
+}
+
+// Reset - Stop all injections.
+//           └── 全ての注入を止める。
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faults = map[Operation]*Faults{}
+}
+
+// Seed - Seed the random numbers deciding injections, to make a test reproducible.
+//          └── 注入を決める乱数のシードを設定し、テストを再現可能にする。
+func (c *Cache) Seed(seed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rand = rand.New(rand.NewSource(seed))
+}
+
+// Injected - Number of faults injected into op, counting each failed call, dropped item and altered result.
+//              └── opに注入した障害の数。失敗した呼び出し、捨てた要素、変更した結果をそれぞれ数える。
+func (c *Cache) Injected(op Operation) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.injected[op]
+}
+
+// GetMulti - Get the cache with faults injected.
+//              └── 障害を注入してキャッシュを取得する。
+func (c *Cache) GetMulti(
+	ctx context.Context,
+	projectID string,
+	keys []*datastore.Key,
+) ([]*datastore.EntityResult, error) {
+	faults, err := c.begin(ctx, OpGetMulti)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := c.cache.GetMulti(ctx, projectID, keys)
+	if err != nil || faults == nil || len(items) != len(keys) {
+		return items, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range items {
+		if items[i] != nil && c.hit(OpGetMulti, faults.PartialRate) {
+			items[i] = nil
+			continue
+		}
+
+		stale, ok := c.previous[keyenc.Encode(projectID, keys[i])]
+		if ok && (items[i] == nil || items[i].Version > stale.Version) && c.hit(OpGetMulti, faults.StaleRate) {
+			items[i] = proto.Clone(stale).(*datastore.EntityResult)
+		}
+	}
+
+	return items, nil
+}
+
+// SetMulti - Set to the cache with faults injected.
+//              └── 障害を注入してキャッシュする。
+func (c *Cache) SetMulti(ctx context.Context, projectID string, items []*datastore.EntityResult) error {
+	faults, err := c.begin(ctx, OpSetMulti)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	kept := make([]*datastore.EntityResult, 0, len(items))
+	for _, e := range items {
+		if faults != nil && c.hit(OpSetMulti, faults.DropRate) {
+			continue
+		}
+		kept = append(kept, e)
+
+		encoded := keyenc.Encode(projectID, e.GetEntity().GetKey())
+		if latest, ok := c.latest[encoded]; !ok || latest.Version < e.Version {
+			if ok {
+				c.previous[encoded] = latest
+			}
+			c.latest[encoded] = proto.Clone(e).(*datastore.EntityResult)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(kept) == 0 && len(items) > 0 {
+		return nil
+	}
+
+	return c.cache.SetMulti(ctx, projectID, kept)
+}
+
+// DeleteMulti - Delete from the cache with faults injected.
+//                 └── 障害を注入してキャッシュから削除する。
+func (c *Cache) DeleteMulti(ctx context.Context, projectID string, keys []*datastore.Key) error {
+	faults, err := c.begin(ctx, OpDeleteMulti)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	kept := make([]*datastore.Key, 0, len(keys))
+	for _, key := range keys {
+		if faults != nil && c.hit(OpDeleteMulti, faults.DropRate) {
+			continue
+		}
+		kept = append(kept, key)
+
+		encoded := keyenc.Encode(projectID, key)
+		if latest, ok := c.latest[encoded]; ok {
+			c.previous[encoded] = latest
+			delete(c.latest, encoded)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(kept) == 0 && len(keys) > 0 {
+		return nil
+	}
+
+	return c.cache.DeleteMulti(ctx, projectID, kept)
+}
+
+// begin - Wait for the latency of op and decide whether the call fails.
+//           └── opの遅延を待ち、呼び出しを失敗させるかどうかを決める。
+// The returned Faults is a copy, or nil if nothing is injected into op.
+//    └── 返すFaultsはコピーで、opに何も注入しない場合はnil。
+func (c *Cache) begin(ctx context.Context, op Operation) (*Faults, error) {
+	c.mu.Lock()
+	faults, ok := c.faults[op]
+	var copied Faults
+	if ok {
+		copied = *faults
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	if copied.Latency > 0 {
+		timer := time.NewTimer(copied.Latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	c.mu.Lock()
+	failed := c.hit(op, copied.ErrorRate)
+	c.mu.Unlock()
+
+	if failed {
+		if copied.Err != nil {
+			return nil, copied.Err
+		}
+		return nil, ErrInjected
+	}
+
+	return &copied, nil
+}
+
+// hit - Decide an injection at rate and count it. c.mu must be held.
+//         └── rateで注入するかを決め、数える。c.muを保持している必要がある。
+func (c *Cache) hit(op Operation, rate float64) bool {
+	if rate <= 0 || (rate < 1 && c.rand.Float64() >= rate) {
+		return false
+	}
+
+	c.injected[op]++
+
+	return true
+}
@@ -0,0 +1,202 @@
+package chaos_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/cachetest"
+	"github.com/gcp-kit/datastore-cache-go/cache/chaos"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	projectID = "project-id"
+)
+
+func newKey(name string) *datastore.Key {
+	return &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID},
+		Path:        []*datastore.Key_PathElement{{Kind: "User", IdType: &datastore.Key_PathElement_Name{Name: name}}},
+	}
+}
+
+func newEntity(key *datastore.Key, version int64) *datastore.EntityResult {
+	return &datastore.EntityResult{Entity: &datastore.Entity{Key: key}, Version: version}
+}
+
+func TestCache_Conformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) cache.Cache {
+		return chaos.NewCache(fake.NewCache())
+	})
+}
+
+func TestCache_Error(t *testing.T) {
+	c := chaos.NewCache(fake.NewCache())
+	ctx := context.Background()
+	key := newKey("foo")
+
+	items := []*datastore.EntityResult{newEntity(key, 1)}
+
+	c.Set(chaos.OpSetMulti, &chaos.Faults{ErrorRate: 1})
+	if err := c.SetMulti(ctx, projectID, items); !xerrors.Is(err, chaos.ErrInjected) {
+		t.Errorf("SetMulti must fail with ErrInjected: %+v", err)
+	}
+
+	custom := xerrors.New("custom")
+	c.Set(chaos.OpSetMulti, &chaos.Faults{ErrorRate: 1, Err: custom})
+	if err := c.SetMulti(ctx, projectID, items); err != custom {
+		t.Errorf("SetMulti must fail with the custom error: %+v", err)
+	}
+
+	c.Set(chaos.OpSetMulti, nil)
+	if err := c.SetMulti(ctx, projectID, items); err != nil {
+		t.Fatalf("SetMulti failed after the injection stopped: %+v", err)
+	}
+
+	items, err := c.GetMulti(ctx, projectID, []*datastore.Key{key})
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if items[0].GetVersion() != 1 {
+		t.Errorf("entity was not cached: %v", items[0])
+	}
+
+	if n := c.Injected(chaos.OpSetMulti); n != 2 {
+		t.Errorf("unexpected number of injections: %d", n)
+	}
+}
+
+func TestCache_Rate(t *testing.T) {
+	c := chaos.NewCache(fake.NewCache())
+	c.Seed(1)
+	c.Set(chaos.OpDeleteMulti, &chaos.Faults{ErrorRate: 0.5})
+
+	failed := 0
+	for i := 0; i < 1000; i++ {
+		if err := c.DeleteMulti(context.Background(), projectID, []*datastore.Key{newKey("foo")}); err != nil {
+			failed++
+		}
+	}
+
+	if failed < 400 || failed > 600 {
+		t.Errorf("%d of 1000 calls failed at rate 0.5", failed)
+	}
+	if n := c.Injected(chaos.OpDeleteMulti); n != failed {
+		t.Errorf("injections were counted as %d, expected %d", n, failed)
+	}
+}
+
+func TestCache_Latency(t *testing.T) {
+	c := chaos.NewCache(fake.NewCache())
+	c.Set(chaos.OpGetMulti, &chaos.Faults{Latency: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := c.GetMulti(context.Background(), projectID, []*datastore.Key{newKey("foo")}); err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("latency was not injected: %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	c.Set(chaos.OpGetMulti, &chaos.Faults{Latency: time.Minute})
+	if _, err := c.GetMulti(ctx, projectID, []*datastore.Key{newKey("foo")}); err != context.DeadlineExceeded {
+		t.Errorf("GetMulti must give up at the deadline: %+v", err)
+	}
+}
+
+func TestCache_PartialAndDrop(t *testing.T) {
+	c := chaos.NewCache(fake.NewCache())
+	ctx := context.Background()
+	keys := []*datastore.Key{newKey("foo"), newKey("bar")}
+
+	c.Set(chaos.OpSetMulti, &chaos.Faults{DropRate: 1})
+	if err := c.SetMulti(ctx, projectID, []*datastore.EntityResult{newEntity(keys[0], 1)}); err != nil {
+		t.Fatalf("SetMulti failed: %+v", err)
+	}
+
+	items, err := c.GetMulti(ctx, projectID, keys)
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if items[0] != nil {
+		t.Errorf("dropped write was cached: %v", items[0])
+	}
+
+	c.Reset()
+	items = []*datastore.EntityResult{newEntity(keys[0], 1), newEntity(keys[1], 1)}
+	if err := c.SetMulti(ctx, projectID, items); err != nil {
+		t.Fatalf("SetMulti failed: %+v", err)
+	}
+
+	c.Set(chaos.OpGetMulti, &chaos.Faults{PartialRate: 1})
+	items, err = c.GetMulti(ctx, projectID, keys)
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if len(items) != len(keys) || items[0] != nil || items[1] != nil {
+		t.Errorf("hits were not turned into misses: %v", items)
+	}
+
+	c.Set(chaos.OpDeleteMulti, &chaos.Faults{DropRate: 1})
+	if err := c.DeleteMulti(ctx, projectID, keys[:1]); err != nil {
+		t.Fatalf("DeleteMulti failed: %+v", err)
+	}
+
+	c.Reset()
+	items, err = c.GetMulti(ctx, projectID, keys[:1])
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if items[0] == nil {
+		t.Errorf("dropped deletion was applied")
+	}
+}
+
+func TestCache_Stale(t *testing.T) {
+	c := chaos.NewCache(fake.NewCache())
+	ctx := context.Background()
+	key := newKey("foo")
+
+	for _, version := range []int64{1, 2} {
+		if err := c.SetMulti(ctx, projectID, []*datastore.EntityResult{newEntity(key, version)}); err != nil {
+			t.Fatalf("SetMulti failed: %+v", err)
+		}
+	}
+
+	c.Set(chaos.OpGetMulti, &chaos.Faults{StaleRate: 1})
+	items, err := c.GetMulti(ctx, projectID, []*datastore.Key{key})
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if items[0].GetVersion() != 1 {
+		t.Errorf("stale version was not returned: %v", items[0])
+	}
+
+	if err := c.DeleteMulti(ctx, projectID, []*datastore.Key{key}); err != nil {
+		t.Fatalf("DeleteMulti failed: %+v", err)
+	}
+
+	items, err = c.GetMulti(ctx, projectID, []*datastore.Key{key})
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if items[0].GetVersion() != 2 {
+		t.Errorf("deleted version was not returned: %v", items[0])
+	}
+
+	c.Set(chaos.OpGetMulti, nil)
+	items, err = c.GetMulti(ctx, projectID, []*datastore.Key{key})
+	if err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+	if items[0] != nil {
+		t.Errorf("deleted entity was returned without faults: %v", items[0])
+	}
+}
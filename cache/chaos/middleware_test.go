@@ -0,0 +1,206 @@
+package chaos_test
+
+import (
+	"context"
+	"testing"
+
+	cds "cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/chaos"
+	"github.com/gcp-kit/datastore-cache-go/cache/dstest"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+type User struct {
+	Name string
+}
+
+// newClient - Start dstest.Server and return a client whose Middleware uses the chaos Cache.
+//               └── dstest.Serverを起動し、カオスCacheを使うMiddlewareのクライアントを返す。
+func newClient(t *testing.T, options ...func(m *cache.Middleware)) (*dstest.Server, *chaos.Cache, *cds.Client) {
+	t.Helper()
+
+	srv := dstest.NewServer()
+	c := chaos.NewCache(fake.NewCache())
+
+	middleware := cache.NewMiddleware(c)
+	for _, option := range options {
+		option(middleware)
+	}
+
+	conn, err := srv.Dial(grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	client, err := cds.NewClient(context.Background(), projectID, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("failed to initialize datastore client: %+v", err)
+	}
+
+	return srv, c, client
+}
+
+// TestMiddleware_LookupFailOpen - Lookup falls back to Datastore while every cache operation fails.
+//                                   └── 全てのキャッシュ操作が失敗する間、LookupはDatastoreにフォールバックする。
+func TestMiddleware_LookupFailOpen(t *testing.T) {
+	srv, c, client := newClient(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	key, err := client.Put(ctx, cds.NameKey("User", "foo", nil), &User{Name: "foo"})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	c.Set(chaos.OpGetMulti, &chaos.Faults{ErrorRate: 1})
+	c.Set(chaos.OpSetMulti, &chaos.Faults{ErrorRate: 1})
+
+	for i := 0; i < 3; i++ {
+		var user User
+		if err := client.Get(ctx, key, &user); err != nil {
+			t.Fatalf("Get failed while the cache was broken: %+v", err)
+		}
+		if user.Name != "foo" {
+			t.Errorf("retrieved entity differed: %+v", user)
+		}
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 3 {
+		t.Errorf("Lookup reached Datastore %d times", calls)
+	}
+
+	// Once the cache recovers, entities are cached again
+	//    └── キャッシュが回復すると、エンティティは再びキャッシュされる
+	c.Reset()
+	for i := 0; i < 2; i++ {
+		var user User
+		if err := client.Get(ctx, key, &user); err != nil {
+			t.Fatalf("Get failed: %+v", err)
+		}
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 4 {
+		t.Errorf("Lookup reached Datastore %d times after recovery", calls)
+	}
+}
+
+// TestMiddleware_LookupPartial - Lookup returns every entity even if the cache returns only some of them.
+//                                  └── キャッシュが一部しか返さなくても、Lookupは全てのエンティティを返す。
+func TestMiddleware_LookupPartial(t *testing.T) {
+	srv, c, client := newClient(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	keys := []*cds.Key{cds.NameKey("User", "foo", nil), cds.NameKey("User", "bar", nil)}
+	if _, err := client.PutMulti(ctx, keys, []*User{{Name: "foo"}, {Name: "bar"}}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	users := make([]*User, len(keys))
+	if err := client.GetMulti(ctx, keys, users); err != nil {
+		t.Fatalf("GetMulti failed: %+v", err)
+	}
+
+	c.Seed(1)
+	c.Set(chaos.OpGetMulti, &chaos.Faults{PartialRate: 0.5})
+
+	for i := 0; i < 10; i++ {
+		users := make([]*User, len(keys))
+		if err := client.GetMulti(ctx, keys, users); err != nil {
+			t.Fatalf("GetMulti failed with partial results: %+v", err)
+		}
+		if users[0].Name != "foo" || users[1].Name != "bar" {
+			t.Errorf("retrieved entities differed: %+v, %+v", users[0], users[1])
+		}
+	}
+
+	if c.Injected(chaos.OpGetMulti) == 0 {
+		t.Errorf("no partial results were injected")
+	}
+}
+
+// TestMiddleware_CommitFailure - Commit is aborted if the cache cannot be cleared before it,
+// and succeeds if only the deletion after it fails.
+//                                  └── Commit前にキャッシュを削除できない場合はCommitを中止し、
+//                                      Commit後の削除だけが失敗した場合は成功する。
+func TestMiddleware_CommitFailure(t *testing.T) {
+	ctx := context.Background()
+	key := cds.NameKey("User", "foo", nil)
+
+	t.Run("before commit", func(t *testing.T) {
+		srv, c, client := newClient(t)
+		defer srv.Close()
+
+		c.Set(chaos.OpDeleteMulti, &chaos.Faults{ErrorRate: 1})
+		if _, err := client.Put(ctx, key, &User{Name: "foo"}); err == nil {
+			t.Errorf("Put must fail when the cache cannot be cleared before Commit")
+		}
+
+		if calls := srv.Calls("Commit"); calls != 0 {
+			t.Errorf("Commit reached Datastore %d times", calls)
+		}
+	})
+
+	t.Run("after commit", func(t *testing.T) {
+		// Clear the cache only after Commit, so that the injected failure hits the deletion after it
+		//    └── Commit後にのみキャッシュを削除し、注入した失敗がCommit後の削除に当たるようにする
+		srv, c, client := newClient(t, func(m *cache.Middleware) {
+			m.CacheDeleteTiming = cache.DeleteTimingAfterCommit
+			m.CachingModeFunc = func(
+				context.Context, string, interface{}, interface{}, *grpc.ClientConn, grpc.UnaryInvoker, ...grpc.CallOption,
+			) cache.CachingModeType {
+				return cache.CachingModeReadOnly
+			}
+		})
+		defer srv.Close()
+
+		c.Set(chaos.OpDeleteMulti, &chaos.Faults{ErrorRate: 1})
+		if _, err := client.Put(ctx, key, &User{Name: "foo"}); err != nil {
+			t.Fatalf("Put failed while only the deletion after Commit failed: %+v", err)
+		}
+
+		var user User
+		if err := client.Get(ctx, key, &user); err != nil {
+			t.Fatalf("Get failed: %+v", err)
+		}
+		if user.Name != "foo" {
+			t.Errorf("retrieved entity differed: %+v", user)
+		}
+	})
+}
+
+// TestMiddleware_DroppedDeletion - A dropped deletion leaves the old entity in the cache.
+//                                    └── 削除が捨てられると、古いエンティティがキャッシュに残る。
+func TestMiddleware_DroppedDeletion(t *testing.T) {
+	srv, c, client := newClient(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	key, err := client.Put(ctx, cds.NameKey("User", "foo", nil), &User{Name: "foo"})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	var user User
+	if err := client.Get(ctx, key, &user); err != nil {
+		t.Fatalf("Get failed: %+v", err)
+	}
+
+	c.Set(chaos.OpDeleteMulti, &chaos.Faults{DropRate: 1})
+	if _, err := client.Put(ctx, key, &User{Name: "bar"}); err != nil {
+		t.Fatalf("failed to update: %+v", err)
+	}
+
+	if err := client.Get(ctx, key, &user); err != nil {
+		t.Fatalf("Get failed: %+v", err)
+	}
+	if user.Name != "foo" {
+		t.Errorf("the cache was cleared despite the dropped deletion: %+v", user)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Package codec - This package provides serialization of cached entities.
+Entities are serialized by an EntityCodec and wrapped in a versioned envelope
+that records the codec, the schema version and a checksum.
+...
+このパッケージではキャッシュするエンティティのシリアライズを提供します。
+エンティティはEntityCodecでシリアライズされ、コーデック・スキーマバージョン・チェックサムを記録したエンベロープに包まれます。
+*/
+package codec
+
+import (
+	"sync"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// EntityCodec - Serializes entities for the cache.
+//                 └── キャッシュのためにエンティティをシリアライズする。
+type EntityCodec interface {
+	// ID - Identifier of the codec recorded in the envelope.
+	//        └── エンベロープに記録されるコーデックの識別子。
+	ID() byte
+
+	// Marshal - Serialize entity.
+	//             └── entityをシリアライズする。
+	Marshal(entity *datastore.EntityResult) ([]byte, error)
+
+	// Unmarshal - Deserialize data.
+	//               └── dataをデシリアライズする。
+	Unmarshal(data []byte) (*datastore.EntityResult, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]EntityCodec{}
+)
+
+func init() {
+	Register(Protobuf)
+	Register(JSON)
+}
+
+// Register - Make c available to Open.
+//              └── cをOpenで使えるようにする。
+// Built-in codecs are registered beforehand. Registering the same ID twice replaces the old one.
+//    └── 組み込みのコーデックは登録済み。同じ識別子を2回登録した場合は置き換える。
+func Register(c EntityCodec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[c.ID()] = c
+}
+
+// Lookup - Get the codec registered with id.
+//            └── idで登録されたコーデックを取得する。
+func Lookup(id byte) (EntityCodec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[id]
+	if !ok {
+		return nil, xerrors.Errorf("unknown codec: %d", id)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,115 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+var entity = &datastore.EntityResult{
+	Entity: &datastore.Entity{
+		Key: &datastore.Key{
+			PartitionId: &datastore.PartitionId{
+				ProjectId:   "project-id",
+				NamespaceId: "namespace-id",
+			},
+			Path: []*datastore.Key_PathElement{
+				{
+					Kind:   "kind",
+					IdType: &datastore.Key_PathElement_Id{Id: 10},
+				},
+			},
+		},
+		Properties: map[string]*datastore.Value{
+			"str": {
+				ValueType: &datastore.Value_StringValue{StringValue: "id 10 version 1"},
+			},
+		},
+	},
+	Version: 1,
+}
+
+var ignoreXXX = cmp.FilterPath(func(path cmp.Path) bool {
+	return !strings.HasPrefix(path.Last().String(), "XXX_")
+}, cmp.Ignore())
+
+func TestCodecs_roundTrip(t *testing.T) {
+	for _, c := range []EntityCodec{Protobuf, JSON} {
+		data, err := c.Marshal(entity)
+
+		if err != nil {
+			t.Fatalf("failed to marshal with codec %d: %+v", c.ID(), err)
+		}
+
+		decoded, err := c.Unmarshal(data)
+
+		if err != nil {
+			t.Fatalf("failed to unmarshal with codec %d: %+v", c.ID(), err)
+		}
+
+		if diff := cmp.Diff(entity, decoded, ignoreXXX); diff != "" {
+			t.Errorf("decoded entity with codec %d differed: %s", c.ID(), diff)
+		}
+
+		registered, err := Lookup(c.ID())
+
+		if err != nil || registered != c {
+			t.Errorf("codec %d is not registered: %+v", c.ID(), err)
+		}
+	}
+}
+
+func TestEnvelope_roundTrip(t *testing.T) {
+	envelope := &Envelope{
+		CodecID:       JSON.ID(),
+		SchemaVersion: 3,
+		Payload:       []byte("payload"),
+	}
+
+	sealed := envelope.Seal()
+
+	if !IsEnvelope(sealed) {
+		t.Fatalf("sealed data must start with the magic byte")
+	}
+
+	opened, err := Open(sealed)
+
+	if err != nil {
+		t.Fatalf("failed to open envelope: %+v", err)
+	}
+
+	if opened.CodecID != envelope.CodecID ||
+		opened.SchemaVersion != envelope.SchemaVersion ||
+		!bytes.Equal(opened.Payload, envelope.Payload) {
+		t.Errorf("opened envelope differed: %+v (expected: %+v)", opened, envelope)
+	}
+}
+
+func TestOpen_corrupted(t *testing.T) {
+	sealed := (&Envelope{CodecID: Protobuf.ID(), Payload: []byte("payload")}).Seal()
+	sealed[len(sealed)-1] ^= 0xff
+
+	if _, err := Open(sealed); !xerrors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("corrupted payload must fail with checksum mismatch: %+v", err)
+	}
+
+	if _, err := Open(sealed[:4]); err == nil {
+		t.Errorf("truncated envelope must be an error")
+	}
+}
+
+func TestIsEnvelope_protobuf(t *testing.T) {
+	data, err := Protobuf.Marshal(entity)
+
+	if err != nil {
+		t.Fatalf("failed to marshal: %+v", err)
+	}
+
+	if IsEnvelope(data) {
+		t.Errorf("protobuf must not be detected as an envelope")
+	}
+}
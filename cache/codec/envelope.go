@@ -0,0 +1,108 @@
+package codec
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// Magic - First byte of an envelope.
+	//           └── エンベロープの先頭バイト。
+	// Its wire type (6) is invalid in Protocol Buffers and it is above the compression headers,
+	// so entries written before the envelope was introduced are distinguished.
+	//    └── ワイヤータイプ(6)がProtocol Buffersでは不正であり、圧縮ヘッダとも重ならないため、エンベロープ導入前のエントリと区別できる。
+	Magic byte = 0xfe
+
+	// Version - Version of the envelope layout.
+	//             └── エンベロープのレイアウトのバージョン。
+	Version byte = 1
+)
+
+// ErrChecksumMismatch - The payload does not match the checksum in the envelope.
+//                         └── ペイロードがエンベロープのチェックサムと一致しない。
+var ErrChecksumMismatch = xerrors.New("checksum mismatch")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Envelope - Header and payload of a cached entry.
+//              └── キャッシュエントリのヘッダとペイロード。
+//
+// Layout:
+//   magic(1) | version(1) | codec ID(1) | schema version(varint) | CRC-32C of payload(4) | payload
+type Envelope struct {
+	// CodecID - ID of the EntityCodec that serialized the payload.
+	//             └── ペイロードをシリアライズしたEntityCodecの識別子。
+	CodecID byte
+	// SchemaVersion - Version of the schema the payload was written with.
+	//                   └── ペイロードを書き込んだスキーマのバージョン。
+	SchemaVersion int
+	// Payload - Serialized entity.
+	//             └── シリアライズされたエンティティ。
+	Payload []byte
+}
+
+// IsEnvelope - Report whether data starts with an envelope.
+//                └── dataがエンベロープで始まっているかを返す。
+func IsEnvelope(data []byte) bool {
+	return len(data) > 0 && data[0] == Magic
+}
+
+// Seal - Serialize the envelope.
+//          └── エンベロープをシリアライズする。
+func (e *Envelope) Seal() []byte {
+	buf := make([]byte, 0, 3+binary.MaxVarintLen64+4+len(e.Payload))
+	buf = append(buf, Magic, Version, e.CodecID)
+
+	var varint [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(varint[:], int64(e.SchemaVersion))
+	buf = append(buf, varint[:n]...)
+
+	var checksum [4]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.Checksum(e.Payload, crcTable))
+	buf = append(buf, checksum[:]...)
+
+	return append(buf, e.Payload...)
+}
+
+// Open - Deserialize the envelope and verify its checksum.
+//          └── エンベロープをデシリアライズし、チェックサムを検証する。
+func Open(data []byte) (*Envelope, error) {
+	if !IsEnvelope(data) {
+		return nil, xerrors.New("missing envelope")
+	}
+
+	if len(data) < 3 {
+		return nil, xerrors.New("truncated envelope header")
+	}
+
+	if data[1] != Version {
+		return nil, xerrors.Errorf("unsupported envelope version: %d", data[1])
+	}
+
+	codecID := data[2]
+	data = data[3:]
+
+	schemaVersion, n := binary.Varint(data)
+	if n <= 0 {
+		return nil, xerrors.New("invalid schema version")
+	}
+	data = data[n:]
+
+	if len(data) < 4 {
+		return nil, xerrors.New("truncated checksum")
+	}
+
+	checksum, payload := binary.BigEndian.Uint32(data), data[4:]
+
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return nil, ErrChecksumMismatch
+	}
+
+	return &Envelope{
+		CodecID:       codecID,
+		SchemaVersion: int(schemaVersion),
+		Payload:       payload,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// JSON - Codec that serializes entities with the JSON mapping of Protocol Buffers.
+//          └── Protocol BuffersのJSONマッピングでエンティティをシリアライズするコーデック。
+// It is larger and slower than Protobuf, but the cached entries can be read by humans.
+//    └── Protobufより大きく遅いが、キャッシュの内容を人が読むことができる。
+var JSON EntityCodec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte {
+	return 2
+}
+
+func (jsonCodec) Marshal(entity *datastore.EntityResult) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	if err := new(jsonpb.Marshaler).Marshal(buf, entity); err != nil {
+		return nil, xerrors.Errorf("failed to marshal json: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (jsonCodec) Unmarshal(data []byte) (*datastore.EntityResult, error) {
+	entity := &datastore.EntityResult{}
+
+	if err := jsonpb.Unmarshal(bytes.NewReader(data), entity); err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal json: %w", err)
+	}
+
+	return entity, nil
+}
@@ -0,0 +1,31 @@
+package codec
+
+import (
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// Protobuf - Codec that serializes entities with Protocol Buffers.
+//              └── Protocol Buffersでエンティティをシリアライズするコーデック。
+var Protobuf EntityCodec = protobufCodec{}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ID() byte {
+	return 1
+}
+
+func (protobufCodec) Marshal(entity *datastore.EntityResult) ([]byte, error) {
+	return proto.Marshal(entity)
+}
+
+func (protobufCodec) Unmarshal(data []byte) (*datastore.EntityResult, error) {
+	entity := &datastore.EntityResult{}
+
+	if err := proto.Unmarshal(data, entity); err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+
+	return entity, nil
+}
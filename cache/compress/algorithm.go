@@ -0,0 +1,159 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/xerrors"
+)
+
+// DefaultGzipLevel - Compression level used by the registered gzip algorithm.
+//                      └── 登録済みのgzipで使う圧縮レベル。
+const DefaultGzipLevel = gzip.DefaultCompression
+
+type snappyAlgorithm struct{}
+
+// NewSnappy - Initialize Snappy.
+//               └── Snappyを初期化する。
+func NewSnappy() Algorithm {
+	return snappyAlgorithm{}
+}
+
+func (snappyAlgorithm) Codec() Codec {
+	return CodecSnappy
+}
+
+func (snappyAlgorithm) Compress(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (snappyAlgorithm) Decompress(src []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n > MaxDecompressedSize {
+		return nil, xerrors.Errorf("decompressed size %d exceeds %d bytes", n, MaxDecompressedSize)
+	}
+
+	return snappy.Decode(nil, src)
+}
+
+type zstdAlgorithm struct {
+	// The encoder and the decoder start goroutines, so they are created on the first use
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+// NewZstd - Initialize Zstandard.
+//             └── Zstandardを初期化する。
+// The encoder and the decoder are created when it is used for the first time.
+//    └── エンコーダとデコーダは初めて使われた時に作成する。
+func NewZstd() Algorithm {
+	return &zstdAlgorithm{}
+}
+
+func (a *zstdAlgorithm) init() error {
+	a.once.Do(func() {
+		a.encoder, a.err = zstd.NewWriter(nil)
+
+		if a.err != nil {
+			a.err = xerrors.Errorf("failed to create zstd encoder: %w", a.err)
+			return
+		}
+
+		a.decoder, a.err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+
+		if a.err != nil {
+			a.err = xerrors.Errorf("failed to create zstd decoder: %w", a.err)
+		}
+	})
+
+	return a.err
+}
+
+func (*zstdAlgorithm) Codec() Codec {
+	return CodecZstd
+}
+
+func (a *zstdAlgorithm) Compress(src []byte) ([]byte, error) {
+	if err := a.init(); err != nil {
+		return nil, err
+	}
+
+	return a.encoder.EncodeAll(src, nil), nil
+}
+
+func (a *zstdAlgorithm) Decompress(src []byte) ([]byte, error) {
+	if err := a.init(); err != nil {
+		return nil, err
+	}
+
+	return a.decoder.DecodeAll(src, nil)
+}
+
+type gzipAlgorithm struct {
+	level int
+}
+
+// NewGzip - Initialize gzip with level.
+//             └── 圧縮レベルを指定してgzipを初期化する。
+func NewGzip(level int) Algorithm {
+	return gzipAlgorithm{
+		level: level,
+	}
+}
+
+func (gzipAlgorithm) Codec() Codec {
+	return CodecGzip
+}
+
+func (a gzipAlgorithm) Compress(src []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	w, err := gzip.NewWriterLevel(buf, a.level)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipAlgorithm) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decompressed) > MaxDecompressedSize {
+		return nil, xerrors.Errorf("decompressed size exceeds %d bytes", MaxDecompressedSize)
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,168 @@
+/*
+Package compress - This package provides compression of cached payloads.
+Every compressed payload starts with a one-byte header that records the codec,
+so that entries written with different codecs, or without compression, can be mixed.
+...
+このパッケージではキャッシュするデータの圧縮を提供します。
+圧縮したデータの先頭には圧縮方式を表す1バイトのヘッダを付与するため、異なる圧縮方式や非圧縮のエントリを混在させることができます。
+*/
+package compress
+
+import (
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// Codec - Identifier of a compression algorithm written in the header.
+//           └── ヘッダに書き込まれる圧縮方式の識別子。
+// Protocol Buffers never starts with a byte below 0x08 (field number 0 is invalid),
+// so payloads written before compression was enabled are distinguished from compressed ones.
+//    └── Protocol Buffersは0x08未満のバイトで始まることがない(フィールド番号0は不正)ため、圧縮導入前のデータと区別できる。
+type Codec byte
+
+const (
+	// CodecNone - Stored without compression.
+	//               └── 圧縮せずに保存する。
+	CodecNone Codec = 0
+
+	// CodecSnappy - Compressed with Snappy.
+	//                 └── Snappyで圧縮する。
+	CodecSnappy Codec = 1
+
+	// CodecZstd - Compressed with Zstandard.
+	//               └── Zstandardで圧縮する。
+	CodecZstd Codec = 2
+
+	// CodecGzip - Compressed with gzip.
+	//               └── gzipで圧縮する。
+	CodecGzip Codec = 3
+
+	// MaxCodec - The largest codec that can be written in the header.
+	//              └── ヘッダに書き込むことのできる最大の識別子。
+	MaxCodec Codec = 7
+)
+
+// MaxDecompressedSize - Largest payload the built-in algorithms decompress.
+//                         └── 組み込みのアルゴリズムが展開する最大のデータサイズ。
+// An entity of Datastore is at most 1 MiB, and its encoding with any codec of the cache fits in 4 MiB,
+// so a larger payload is a corrupted entry and is rejected before it is allocated.
+//    └── Datastoreのエンティティは最大1MiBであり、キャッシュのどのコーデックでエンコードしても4MiBに収まる。
+//    └── それより大きいデータは壊れたエントリであり、メモリを確保する前に拒否する。
+const MaxDecompressedSize = 4 << 20
+
+// Algorithm - Compression algorithm.
+//               └── 圧縮アルゴリズム。
+type Algorithm interface {
+	// Codec - Identifier written in the header.
+	//           └── ヘッダに書き込まれる識別子。
+	Codec() Codec
+
+	// Compress - Compress src.
+	//              └── srcを圧縮する。
+	Compress(src []byte) ([]byte, error)
+
+	// Decompress - Decompress src.
+	//                └── srcを展開する。
+	Decompress(src []byte) ([]byte, error)
+}
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[Codec]Algorithm{}
+)
+
+func init() {
+	Register(NewSnappy())
+	Register(NewZstd())
+	Register(NewGzip(DefaultGzipLevel))
+}
+
+// Register - Make alg available to Decompress.
+//              └── algをDecompressで使えるようにする。
+// Built-in algorithms are registered beforehand. Registering the same codec twice replaces the old one.
+//    └── 組み込みのアルゴリズムは登録済み。同じ識別子を2回登録した場合は置き換える。
+func Register(alg Algorithm) {
+	if alg.Codec() == CodecNone || alg.Codec() > MaxCodec {
+		panic(xerrors.Errorf("compress: codec %d is out of range", alg.Codec()))
+	}
+
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+
+	algorithms[alg.Codec()] = alg
+}
+
+// Compressor - Compresses payloads and adds the header.
+//                └── データを圧縮しヘッダを付与する。
+type Compressor struct {
+	// Algorithm - Algorithm used for compression.
+	//               └── 圧縮に使うアルゴリズム。
+	Algorithm Algorithm
+	// Threshold - Payloads smaller than Threshold bytes are stored uncompressed.
+	//               └── Thresholdバイト未満のデータは圧縮せずに保存する。
+	Threshold int
+}
+
+// NewCompressor - Initialize Compressor.
+//                   └── Compressorを初期化する。
+func NewCompressor(alg Algorithm, threshold int) *Compressor {
+	return &Compressor{
+		Algorithm: alg,
+		Threshold: threshold,
+	}
+}
+
+// Compress - Compress src and add the header.
+//              └── srcを圧縮しヘッダを付与する。
+func (c *Compressor) Compress(src []byte) ([]byte, error) {
+	if c.Algorithm == nil || len(src) < c.Threshold {
+		return append([]byte{byte(CodecNone)}, src...), nil
+	}
+
+	compressed, err := c.Algorithm.Compress(src)
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to compress with codec %d: %w", c.Algorithm.Codec(), err)
+	}
+
+	return append([]byte{byte(c.Algorithm.Codec())}, compressed...), nil
+}
+
+// Decompress - Read the header of data and decompress it.
+//                └── dataのヘッダを読み、展開する。
+// data without a header is returned as is.
+//    └── ヘッダの無いデータはそのまま返す。
+func Decompress(data []byte) ([]byte, error) {
+	if !HasHeader(data) {
+		return data, nil
+	}
+
+	codec, body := Codec(data[0]), data[1:]
+
+	if codec == CodecNone {
+		return body, nil
+	}
+
+	algorithmsMu.RLock()
+	alg, ok := algorithms[codec]
+	algorithmsMu.RUnlock()
+
+	if !ok {
+		return nil, xerrors.Errorf("unknown codec: %d", codec)
+	}
+
+	decompressed, err := alg.Decompress(body)
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decompress with codec %d: %w", codec, err)
+	}
+
+	return decompressed, nil
+}
+
+// HasHeader - Report whether data starts with the header.
+//               └── dataがヘッダから始まっているかを返す。
+func HasHeader(data []byte) bool {
+	return len(data) > 0 && Codec(data[0]) <= MaxCodec
+}
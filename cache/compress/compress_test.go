@@ -0,0 +1,100 @@
+package compress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompressor_roundTrip(t *testing.T) {
+	src := []byte(strings.Repeat("compressible text ", 100))
+
+	for _, alg := range []Algorithm{NewSnappy(), NewZstd(), NewGzip(DefaultGzipLevel)} {
+		compressor := NewCompressor(alg, 0)
+
+		compressed, err := compressor.Compress(src)
+
+		if err != nil {
+			t.Fatalf("failed to compress with codec %d: %+v", alg.Codec(), err)
+		}
+
+		if Codec(compressed[0]) != alg.Codec() {
+			t.Errorf("header differed: %d (expected: %d)", compressed[0], alg.Codec())
+		}
+
+		if len(compressed) >= len(src) {
+			t.Errorf("codec %d did not compress: %d bytes (original: %d bytes)", alg.Codec(), len(compressed), len(src))
+		}
+
+		decompressed, err := Decompress(compressed)
+
+		if err != nil {
+			t.Fatalf("failed to decompress with codec %d: %+v", alg.Codec(), err)
+		}
+
+		if !bytes.Equal(src, decompressed) {
+			t.Errorf("decompressed data differed with codec %d", alg.Codec())
+		}
+	}
+}
+
+func TestCompressor_threshold(t *testing.T) {
+	src := []byte("short")
+
+	compressed, err := NewCompressor(NewZstd(), len(src)+1).Compress(src)
+
+	if err != nil {
+		t.Fatalf("failed to compress: %+v", err)
+	}
+
+	if !bytes.Equal(append([]byte{byte(CodecNone)}, src...), compressed) {
+		t.Errorf("payload below threshold was compressed: %v", compressed)
+	}
+
+	decompressed, err := Decompress(compressed)
+
+	if err != nil {
+		t.Fatalf("failed to decompress: %+v", err)
+	}
+
+	if !bytes.Equal(src, decompressed) {
+		t.Errorf("decompressed data differed: %s", decompressed)
+	}
+}
+
+func TestDecompress_withoutHeader(t *testing.T) {
+	// protobuf of EntityResult starts with the tag of the entity field
+	src := []byte{0x0a, 0x02, 0x0a, 0x00}
+
+	decompressed, err := Decompress(src)
+
+	if err != nil {
+		t.Fatalf("failed to decompress: %+v", err)
+	}
+
+	if !bytes.Equal(src, decompressed) {
+		t.Errorf("data without header was modified: %v", decompressed)
+	}
+}
+
+func TestDecompress_unknownCodec(t *testing.T) {
+	if _, err := Decompress([]byte{byte(MaxCodec), 0x00}); err == nil {
+		t.Errorf("unknown codec must be an error")
+	}
+}
+
+func TestDecompress_tooLarge(t *testing.T) {
+	src := make([]byte, MaxDecompressedSize+1)
+
+	for _, alg := range []Algorithm{NewSnappy(), NewZstd(), NewGzip(DefaultGzipLevel)} {
+		compressed, err := NewCompressor(alg, 0).Compress(src)
+
+		if err != nil {
+			t.Fatalf("failed to compress with codec %d: %+v", alg.Codec(), err)
+		}
+
+		if _, err := Decompress(compressed); err == nil {
+			t.Errorf("payload larger than %d bytes must be an error with codec %d", MaxDecompressedSize, alg.Codec())
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// CacheControlHeader - gRPC metadata header that carries CacheControl across services.
+//                        └── サービス間でCacheControlを運ぶgRPCメタデータのヘッダ。
+const CacheControlHeader = "x-datastore-cache"
+
+// CacheControl - Decision of a caller on how its request uses the cache.
+//                  └── リクエストがキャッシュをどう使うかについての呼び出し元の決定。
+// It can only narrow the CachingModeType decided by CachingModeFunc.
+//    └── CachingModeFuncが決めたCachingModeTypeを狭めることのみができる。
+type CacheControl string
+
+const (
+	// CacheControlBypass - Neither read nor write the cache.
+	//                        └── キャッシュの読み取りも書き込みも行わない。
+	CacheControlBypass CacheControl = "bypass"
+
+	// CacheControlReadOnly - Only read the cache.
+	//                          └── キャッシュの読み取りのみを行う。
+	CacheControlReadOnly CacheControl = "readonly"
+
+	// CacheControlWriteOnly - Read fresh entities from Datastore and write them to the cache.
+	//                           └── Datastoreから最新のエンティティを読み、キャッシュに書き込む。
+	CacheControlWriteOnly CacheControl = "writeonly"
+)
+
+type cacheControlKey struct{}
+
+// WithCacheControl - Attach control to ctx and to its outgoing gRPC metadata, so that it also reaches other services.
+//                      └── ctxとその送信gRPCメタデータにcontrolを付与し、他のサービスにも届くようにする。
+func WithCacheControl(ctx context.Context, control CacheControl) context.Context {
+	ctx = context.WithValue(ctx, cacheControlKey{}, control)
+
+	return metadata.AppendToOutgoingContext(ctx, CacheControlHeader, string(control))
+}
+
+// withOutgoingCacheControl - Put the CacheControl attached by WithCacheControl back on the outgoing gRPC metadata.
+//                              └── WithCacheControlで付与されたCacheControlを送信gRPCメタデータに戻す。
+// The Datastore and Firestore clients replace the outgoing metadata with their own,
+// so the header would not reach the server without this.
+//    └── DatastoreやFirestoreのクライアントは送信メタデータを自身のもので置き換えるため、
+//        これが無いとヘッダはサーバーに届かない。
+func withOutgoingCacheControl(ctx context.Context) context.Context {
+	control, ok := ctx.Value(cacheControlKey{}).(CacheControl)
+	if !ok || !control.valid() {
+		return ctx
+	}
+
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		if values := md.Get(CacheControlHeader); len(values) != 0 && values[len(values)-1] == string(control) {
+			return ctx
+		}
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, CacheControlHeader, string(control))
+}
+
+// UnaryServerInterceptor - Copy CacheControlHeader of the incoming request onto the context of the handler.
+//                            └── 受信したリクエストのCacheControlHeaderをハンドラのコンテキストに写す。
+// Datastore calls and gRPC calls to other services made by the handler follow the decision of the caller.
+//    └── ハンドラが行うDatastoreの呼び出しや他のサービスへのgRPCの呼び出しは、呼び出し元の決定に従う。
+func UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if control, ok := lastCacheControl(md.Get(CacheControlHeader)); ok {
+			ctx = WithCacheControl(ctx, control)
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+// cacheControlFrom - CacheControl attached to ctx by WithCacheControl or carried by gRPC metadata.
+//                      └── WithCacheControlでctxに付与された、またはgRPCメタデータで運ばれたCacheControl。
+// The value attached by WithCacheControl comes first,
+// because the Datastore client replaces the outgoing metadata.
+//    └── Datastoreクライアントは送信メタデータを置き換えるため、WithCacheControlで付与された値を優先する。
+func cacheControlFrom(ctx context.Context) (CacheControl, bool) {
+	if control, ok := ctx.Value(cacheControlKey{}).(CacheControl); ok && control.valid() {
+		return control, true
+	}
+
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		if control, ok := lastCacheControl(md.Get(CacheControlHeader)); ok {
+			return control, true
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if control, ok := lastCacheControl(md.Get(CacheControlHeader)); ok {
+			return control, true
+		}
+	}
+
+	return "", false
+}
+
+// lastCacheControl - The last valid CacheControl among values. Unknown values are ignored.
+//                      └── values中の最後の有効なCacheControl。不明な値は無視する。
+func lastCacheControl(values []string) (CacheControl, bool) {
+	for i := len(values) - 1; i >= 0; i-- {
+		if control := CacheControl(values[i]); control.valid() {
+			return control, true
+		}
+	}
+
+	return "", false
+}
+
+func (c CacheControl) valid() bool {
+	_, ok := c.cachingMode()
+
+	return ok
+}
+
+// cachingMode - CachingModeType allowed by c.
+//                 └── cが許可するCachingModeType。
+func (c CacheControl) cachingMode() (CachingModeType, bool) {
+	switch c {
+	case CacheControlBypass:
+		return CachingModeNever, true
+	case CacheControlReadOnly:
+		return CachingModeReadOnly, true
+	case CacheControlWriteOnly:
+		return CachingModeWriteOnly, true
+	default:
+		return CachingModeNever, false
+	}
+}
@@ -0,0 +1,167 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func(ctx context.Context) context.Context
+		served  int
+		fetched int
+		written int
+	}{
+		{
+			name:    "none",
+			ctx:     func(ctx context.Context) context.Context { return ctx },
+			served:  1,
+			fetched: 0,
+			written: 0,
+		},
+		{
+			name: "bypass",
+			ctx: func(ctx context.Context) context.Context {
+				return cache.WithCacheControl(ctx, cache.CacheControlBypass)
+			},
+			served:  0,
+			fetched: 1,
+			written: 0,
+		},
+		{
+			name: "readonly",
+			ctx: func(ctx context.Context) context.Context {
+				return cache.WithCacheControl(ctx, cache.CacheControlReadOnly)
+			},
+			served:  1,
+			fetched: 0,
+			written: 0,
+		},
+		{
+			name: "writeonly",
+			ctx: func(ctx context.Context) context.Context {
+				return cache.WithCacheControl(ctx, cache.CacheControlWriteOnly)
+			},
+			served:  0,
+			fetched: 1,
+			written: 1,
+		},
+		{
+			name: "incoming metadata",
+			ctx: func(ctx context.Context) context.Context {
+				return metadata.NewIncomingContext(ctx, metadata.Pairs(cache.CacheControlHeader, "bypass"))
+			},
+			served:  0,
+			fetched: 1,
+			written: 0,
+		},
+		{
+			name: "unknown value",
+			ctx: func(ctx context.Context) context.Context {
+				return metadata.NewIncomingContext(ctx, metadata.Pairs(cache.CacheControlHeader, "unknown"))
+			},
+			served:  1,
+			fetched: 0,
+			written: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, client, _ := newDstestClients(t)
+			defer srv.Close()
+
+			key := datastore.NameKey("test", "foo", nil)
+			if _, err := client.Put(context.Background(), key, &dstestData{Name: "foo"}); err != nil {
+				t.Fatalf("failed to put: %+v", err)
+			}
+
+			var data dstestData
+			if err := client.Get(context.Background(), key, &data); err != nil {
+				t.Fatalf("failed to get: %+v", err)
+			}
+
+			ctx, stats := cache.WithStats(context.Background())
+			if err := client.Get(tt.ctx(ctx), key, &data); err != nil {
+				t.Fatalf("failed to get: %+v", err)
+			}
+
+			if len(stats.Served()) != tt.served || len(stats.Fetched()) != tt.fetched || len(stats.Written()) != tt.written {
+				t.Errorf("unexpected stats: served %d, fetched %d, written %d",
+					len(stats.Served()), len(stats.Fetched()), len(stats.Written()))
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	srv, client, _ := newDstestClients(t)
+	defer srv.Close()
+
+	key := datastore.NameKey("test", "foo", nil)
+	if _, err := client.Put(context.Background(), key, &dstestData{Name: "foo"}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	ctx, stats := cache.WithStats(context.Background())
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(cache.CacheControlHeader, "bypass"))
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		// The decision travels to the next hop
+		//    └── 決定は次のホップに伝わる
+		md, _ := metadata.FromOutgoingContext(ctx)
+		if values := md.Get(cache.CacheControlHeader); len(values) != 1 || values[0] != "bypass" {
+			t.Errorf("header was not propagated: %v", values)
+		}
+
+		var data dstestData
+		for i := 0; i < 2; i++ {
+			if err := client.Get(ctx, key, &data); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	if _, err := cache.UnaryServerInterceptor(ctx, nil, info, handler); err != nil {
+		t.Fatalf("handler failed: %+v", err)
+	}
+
+	if len(stats.Served()) != 0 || len(stats.Written()) != 0 || srv.Calls("Lookup") != 2 {
+		t.Errorf("cache was used: served %d, written %d, Lookup %d",
+			len(stats.Served()), len(stats.Written()), srv.Calls("Lookup"))
+	}
+}
+
+func TestWithCacheControl_reachesServer(t *testing.T) {
+	srv, client, _ := newDstestClients(t)
+	defer srv.Close()
+
+	key := datastore.NameKey("test", "foo", nil)
+	ctx := cache.WithCacheControl(context.Background(), cache.CacheControlBypass)
+
+	// The Datastore client replaces the outgoing metadata with its own
+	//    └── Datastoreクライアントは送信メタデータを自身のもので置き換える
+	if _, err := client.Put(ctx, key, &dstestData{Name: "foo"}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	var data dstestData
+	if err := client.Get(ctx, key, &data); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+
+	for _, rpc := range []string{"Commit", "Lookup"} {
+		if values := srv.Metadata(rpc).Get(cache.CacheControlHeader); len(values) != 1 || values[0] != "bypass" {
+			t.Errorf("header did not reach %s: %v", rpc, values)
+		}
+	}
+}
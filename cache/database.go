@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// withDatabase - Copy keys without a database to put them in the database of the request.
+//                  └── データベースを持たないキーをコピーし、リクエストのデータベースに入れる。
+// Keys in the default database, whose ID is empty, are returned as they are.
+// Otherwise entities in two databases of a project would collide in the cache.
+//    └── IDが空のデフォルトのデータベースのキーはそのまま返す。
+//    └── そうしなければ、プロジェクトの二つのデータベースのエンティティがキャッシュで衝突する。
+func withDatabase(databaseID string, keys []*datastore.Key) []*datastore.Key {
+	if databaseID == "" {
+		return keys
+	}
+
+	completed := make([]*datastore.Key, len(keys))
+	for i, key := range keys {
+		if key.GetPartitionId().GetDatabaseId() == "" {
+			key = proto.Clone(key).(*datastore.Key)
+			setDatabase(databaseID, key)
+		}
+		completed[i] = key
+	}
+
+	return completed
+}
+
+// setDatabase - Put key in the database if it has none.
+//                 └── keyがデータベースを持たない場合、データベースに入れる。
+func setDatabase(databaseID string, key *datastore.Key) {
+	if databaseID == "" || key == nil {
+		return
+	}
+
+	if key.PartitionId == nil {
+		key.PartitionId = &datastore.PartitionId{}
+	}
+	if key.PartitionId.DatabaseId == "" {
+		key.PartitionId.DatabaseId = databaseID
+	}
+}
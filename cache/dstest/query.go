@@ -0,0 +1,447 @@
+package dstest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// keyProperty - Name of the pseudo property that refers to the key.
+//                 └── キーを参照する疑似プロパティの名前。
+const keyProperty = "__key__"
+
+// RunQuery - Run a query.
+//              └── クエリを実行する。
+// Filters on properties and __key__, orders, projections, offsets, limits and cursors are supported.
+// GQL queries are not supported.
+//    └── プロパティと__key__に対するフィルタ、並び順、射影、オフセット、件数制限とカーソルに対応する。GQLには対応しない。
+func (s *Server) RunQuery(_ context.Context, req *datastore.RunQueryRequest) (*datastore.RunQueryResponse, error) {
+	query := req.GetQuery()
+	if query == nil {
+		return nil, status.Error(codes.Unimplemented, "GQL queries are not supported")
+	}
+	if len(query.Kind) > 1 {
+		return nil, status.Error(codes.InvalidArgument, "only a single kind is supported")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkTransaction(req.GetReadOptions().GetTransaction()); err != nil {
+		return nil, err
+	}
+
+	results, err := s.match(keyenc.Project(req.ProjectId, req.DatabaseId), req.GetPartitionId().GetNamespaceId(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	sortResults(results, query.Order)
+
+	start, err := decodeCursor(query.StartCursor)
+	if err != nil {
+		return nil, err
+	}
+	if start > len(results) {
+		start = len(results)
+	}
+
+	skipped := int(query.Offset)
+	if skipped > len(results)-start {
+		skipped = len(results) - start
+	}
+	start += skipped
+
+	end := len(results)
+	moreResults := datastore.QueryResultBatch_NO_MORE_RESULTS
+	if query.Limit != nil && int(query.Limit.Value) < end-start {
+		end = start + int(query.Limit.Value)
+		moreResults = datastore.QueryResultBatch_MORE_RESULTS_AFTER_LIMIT
+	}
+
+	resultType := datastore.EntityResult_FULL
+	if len(query.Projection) > 0 {
+		resultType = datastore.EntityResult_PROJECTION
+		if len(query.Projection) == 1 && query.Projection[0].GetProperty().GetName() == keyProperty {
+			resultType = datastore.EntityResult_KEY_ONLY
+		}
+	}
+
+	batch := &datastore.QueryResultBatch{
+		SkippedResults:   int32(skipped),
+		SkippedCursor:    encodeCursor(start),
+		EntityResultType: resultType,
+		EntityResults:    make([]*datastore.EntityResult, 0, end-start),
+		EndCursor:        encodeCursor(end),
+		MoreResults:      moreResults,
+		SnapshotVersion:  s.version,
+	}
+
+	for i := start; i < end; i++ {
+		batch.EntityResults = append(batch.EntityResults, &datastore.EntityResult{
+			Entity:  project(results[i].entity, query.Projection, resultType),
+			Version: results[i].version,
+			Cursor:  encodeCursor(i + 1),
+		})
+	}
+
+	return &datastore.RunQueryResponse{Batch: batch, Query: query}, nil
+}
+
+// RunAggregationQuery - Aggregation queries are not supported.
+//                        └── 集計クエリには対応しない。
+func (s *Server) RunAggregationQuery(
+	context.Context,
+	*datastore.RunAggregationQueryRequest,
+) (*datastore.RunAggregationQueryResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "aggregation queries are not supported")
+}
+
+// match - Collect the entities matched by the kind and the filter of query.
+//           └── queryのkindとフィルタに一致するエンティティを集める。
+// projectID includes the database as keyenc.Project does.
+//    └── projectIDはkeyenc.Projectと同様にデータベースを含む。
+func (s *Server) match(projectID, namespaceID string, query *datastore.Query) ([]*entry, error) {
+	prefix := keyenc.PartitionPrefix(projectID, namespaceID)
+
+	var results []*entry
+	for encoded, e := range s.entities {
+		if !strings.HasPrefix(encoded, prefix) {
+			continue
+		}
+
+		if len(query.Kind) == 1 {
+			if kind, _ := keyenc.Kind(encoded); kind != query.Kind[0].Name {
+				continue
+			}
+		}
+
+		ok, err := matchFilter(e.entity, query.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			results = append(results, e)
+		}
+	}
+
+	return results, nil
+}
+
+// matchFilter - Whether entity satisfies filter.
+//                 └── entityがfilterを満たすかどうか。
+func matchFilter(entity *datastore.Entity, filter *datastore.Filter) (bool, error) {
+	if filter == nil {
+		return true, nil
+	}
+
+	switch f := filter.FilterType.(type) {
+	case *datastore.Filter_CompositeFilter:
+		if f.CompositeFilter.Op != datastore.CompositeFilter_AND {
+			return false, status.Errorf(codes.InvalidArgument, "unsupported composite operator: %v", f.CompositeFilter.Op)
+		}
+		for _, sub := range f.CompositeFilter.Filters {
+			ok, err := matchFilter(entity, sub)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case *datastore.Filter_PropertyFilter:
+		return matchPropertyFilter(entity, f.PropertyFilter)
+	default:
+		return false, status.Errorf(codes.InvalidArgument, "unsupported filter: %v", filter)
+	}
+}
+
+// matchPropertyFilter - Whether entity satisfies filter on a property.
+//                         └── entityがプロパティのfilterを満たすかどうか。
+// A filter on an array property is satisfied if any of its values satisfies it.
+//    └── 配列のプロパティに対するフィルタは、いずれかの値が満たせば満たされる。
+func matchPropertyFilter(entity *datastore.Entity, filter *datastore.PropertyFilter) (bool, error) {
+	name := filter.GetProperty().GetName()
+
+	if filter.Op == datastore.PropertyFilter_HAS_ANCESTOR {
+		ancestor := filter.GetValue().GetKeyValue()
+		if name != keyProperty || ancestor == nil {
+			return false, status.Error(codes.InvalidArgument, "HAS_ANCESTOR requires a key on __key__")
+		}
+		return isAncestor(ancestor, entity.Key), nil
+	}
+
+	for _, v := range propertyValues(entity, name) {
+		c := compareValues(v, filter.Value)
+
+		var ok bool
+		switch filter.Op {
+		case datastore.PropertyFilter_EQUAL:
+			ok = c == 0
+		case datastore.PropertyFilter_LESS_THAN:
+			ok = c < 0
+		case datastore.PropertyFilter_LESS_THAN_OR_EQUAL:
+			ok = c <= 0
+		case datastore.PropertyFilter_GREATER_THAN:
+			ok = c > 0
+		case datastore.PropertyFilter_GREATER_THAN_OR_EQUAL:
+			ok = c >= 0
+		default:
+			return false, status.Errorf(codes.InvalidArgument, "unsupported operator: %v", filter.Op)
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// propertyValues - Values of the property name of entity, expanding arrays.
+//                    └── entityのプロパティnameの値。配列は展開する。
+func propertyValues(entity *datastore.Entity, name string) []*datastore.Value {
+	if name == keyProperty {
+		return []*datastore.Value{{ValueType: &datastore.Value_KeyValue{KeyValue: entity.Key}}}
+	}
+
+	v, ok := entity.Properties[name]
+	if !ok {
+		return nil
+	}
+
+	if array := v.GetArrayValue(); array != nil {
+		return array.Values
+	}
+
+	return []*datastore.Value{v}
+}
+
+// isAncestor - Whether ancestor is key itself or one of its ancestors.
+//                └── ancestorがkey自身、またはその祖先かどうか。
+func isAncestor(ancestor, key *datastore.Key) bool {
+	if ancestor.GetPartitionId().GetNamespaceId() != key.GetPartitionId().GetNamespaceId() {
+		return false
+	}
+	if len(ancestor.Path) > len(key.Path) {
+		return false
+	}
+
+	for i := range ancestor.Path {
+		if !proto.Equal(ancestor.Path[i], key.Path[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortResults - Sort results by orders, and then by key.
+//                 └── resultsをordersの順に並べ、その後キーの順に並べる。
+func sortResults(results []*entry, orders []*datastore.PropertyOrder) {
+	sort.SliceStable(results, func(i, j int) bool {
+		for _, o := range orders {
+			name := o.GetProperty().GetName()
+			c := compareValues(firstValue(results[i].entity, name), firstValue(results[j].entity, name))
+
+			if o.Direction == datastore.PropertyOrder_DESCENDING {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return compareKeys(results[i].entity.Key, results[j].entity.Key) < 0
+	})
+}
+
+// firstValue - The first value of the property name of entity, or nil.
+//                └── entityのプロパティnameの最初の値。無い場合はnil。
+func firstValue(entity *datastore.Entity, name string) *datastore.Value {
+	values := propertyValues(entity, name)
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// valueRank - Order of value types, following the order of Datastore.
+//               └── Datastoreの順序に従った値の型の順序。
+func valueRank(v *datastore.Value) int {
+	switch v.GetValueType().(type) {
+	case nil, *datastore.Value_NullValue:
+		return 0
+	case *datastore.Value_IntegerValue, *datastore.Value_DoubleValue:
+		return 1
+	case *datastore.Value_TimestampValue:
+		return 2
+	case *datastore.Value_BooleanValue:
+		return 3
+	case *datastore.Value_StringValue, *datastore.Value_BlobValue:
+		return 4
+	case *datastore.Value_KeyValue:
+		return 5
+	case *datastore.Value_GeoPointValue:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// compareValues - Compare a and b, returning a negative number, zero or a positive number.
+//                   └── aとbを比較し、負の数、0または正の数を返す。
+func compareValues(a, b *datastore.Value) int {
+	if ra, rb := valueRank(a), valueRank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.GetValueType().(type) {
+	case *datastore.Value_IntegerValue, *datastore.Value_DoubleValue:
+		return compareFloats(number(a), number(b))
+	case *datastore.Value_TimestampValue:
+		at, bt := av.TimestampValue, b.GetTimestampValue()
+		if at.GetSeconds() != bt.GetSeconds() {
+			return compareFloats(float64(at.GetSeconds()), float64(bt.GetSeconds()))
+		}
+		return int(at.GetNanos() - bt.GetNanos())
+	case *datastore.Value_BooleanValue:
+		if av.BooleanValue == b.GetBooleanValue() {
+			return 0
+		}
+		if av.BooleanValue {
+			return 1
+		}
+		return -1
+	case *datastore.Value_StringValue:
+		return bytes.Compare([]byte(av.StringValue), bytesOf(b))
+	case *datastore.Value_BlobValue:
+		return bytes.Compare(av.BlobValue, bytesOf(b))
+	case *datastore.Value_KeyValue:
+		return compareKeys(av.KeyValue, b.GetKeyValue())
+	case *datastore.Value_GeoPointValue:
+		ag, bg := av.GeoPointValue, b.GetGeoPointValue()
+		if c := compareFloats(ag.GetLatitude(), bg.GetLatitude()); c != 0 {
+			return c
+		}
+		return compareFloats(ag.GetLongitude(), bg.GetLongitude())
+	default:
+		return 0
+	}
+}
+
+func number(v *datastore.Value) float64 {
+	if i, ok := v.ValueType.(*datastore.Value_IntegerValue); ok {
+		return float64(i.IntegerValue)
+	}
+	return v.GetDoubleValue()
+}
+
+func bytesOf(v *datastore.Value) []byte {
+	if s, ok := v.ValueType.(*datastore.Value_StringValue); ok {
+		return []byte(s.StringValue)
+	}
+	return v.GetBlobValue()
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b || (math.IsNaN(a) && !math.IsNaN(b)):
+		return -1
+	case a > b || (!math.IsNaN(a) && math.IsNaN(b)):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareKeys - Compare keys element by element. IDs sort before names.
+//                 └── キーを要素ごとに比較する。IDは名前より前に並ぶ。
+func compareKeys(a, b *datastore.Key) int {
+	for i := 0; i < len(a.GetPath()) && i < len(b.GetPath()); i++ {
+		ea, eb := a.Path[i], b.Path[i]
+
+		if c := strings.Compare(ea.Kind, eb.Kind); c != 0 {
+			return c
+		}
+
+		_, aIsName := ea.IdType.(*datastore.Key_PathElement_Name)
+		_, bIsName := eb.IdType.(*datastore.Key_PathElement_Name)
+
+		switch {
+		case aIsName != bIsName && aIsName:
+			return 1
+		case aIsName != bIsName:
+			return -1
+		case aIsName:
+			if c := strings.Compare(ea.GetName(), eb.GetName()); c != 0 {
+				return c
+			}
+		case ea.GetId() != eb.GetId():
+			if ea.GetId() < eb.GetId() {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return len(a.GetPath()) - len(b.GetPath())
+}
+
+// project - Copy entity with only the properties in projection.
+//             └── projectionのプロパティのみを持つentityのコピーを作成する。
+func project(
+	entity *datastore.Entity,
+	projection []*datastore.Projection,
+	resultType datastore.EntityResult_ResultType,
+) *datastore.Entity {
+	if resultType == datastore.EntityResult_FULL {
+		return proto.Clone(entity).(*datastore.Entity)
+	}
+
+	projected := &datastore.Entity{
+		Key: proto.Clone(entity.Key).(*datastore.Key),
+	}
+	if resultType == datastore.EntityResult_KEY_ONLY {
+		return projected
+	}
+
+	projected.Properties = make(map[string]*datastore.Value, len(projection))
+	for _, p := range projection {
+		name := p.GetProperty().GetName()
+		if v := firstValue(entity, name); v != nil && name != keyProperty {
+			projected.Properties[name] = proto.Clone(v).(*datastore.Value)
+		}
+	}
+
+	return projected
+}
+
+// encodeCursor - Encode the offset in the sorted results as a cursor.
+//                  └── 並べ替えた結果の中の位置をカーソルとしてエンコードする。
+func encodeCursor(offset int) []byte {
+	cursor := make([]byte, 8)
+	binary.BigEndian.PutUint64(cursor, uint64(offset))
+
+	return cursor
+}
+
+// decodeCursor - Decode a cursor encoded by encodeCursor. An empty cursor is the beginning.
+//                  └── encodeCursorでエンコードしたカーソルをデコードする。空のカーソルは先頭を表す。
+func decodeCursor(cursor []byte) (int, error) {
+	if len(cursor) == 0 {
+		return 0, nil
+	}
+	if len(cursor) != 8 {
+		return 0, status.Error(codes.InvalidArgument, "invalid cursor")
+	}
+
+	return int(binary.BigEndian.Uint64(cursor)), nil
+}
@@ -0,0 +1,418 @@
+/*
+Package dstest - This package provides an in-memory Datastore gRPC server for hermetic tests.
+...
+このパッケージではテスト用のインメモリのDatastore gRPCサーバーを提供します。
+
+The server listens on bufconn, so a real datastore.Client can be used without the emulator.
+    └── サーバーはbufconnで待ち受けるため、エミュレータ無しで実際のdatastore.Clientを使うことができる。
+
+	srv := dstest.NewServer()
+	defer srv.Close()
+
+	conn, _ := srv.Dial(grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	client, _ := datastore.NewClient(ctx, "project-id", option.WithGRPCConn(conn))
+*/
+package dstest
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"path"
+	"sync"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// bufferSize - Size of the buffer of bufconn.
+//                └── bufconnのバッファのサイズ。
+const bufferSize = 1024 * 1024
+
+// entry - An entity stored in Server.
+//           └── Serverに保存されたエンティティ。
+type entry struct {
+	entity  *datastore.Entity
+	version int64
+}
+
+// Server - In-memory implementation of google.datastore.v1.Datastore.
+//            └── google.datastore.v1.Datastoreのインメモリ実装。
+// Every commit increments the version of the server, and written entities get that version as Datastore does.
+//    └── コミットごとにサーバーのバージョンが増加し、書き込まれたエンティティはDatastoreと同じくそのバージョンを持つ。
+// Transactions are accepted but not isolated.
+//    └── トランザクションは受け付けるが、分離はされない。
+type Server struct {
+	mu           sync.Mutex
+	entities     map[string]*entry
+	transactions map[string]bool
+	version      int64
+	lastID       int64
+	calls        map[string]int
+	incoming     map[string]metadata.MD
+
+	listener *bufconn.Listener
+	server   *grpc.Server
+}
+
+var _ datastore.DatastoreServer = &Server{}
+
+// NewServer - Initialize Server and start serving on bufconn.
+//               └── Serverを初期化し、bufconnで待ち受けを開始する。
+func NewServer() *Server {
+	s := &Server{
+		entities:     map[string]*entry{},
+		transactions: map[string]bool{},
+		version:      1,
+		calls:        map[string]int{},
+		incoming:     map[string]metadata.MD{},
+		listener:     bufconn.Listen(bufferSize),
+	}
+
+	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.countCalls))
+	datastore.RegisterDatastoreServer(s.server, s)
+
+	go func() {
+		// Serve returns an error after Close, which is not interesting in tests
+		_ = s.server.Serve(s.listener)
+	}()
+
+	return s
+}
+
+// Dial - Connect to Server. opts are appended to the options to dial bufconn.
+//          └── Serverに接続する。optsはbufconnに接続するオプションの後に追加される。
+func (s *Server) Dial(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return s.listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+
+	conn, err := grpc.Dial("bufnet", opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to dial bufconn: %w", err)
+	}
+
+	return conn, nil
+}
+
+// Close - Stop Server.
+//           └── Serverを停止する。
+func (s *Server) Close() {
+	s.server.Stop()
+}
+
+// Calls - Number of calls of the RPC such as "Lookup" and "Commit".
+//           └── "Lookup"や"Commit"などのRPCが呼ばれた回数。
+func (s *Server) Calls(rpc string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[rpc]
+}
+
+// Metadata - Incoming gRPC metadata of the last call of the RPC, which shows the headers that reached the server.
+//              └── RPCの最後の呼び出しの受信gRPCメタデータ。サーバーに届いたヘッダを示す。
+func (s *Server) Metadata(rpc string) metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.incoming[rpc].Copy()
+}
+
+// Reset - Remove all entities and transactions, and reset the counters of Calls.
+//           └── 全てのエンティティとトランザクションを削除し、Callsのカウンタをリセットする。
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entities = map[string]*entry{}
+	s.transactions = map[string]bool{}
+	s.calls = map[string]int{}
+	s.incoming = map[string]metadata.MD{}
+}
+
+func (s *Server) countCalls(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	s.mu.Lock()
+	s.calls[path.Base(info.FullMethod)]++
+	s.incoming[path.Base(info.FullMethod)] = md
+	s.mu.Unlock()
+
+	return handler(ctx, req)
+}
+
+// Lookup - Look up entities by key.
+//            └── キーでエンティティを取得する。
+func (s *Server) Lookup(_ context.Context, req *datastore.LookupRequest) (*datastore.LookupResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkTransaction(req.GetReadOptions().GetTransaction()); err != nil {
+		return nil, err
+	}
+
+	res := new(datastore.LookupResponse)
+	for _, key := range req.Keys {
+		encoded := keyenc.Encode(req.ProjectId, withPartition(req.ProjectId, req.DatabaseId, key))
+		if encoded == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "incomplete key: %v", key)
+		}
+
+		if e, ok := s.entities[encoded]; ok {
+			res.Found = append(res.Found, &datastore.EntityResult{
+				Entity:  proto.Clone(e.entity).(*datastore.Entity),
+				Version: e.version,
+			})
+			continue
+		}
+
+		res.Missing = append(res.Missing, &datastore.EntityResult{
+			Entity:  &datastore.Entity{Key: key},
+			Version: s.version,
+		})
+	}
+
+	return res, nil
+}
+
+// BeginTransaction - Begin a new transaction.
+//                      └── 新しいトランザクションを開始する。
+func (s *Server) BeginTransaction(
+	context.Context,
+	*datastore.BeginTransactionRequest,
+) (*datastore.BeginTransactionResponse, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate transaction ID: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transactions[string(id)] = true
+
+	return &datastore.BeginTransactionResponse{Transaction: id}, nil
+}
+
+// Rollback - Roll back a transaction.
+//              └── トランザクションをロールバックする。
+func (s *Server) Rollback(_ context.Context, req *datastore.RollbackRequest) (*datastore.RollbackResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkTransaction(req.Transaction); err != nil {
+		return nil, err
+	}
+	delete(s.transactions, string(req.Transaction))
+
+	return new(datastore.RollbackResponse), nil
+}
+
+// Commit - Apply mutations atomically.
+//            └── ミューテーションをアトミックに適用する。
+func (s *Server) Commit(_ context.Context, req *datastore.CommitRequest) (*datastore.CommitResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.Mode == datastore.CommitRequest_TRANSACTIONAL {
+		if err := s.checkTransaction(req.GetTransaction()); err != nil {
+			return nil, err
+		}
+		delete(s.transactions, string(req.GetTransaction()))
+	}
+
+	// apply the mutations to a copy so that nothing is written on errors
+	entities := make(map[string]*entry, len(s.entities))
+	for k, v := range s.entities {
+		entities[k] = v
+	}
+
+	version := s.version + 1
+	res := &datastore.CommitResponse{
+		MutationResults: make([]*datastore.MutationResult, 0, len(req.Mutations)),
+	}
+
+	for _, m := range req.Mutations {
+		result, err := s.mutate(entities, req.ProjectId, req.DatabaseId, m, version)
+		if err != nil {
+			return nil, err
+		}
+		res.MutationResults = append(res.MutationResults, result)
+	}
+
+	s.entities = entities
+	s.version = version
+
+	return res, nil
+}
+
+// mutate - Apply a mutation to entities.
+//            └── entitiesにミューテーションを適用する。
+func (s *Server) mutate(
+	entities map[string]*entry,
+	projectID, databaseID string,
+	m *datastore.Mutation,
+	version int64,
+) (*datastore.MutationResult, error) {
+	var entity *datastore.Entity
+	key := m.GetDelete()
+
+	switch op := m.Operation.(type) {
+	case *datastore.Mutation_Insert:
+		entity = op.Insert
+	case *datastore.Mutation_Update:
+		entity = op.Update
+	case *datastore.Mutation_Upsert:
+		entity = op.Upsert
+	case *datastore.Mutation_Delete:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown mutation: %v", m)
+	}
+
+	result := &datastore.MutationResult{Version: version}
+
+	if entity != nil {
+		entity = proto.Clone(entity).(*datastore.Entity)
+		key = entity.Key
+
+		if keyenc.Encode(projectID, key) == "" && m.GetUpdate() == nil {
+			key = s.allocate(projectID, databaseID, key)
+			result.Key = key
+		}
+
+		// keys are returned with the partition as Datastore does
+		key = withPartition(projectID, databaseID, key)
+		entity.Key = key
+	}
+
+	var encoded string
+	if key != nil {
+		encoded = keyenc.Encode(projectID, withPartition(projectID, databaseID, key))
+	}
+	if encoded == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "incomplete key: %v", key)
+	}
+
+	current, exists := entities[encoded]
+
+	if base, ok := m.GetConflictDetectionStrategy().(*datastore.Mutation_BaseVersion); ok {
+		var currentVersion int64
+		if exists {
+			currentVersion = current.version
+		}
+		if base.BaseVersion != currentVersion {
+			return nil, status.Errorf(codes.Aborted, "conflict at %s: base version %d", encoded, base.BaseVersion)
+		}
+	}
+
+	switch {
+	case m.GetInsert() != nil && exists:
+		return nil, status.Errorf(codes.AlreadyExists, "entity already exists: %s", encoded)
+	case m.GetUpdate() != nil && !exists:
+		return nil, status.Errorf(codes.NotFound, "no entity to update: %s", encoded)
+	}
+
+	if entity == nil {
+		delete(entities, encoded)
+		return result, nil
+	}
+
+	entities[encoded] = &entry{entity: entity, version: version}
+
+	return result, nil
+}
+
+// AllocateIds - Allocate IDs for incomplete keys.
+//                 └── 不完全なキーにIDを割り当てる。
+func (s *Server) AllocateIds(
+	_ context.Context,
+	req *datastore.AllocateIdsRequest,
+) (*datastore.AllocateIdsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := &datastore.AllocateIdsResponse{Keys: make([]*datastore.Key, 0, len(req.Keys))}
+	for _, key := range req.Keys {
+		res.Keys = append(res.Keys, s.allocate(req.ProjectId, req.DatabaseId, key))
+	}
+
+	return res, nil
+}
+
+// ReserveIds - Prevent IDs of keys from being allocated.
+//                └── keysのIDが割り当てられないようにする。
+func (s *Server) ReserveIds(
+	_ context.Context,
+	req *datastore.ReserveIdsRequest,
+) (*datastore.ReserveIdsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range req.Keys {
+		if len(key.GetPath()) == 0 {
+			continue
+		}
+		if id := key.Path[len(key.Path)-1].GetId(); id > s.lastID {
+			s.lastID = id
+		}
+	}
+
+	return new(datastore.ReserveIdsResponse), nil
+}
+
+// allocate - Complete key with a new ID.
+//              └── 新しいIDでkeyを完全なキーにする。
+func (s *Server) allocate(projectID, databaseID string, key *datastore.Key) *datastore.Key {
+	key = withPartition(projectID, databaseID, key)
+
+	if len(key.Path) > 0 {
+		s.lastID++
+		key.Path[len(key.Path)-1].IdType = &datastore.Key_PathElement_Id{Id: s.lastID}
+	}
+
+	return key
+}
+
+// withPartition - Copy key and fill its project and database with those of the request if empty.
+//                   └── keyをコピーし、プロジェクトとデータベースが空の場合はリクエストのもので埋める。
+func withPartition(projectID, databaseID string, key *datastore.Key) *datastore.Key {
+	key = proto.Clone(key).(*datastore.Key)
+
+	if key.PartitionId == nil {
+		key.PartitionId = &datastore.PartitionId{}
+	}
+	if key.PartitionId.ProjectId == "" {
+		key.PartitionId.ProjectId = projectID
+	}
+	if key.PartitionId.DatabaseId == "" {
+		key.PartitionId.DatabaseId = databaseID
+	}
+
+	return key
+}
+
+// checkTransaction - Return an error if transaction is not nil and has not been begun.
+//                      └── transactionがnilでなく、開始されていない場合はエラーを返す。
+func (s *Server) checkTransaction(transaction []byte) error {
+	if transaction == nil || s.transactions[string(transaction)] {
+		return nil
+	}
+	return status.Error(codes.InvalidArgument, "invalid transaction")
+}
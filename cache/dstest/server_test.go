@@ -0,0 +1,201 @@
+package dstest_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache/dstest"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+const (
+	projectID = "project-id"
+)
+
+type User struct {
+	Name string
+	Age  int
+}
+
+func newClient(t *testing.T) (*dstest.Server, *datastore.Client) {
+	t.Helper()
+
+	srv := dstest.NewServer()
+
+	conn, err := srv.Dial()
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	client, err := datastore.NewClient(context.Background(), projectID, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("failed to initialize datastore client: %+v", err)
+	}
+
+	return srv, client
+}
+
+func TestServer_PutGetDelete(t *testing.T) {
+	srv, client := newClient(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	key, err := client.Put(ctx, datastore.IncompleteKey("User", nil), &User{Name: "foo", Age: 20})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if key.Incomplete() {
+		t.Fatalf("ID was not allocated: %v", key)
+	}
+
+	var user User
+	if err := client.Get(ctx, key, &user); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+	if user.Name != "foo" || user.Age != 20 {
+		t.Errorf("retrieved entity differed: %+v", user)
+	}
+
+	if _, err := client.Mutate(ctx, datastore.NewInsert(key, &user)); err == nil {
+		t.Errorf("insert of an existing entity must fail")
+	}
+
+	if err := client.Delete(ctx, key); err != nil {
+		t.Fatalf("failed to delete: %+v", err)
+	}
+
+	if err := client.Get(ctx, key, &user); err != datastore.ErrNoSuchEntity {
+		t.Errorf("deleted entity was returned: %+v", err)
+	}
+
+	if _, err := client.Mutate(ctx, datastore.NewUpdate(key, &user)); err == nil {
+		t.Errorf("update of a missing entity must fail")
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 2 {
+		t.Errorf("Lookup was called %d times", calls)
+	}
+}
+
+func TestServer_RunQuery(t *testing.T) {
+	srv, client := newClient(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	parent := datastore.NameKey("Group", "g", nil)
+	users := []*User{
+		{Name: "a", Age: 30},
+		{Name: "b", Age: 10},
+		{Name: "c", Age: 20},
+		{Name: "d", Age: 40},
+	}
+	keys := []*datastore.Key{
+		datastore.IDKey("User", 1, parent),
+		datastore.IDKey("User", 2, parent),
+		datastore.IDKey("User", 3, parent),
+		datastore.IDKey("User", 4, nil),
+	}
+
+	if _, err := client.PutMulti(ctx, keys, users); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	var found []*User
+	q := datastore.NewQuery("User").Ancestor(parent).Filter("Age >=", 20).Order("-Age")
+	if _, err := client.GetAll(ctx, q, &found); err != nil {
+		t.Fatalf("failed to query: %+v", err)
+	}
+	if len(found) != 2 || found[0].Name != "a" || found[1].Name != "c" {
+		t.Errorf("query returned wrong entities: %+v", found)
+	}
+
+	q = datastore.NewQuery("User").KeysOnly().Order("Age").Offset(1).Limit(2)
+	found = nil
+	foundKeys, err := client.GetAll(ctx, q, &found)
+	if err != nil {
+		t.Fatalf("failed to query: %+v", err)
+	}
+	if len(foundKeys) != 2 || foundKeys[0].ID != 3 || foundKeys[1].ID != 1 {
+		t.Errorf("query returned wrong keys: %v", foundKeys)
+	}
+
+	// page through the results with cursors
+	var names []string
+	var cursor datastore.Cursor
+	for {
+		q = datastore.NewQuery("User").Order("Name").Limit(3)
+		if cursor.String() != "" {
+			q = q.Start(cursor)
+		}
+
+		it := client.Run(ctx, q)
+		n := 0
+		for {
+			var user User
+			if _, err := it.Next(&user); err == iterator.Done {
+				break
+			} else if err != nil {
+				t.Fatalf("failed to iterate: %+v", err)
+			}
+			names = append(names, user.Name)
+			n++
+		}
+
+		if n == 0 {
+			break
+		}
+		if cursor, err = it.Cursor(); err != nil {
+			t.Fatalf("failed to get cursor: %+v", err)
+		}
+	}
+	if len(names) != 4 || names[0] != "a" || names[3] != "d" {
+		t.Errorf("paged results differed: %v", names)
+	}
+}
+
+func TestServer_Transaction(t *testing.T) {
+	srv, client := newClient(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	key := datastore.NameKey("User", "foo", nil)
+
+	_, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var user User
+		if err := tx.Get(key, &user); err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		_, err := tx.Put(key, &User{Name: "foo"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %+v", err)
+	}
+
+	tx, err := client.NewTransaction(ctx)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %+v", err)
+	}
+	if _, err := tx.Put(key, &User{Name: "bar"}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %+v", err)
+	}
+
+	var user User
+	if err := client.Get(ctx, key, &user); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+	if user.Name != "foo" {
+		t.Errorf("rolled back mutation was applied: %+v", user)
+	}
+
+	if srv.Calls("BeginTransaction") != 2 || srv.Calls("Rollback") != 1 {
+		t.Errorf("transactions were not used: %d, %d", srv.Calls("BeginTransaction"), srv.Calls("Rollback"))
+	}
+}
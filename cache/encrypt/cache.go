@@ -0,0 +1,220 @@
+package encrypt
+
+import (
+	"context"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// PropertyName - Name of the property that holds the encrypted entity in the wrapped Cache.
+//                  └── ラップしたCacheで暗号化したエンティティを保持するプロパティの名前。
+const PropertyName = "__encrypted__"
+
+// Cache - Cache that encrypts entities before passing them to another Cache.
+//           └── エンティティを暗号化してから別のCacheに渡すCache。
+// Keys and versions are left as they are, so it works with any backend.
+// The properties are replaced with a single encrypted property bound to the key of the entity.
+// An entry copied to another key in the backend is never decrypted as the entity of that key.
+//    └── キーとバージョンはそのままなので、任意のバックエンドで動作する。
+//    └── プロパティはエンティティのキーに紐付けて暗号化された1つのプロパティに置き換えられる。
+//    └── バックエンドで別のキーにコピーされたエントリは、そのキーのエンティティとして復号されることはない。
+type Cache struct {
+	cache   cache.Cache
+	keyring *Keyring
+}
+
+var (
+	_ cache.Cache = &Cache{}
+	_ cache.Sizer = &Cache{}
+)
+
+// NewCache - Initialize Cache that wraps c.
+//              └── cをラップするCacheを初期化する。
+func NewCache(c cache.Cache, keyring *Keyring) *Cache {
+	return &Cache{
+		cache:   c,
+		keyring: keyring,
+	}
+}
+
+// GetMulti - Get the cache and decrypt it.
+//              └── キャッシュを取得し、復号する。
+// Entries that cannot be decrypted, such as ones encrypted with a removed key or for another key, are missing.
+//    └── 削除した鍵や別のキーのために暗号化されたものなど、復号できないエントリは存在しないものとして扱う。
+func (c *Cache) GetMulti(
+	ctx context.Context,
+	projectID string,
+	keys []*datastore.Key,
+) (items []*datastore.EntityResult, err error) {
+	items, err = c.cache.GetMulti(ctx, projectID, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		if items[i] == nil {
+			continue
+		}
+
+		if i >= len(keys) {
+			items[i] = nil
+
+			continue
+		}
+
+		decrypted, err := c.decrypt(projectID, keys[i], items[i])
+
+		if err != nil {
+			items[i] = nil
+
+			continue
+		}
+
+		items[i] = decrypted
+	}
+
+	return items, nil
+}
+
+// SetMulti - Encrypt items and set them to the cache.
+//              └── itemsを暗号化してキャッシュする。
+func (c *Cache) SetMulti(ctx context.Context, projectID string, items []*datastore.EntityResult) (err error) {
+	encrypted := make([]*datastore.EntityResult, len(items))
+
+	for i := range items {
+		encrypted[i], err = c.encrypt(projectID, items[i])
+
+		if err != nil {
+			return xerrors.Errorf("failed to encrypt %dth entity: %w", i, err)
+		}
+	}
+
+	return c.cache.SetMulti(ctx, projectID, encrypted)
+}
+
+// EncodedSize - Size of the encrypted entity in the wrapped Cache.
+//                 └── ラップしたCacheでの暗号化したエンティティのサイズ。
+// The wrapped Cache measures it if it implements cache.Sizer.
+//    └── ラップしたCacheがcache.Sizerを実装している場合はそれで測る。
+func (c *Cache) EncodedSize(projectID string, entity *datastore.EntityResult) (int, error) {
+	encrypted, err := c.encrypt(projectID, entity)
+
+	if err != nil {
+		return 0, xerrors.Errorf("failed to encrypt entity: %w", err)
+	}
+
+	if sizer, ok := c.cache.(cache.Sizer); ok {
+		return sizer.EncodedSize(projectID, encrypted)
+	}
+
+	return proto.Size(encrypted), nil
+}
+
+// DeleteMulti - Delete from cache.
+//                 └── キャッシュから削除する。
+func (c *Cache) DeleteMulti(ctx context.Context, projectID string, keys []*datastore.Key) (err error) {
+	return c.cache.DeleteMulti(ctx, projectID, keys)
+}
+
+func (c *Cache) encrypt(projectID string, item *datastore.EntityResult) (*datastore.EntityResult, error) {
+	key := item.GetEntity().GetKey()
+
+	additionalData := additionalData(projectID, key)
+
+	if additionalData == nil {
+		return nil, xerrors.New("incomplete key")
+	}
+
+	// Properties are a map, so they are marshaled in a fixed order to make the same payload every time
+	buf := proto.NewBuffer(nil)
+	buf.SetDeterministic(true)
+
+	err := buf.Marshal(item.Entity)
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal entity: %w", err)
+	}
+
+	ciphertext, err := c.keyring.Seal(buf.Bytes(), additionalData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &datastore.EntityResult{
+		Entity: &datastore.Entity{
+			Key: key,
+			Properties: map[string]*datastore.Value{
+				PropertyName: {
+					ValueType:          &datastore.Value_BlobValue{BlobValue: ciphertext},
+					ExcludeFromIndexes: true,
+				},
+			},
+		},
+		Version: item.Version,
+		Cursor:  item.Cursor,
+	}, nil
+}
+
+// decrypt - Decrypt item cached for key.
+//             └── keyのためにキャッシュされたitemを復号する。
+// The requested key is bound instead of the key in item, which is stored with the ciphertext and can be moved with it.
+//    └── itemのキーは暗号文と共に保存され一緒に移動され得るため、リクエストされたキーを紐付ける。
+func (c *Cache) decrypt(
+	projectID string,
+	key *datastore.Key,
+	item *datastore.EntityResult,
+) (*datastore.EntityResult, error) {
+	ciphertext := item.GetEntity().GetProperties()[PropertyName].GetBlobValue()
+
+	if ciphertext == nil {
+		return nil, xerrors.New("missing encrypted property")
+	}
+
+	additionalData := additionalData(projectID, key)
+
+	if additionalData == nil {
+		return nil, xerrors.New("incomplete key")
+	}
+
+	plaintext, err := c.keyring.Open(ciphertext, additionalData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entity := &datastore.Entity{}
+
+	if err := proto.Unmarshal(plaintext, entity); err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal entity: %w", err)
+	}
+
+	if keyenc.Encode(projectID, entity.Key) != string(additionalData) {
+		return nil, xerrors.New("entity of another key")
+	}
+
+	return &datastore.EntityResult{
+		Entity:  entity,
+		Version: item.Version,
+		Cursor:  item.Cursor,
+	}, nil
+}
+
+// additionalData - Additional data binding a ciphertext to key. It is nil for an incomplete key.
+//                    └── 暗号文をkeyに紐付ける追加データ。不完全なキーの場合はnilになる。
+// Keys are encoded by keyenc, so a key with and without the project of its own are bound the same way.
+//    └── キーはkeyencでエンコードするため、プロジェクトを持つキーと持たないキーは同じように紐付けられる。
+func additionalData(projectID string, key *datastore.Key) []byte {
+	encoded := keyenc.Encode(projectID, key)
+
+	if encoded == "" {
+		return nil
+	}
+
+	return []byte(encoded)
+}
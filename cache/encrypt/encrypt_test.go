@@ -0,0 +1,304 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	projectID = "project-id"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 16)
+
+	entityResult = &datastore.EntityResult{
+		Entity: &datastore.Entity{
+			Key: &datastore.Key{
+				PartitionId: &datastore.PartitionId{
+					ProjectId:   "project-id",
+					NamespaceId: "namespace-id",
+				},
+				Path: []*datastore.Key_PathElement{
+					{
+						Kind:   "kind",
+						IdType: &datastore.Key_PathElement_Id{Id: 10},
+					},
+				},
+			},
+			Properties: map[string]*datastore.Value{
+				"token": {
+					ValueType: &datastore.Value_StringValue{StringValue: "secret"},
+				},
+			},
+		},
+		Version: 1,
+	}
+
+	movedKey = &datastore.Key{
+		PartitionId: &datastore.PartitionId{
+			NamespaceId: "namespace-id",
+		},
+		Path: []*datastore.Key_PathElement{
+			{
+				Kind:   "kind",
+				IdType: &datastore.Key_PathElement_Id{Id: 20},
+			},
+		},
+	}
+
+	ignoreXXX = cmp.FilterPath(func(path cmp.Path) bool {
+		return !strings.HasPrefix(path.Last().String(), "XXX_")
+	}, cmp.Ignore())
+)
+
+func newKeyring(t *testing.T, primaryKeyID string, keys map[string][]byte) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(primaryKeyID, keys)
+
+	if err != nil {
+		t.Fatalf("failed to initialize keyring: %+v", err)
+	}
+
+	return keyring
+}
+
+func TestKeyring_rotation(t *testing.T) {
+	old := newKeyring(t, "k1", map[string][]byte{"k1": key1})
+	rotated := newKeyring(t, "k2", map[string][]byte{"k1": key1, "k2": key2})
+	removed := newKeyring(t, "k2", map[string][]byte{"k2": key2})
+
+	sealed, err := old.Seal([]byte("plaintext"), []byte("ad"))
+
+	if err != nil {
+		t.Fatalf("failed to seal: %+v", err)
+	}
+
+	opened, err := rotated.Open(sealed, []byte("ad"))
+
+	if err != nil || string(opened) != "plaintext" {
+		t.Errorf("payload encrypted with an old key must be readable: %s, %+v", opened, err)
+	}
+
+	if _, err := removed.Open(sealed, []byte("ad")); !xerrors.Is(err, ErrUnknownKey) {
+		t.Errorf("payload encrypted with a removed key must fail with ErrUnknownKey: %+v", err)
+	}
+
+	if _, err := rotated.Open(sealed, []byte("other")); err == nil {
+		t.Errorf("payload with different additional data must not be decrypted")
+	}
+}
+
+func TestKeyring_deterministic(t *testing.T) {
+	keyring := newKeyring(t, "k1", map[string][]byte{"k1": key1})
+
+	seal := func(plaintext, additionalData string) []byte {
+		sealed, err := keyring.Seal([]byte(plaintext), []byte(additionalData))
+
+		if err != nil {
+			t.Fatalf("failed to seal: %+v", err)
+		}
+
+		return sealed
+	}
+
+	if !bytes.Equal(seal("plaintext", "ad"), seal("plaintext", "ad")) {
+		t.Errorf("the same input must be sealed into the same payload")
+	}
+
+	if bytes.Equal(seal("plaintext", "ad"), seal("plaintext", "other")) ||
+		bytes.Equal(seal("plaintext", "ad"), seal("other", "ad")) {
+		t.Errorf("different inputs must be sealed into different payloads")
+	}
+}
+
+func TestNewKeyring_invalid(t *testing.T) {
+	if _, err := NewKeyring("k2", map[string][]byte{"k1": key1}); err == nil {
+		t.Errorf("missing primary key must be an error")
+	}
+
+	if _, err := NewKeyring("k1", map[string][]byte{"k1": []byte("short")}); err == nil {
+		t.Errorf("invalid key length must be an error")
+	}
+}
+
+func TestCache_setThenGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+	keys := []*datastore.Key{entityResult.Entity.Key, movedKey}
+
+	var stored []*datastore.EntityResult
+	m.EXPECT().
+		SetMulti(ctx, projectID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, items []*datastore.EntityResult) error {
+			stored = items
+			return nil
+		})
+
+	c := NewCache(m, newKeyring(t, "k1", map[string][]byte{"k1": key1}))
+
+	if err := c.SetMulti(ctx, projectID, []*datastore.EntityResult{entityResult}); err != nil {
+		t.Fatalf("failed to SetMulti: %+v", err)
+	}
+
+	if _, ok := stored[0].Entity.Properties["token"]; ok || stored[0].Version != entityResult.Version {
+		t.Fatalf("stored entity was not encrypted: %v", stored[0])
+	}
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, keys).
+		Return([]*datastore.EntityResult{stored[0], nil}, nil).
+		Times(2)
+
+	rotated := NewCache(m, newKeyring(t, "k2", map[string][]byte{"k1": key1, "k2": key2}))
+
+	items, err := rotated.GetMulti(ctx, projectID, keys)
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti: %+v", err)
+	}
+
+	if diff := cmp.Diff([]*datastore.EntityResult{entityResult, nil}, items, ignoreXXX); diff != "" {
+		t.Errorf("decrypted entities differed: %s", diff)
+	}
+
+	removed := NewCache(m, newKeyring(t, "k2", map[string][]byte{"k2": key2}))
+
+	items, err = removed.GetMulti(ctx, projectID, keys)
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti: %+v", err)
+	}
+
+	if items[0] != nil {
+		t.Errorf("entity encrypted with a removed key must be missing: %v", items[0])
+	}
+}
+
+func TestCache_moved(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	var stored []*datastore.EntityResult
+	m.EXPECT().
+		SetMulti(ctx, projectID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, items []*datastore.EntityResult) error {
+			stored = items
+			return nil
+		})
+
+	c := NewCache(m, newKeyring(t, "k1", map[string][]byte{"k1": key1}))
+
+	if err := c.SetMulti(ctx, projectID, []*datastore.EntityResult{entityResult}); err != nil {
+		t.Fatalf("failed to SetMulti: %+v", err)
+	}
+
+	// The ciphertext is moved to another key in the backend, along with the key stored beside it
+	//    └── 暗号文を、隣に保存されたキーと共にバックエンドで別のキーに移動する
+	m.EXPECT().
+		GetMulti(ctx, projectID, []*datastore.Key{movedKey}).
+		Return([]*datastore.EntityResult{stored[0]}, nil)
+
+	items, err := c.GetMulti(ctx, projectID, []*datastore.Key{movedKey})
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti: %+v", err)
+	}
+
+	if items[0] != nil {
+		t.Errorf("entity moved to another key must be missing: %v", items[0])
+	}
+
+	// Keys without the project of their own are bound as well
+	//    └── プロジェクトを持たないキーも同様に紐付けられる
+	projectless := &datastore.Key{
+		PartitionId: &datastore.PartitionId{NamespaceId: "namespace-id"},
+		Path:        entityResult.Entity.Key.Path,
+	}
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, []*datastore.Key{projectless}).
+		Return([]*datastore.EntityResult{stored[0]}, nil)
+
+	items, err = c.GetMulti(ctx, projectID, []*datastore.Key{projectless})
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti: %+v", err)
+	}
+
+	if diff := cmp.Diff([]*datastore.EntityResult{entityResult}, items, ignoreXXX); diff != "" {
+		t.Errorf("decrypted entities differed: %s", diff)
+	}
+}
+
+func TestCache_setTwice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	item := proto.Clone(entityResult).(*datastore.EntityResult)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		item.Entity.Properties[name] = &datastore.Value{
+			ValueType: &datastore.Value_StringValue{StringValue: name},
+		}
+	}
+
+	var stored [][]byte
+	m.EXPECT().
+		SetMulti(ctx, projectID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, items []*datastore.EntityResult) error {
+			stored = append(stored, items[0].Entity.Properties[PropertyName].GetBlobValue())
+			return nil
+		}).
+		Times(2)
+
+	c := NewCache(m, newKeyring(t, "k1", map[string][]byte{"k1": key1}))
+
+	for i := 0; i < 2; i++ {
+		if err := c.SetMulti(ctx, projectID, []*datastore.EntityResult{item}); err != nil {
+			t.Fatalf("failed to SetMulti: %+v", err)
+		}
+	}
+
+	// a backend storing payloads in a set keeps one member per version
+	if !bytes.Equal(stored[0], stored[1]) {
+		t.Errorf("the same entity was encrypted into different payloads")
+	}
+}
+
+func TestCache_EncodedSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewCache(mock.NewMockCache(ctrl), newKeyring(t, "k1", map[string][]byte{"k1": key1}))
+
+	size, err := c.EncodedSize(projectID, entityResult)
+
+	if err != nil {
+		t.Fatalf("EncodedSize failed: %+v", err)
+	}
+
+	// the nonce and the tag are added to the entity
+	if size <= proto.Size(entityResult) {
+		t.Errorf("size of the encrypted entity must be larger than the entity: %d", size)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Package encrypt - This package provides encryption of cached entities with AES-GCM.
+Every encrypted payload records the ID of the key it was encrypted with,
+so that keys can be rotated without flushing the cache.
+...
+このパッケージではAES-GCMによるキャッシュするエンティティの暗号化を提供します。
+暗号化したデータには暗号化に使った鍵のIDを記録するため、キャッシュを破棄せずに鍵をローテーションすることができます。
+*/
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"golang.org/x/xerrors"
+)
+
+// payloadVersion - Version of the layout of encrypted payloads.
+//                    └── 暗号化したデータのレイアウトのバージョン。
+//
+// Layout:
+//   version(1) | length of key ID(1) | key ID | nonce | ciphertext
+const payloadVersion byte = 1
+
+// nonceKeyLabel - Label of the HMAC key derived from an AES key to make nonces.
+//                   └── ノンスを作るためにAESの鍵から導出するHMACの鍵のラベル。
+const nonceKeyLabel = "datastore-cache-go/encrypt/nonce"
+
+// ErrUnknownKey - The payload was encrypted with a key that is not in the keyring.
+//                   └── キーリングに無い鍵で暗号化されたデータ。
+var ErrUnknownKey = xerrors.New("unknown key ID")
+
+// Keyring - Set of AES keys identified by key IDs.
+//             └── 鍵IDで識別されるAESの鍵の集合。
+// New payloads are encrypted with the primary key, and payloads encrypted with any key in the keyring can be decrypted.
+//    └── 新しいデータはプライマリの鍵で暗号化し、キーリング内のいずれかの鍵で暗号化されたデータを復号できる。
+type Keyring struct {
+	primaryKeyID string
+	aeads        map[string]cipher.AEAD
+	nonceKeys    map[string][]byte
+}
+
+// NewKeyring - Initialize Keyring.
+//                └── Keyringを初期化する。
+// keys maps key IDs to AES keys of 16, 24 or 32 bytes. primaryKeyID must be one of the keys.
+//    └── keysは鍵IDから16, 24, 32バイトのAESの鍵への対応。primaryKeyIDはkeysに含まれている必要がある。
+//
+// To rotate keys, add the new key and make it primary, then remove the old key after cached entries expire.
+//    └── 鍵をローテーションするには、新しい鍵を追加してプライマリにし、キャッシュが入れ替わった後に古い鍵を削除する。
+func NewKeyring(primaryKeyID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primaryKeyID]; !ok {
+		return nil, xerrors.Errorf("primary key %q is not in keys", primaryKeyID)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	nonceKeys := make(map[string][]byte, len(keys))
+
+	for id, key := range keys {
+		if len(id) > 255 {
+			return nil, xerrors.Errorf("key ID %q is longer than 255 bytes", id)
+		}
+
+		block, err := aes.NewCipher(key)
+
+		if err != nil {
+			return nil, xerrors.Errorf("invalid key %q: %w", id, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+
+		if err != nil {
+			return nil, xerrors.Errorf("failed to initialize GCM for key %q: %w", id, err)
+		}
+
+		aeads[id] = aead
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(nonceKeyLabel))
+		nonceKeys[id] = mac.Sum(nil)
+	}
+
+	return &Keyring{
+		primaryKeyID: primaryKeyID,
+		aeads:        aeads,
+		nonceKeys:    nonceKeys,
+	}, nil
+}
+
+// Seal - Encrypt plaintext with the primary key.
+//          └── プライマリの鍵でplaintextを暗号化する。
+// additionalData is authenticated but not encrypted, and the same value must be passed to Open.
+//    └── additionalDataは認証されるが暗号化はされず、Openに同じ値を渡す必要がある。
+// The nonce is an HMAC of additionalData and plaintext, so the same input always makes the same payload.
+// Backends that store payloads as set members, such as Redis, replace an entry instead of adding a copy.
+// A nonce is reused only for the same input, which reveals nothing but that two payloads are equal.
+//    └── ノンスはadditionalDataとplaintextのHMACであるため、同じ入力からは常に同じデータが作られる。
+//    └── Redisのようにデータを集合の要素として保存するバックエンドでは、コピーを追加せずにエントリを置き換える。
+//    └── ノンスが再利用されるのは同じ入力の場合のみであり、2つのデータが等しいこと以外は明らかにならない。
+func (k *Keyring) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	aead := k.aeads[k.primaryKeyID]
+
+	buf := make([]byte, 0, 2+len(k.primaryKeyID)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	buf = append(buf, payloadVersion, byte(len(k.primaryKeyID)))
+	buf = append(buf, k.primaryKeyID...)
+
+	nonce := k.nonce(plaintext, additionalData)[:aead.NonceSize()]
+	buf = append(buf, nonce...)
+
+	return aead.Seal(buf, nonce, plaintext, additionalData), nil
+}
+
+// nonce - Synthetic nonce for plaintext and additionalData with the primary key.
+//           └── プライマリの鍵でのplaintextとadditionalDataのための合成ノンス。
+func (k *Keyring) nonce(plaintext, additionalData []byte) []byte {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(additionalData)))
+
+	mac := hmac.New(sha256.New, k.nonceKeys[k.primaryKeyID])
+	mac.Write(length[:])
+	mac.Write(additionalData)
+	mac.Write(plaintext)
+
+	return mac.Sum(nil)
+}
+
+// Open - Decrypt data encrypted by Seal.
+//          └── Sealで暗号化されたデータを復号する。
+func (k *Keyring) Open(data, additionalData []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, xerrors.New("truncated header")
+	}
+
+	if data[0] != payloadVersion {
+		return nil, xerrors.Errorf("unsupported payload version: %d", data[0])
+	}
+
+	idLen := int(data[1])
+	data = data[2:]
+
+	if len(data) < idLen {
+		return nil, xerrors.New("truncated key ID")
+	}
+
+	keyID := string(data[:idLen])
+	data = data[idLen:]
+
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return nil, xerrors.Errorf("%q: %w", keyID, ErrUnknownKey)
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, xerrors.New("truncated nonce")
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decrypt with key %q: %w", keyID, err)
+	}
+
+	return plaintext, nil
+}
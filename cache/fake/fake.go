@@ -0,0 +1,270 @@
+/*
+Package fake - This package provides an in-memory Cache that records every call, for tests.
+...
+このパッケージではテストのために、全ての呼び出しを記録するメモリ上のCacheを提供します。
+
+Unlike cache/mock, no expectations have to be scripted; assert the resulting state instead.
+    └── cache/mockと異なり期待する呼び出しを記述する必要はなく、結果の状態を検証する。
+
+	c := fake.NewCache()
+	middleware := cache.NewMiddleware(c)
+	// ... run the application
+	c.AssertCached(t, datastore.NameKey("User", "foo", nil))
+*/
+package fake
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	cds "cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	// MethodGetMulti - Cache.GetMulti
+	MethodGetMulti = "GetMulti"
+	// MethodSetMulti - Cache.SetMulti
+	MethodSetMulti = "SetMulti"
+	// MethodDeleteMulti - Cache.DeleteMulti
+	MethodDeleteMulti = "DeleteMulti"
+)
+
+// Call - A recorded call of Cache.
+//          └── 記録されたCacheの呼び出し。
+type Call struct {
+	// Method - One of MethodGetMulti, MethodSetMulti and MethodDeleteMulti.
+	//            └── MethodGetMulti、MethodSetMulti、MethodDeleteMultiのいずれか。
+	Method    string
+	ProjectID string
+	// Keys - Keys of GetMulti and DeleteMulti.
+	//          └── GetMultiとDeleteMultiのキー。
+	Keys []*datastore.Key
+	// Items - Entities of SetMulti.
+	//           └── SetMultiのエンティティ。
+	Items []*datastore.EntityResult
+}
+
+type entry struct {
+	projectless string
+	result      *datastore.EntityResult
+}
+
+// Cache - Cache on a map that records every call.
+//           └── 全ての呼び出しを記録する、マップ上のCache。
+// It keeps the newest version of each entity and satisfies cachetest.RunConformance.
+//    └── エンティティごとに最新のバージョンを保持し、cachetest.RunConformanceを満たす。
+type Cache struct {
+	mu          sync.Mutex
+	entities    map[string]*entry
+	calls       []Call
+	hits        int
+	misses      int
+	invalidated []*datastore.Key
+}
+
+var _ cache.Cache = &Cache{}
+
+// NewCache - Initialize an empty Cache.
+//              └── 空のCacheを初期化する。
+func NewCache() *Cache {
+	return &Cache{
+		entities: map[string]*entry{},
+	}
+}
+
+// GetMulti - Get the cache, counting hits and misses.
+//              └── ヒットとミスを数えながらキャッシュを取得する。
+func (c *Cache) GetMulti(
+	_ context.Context,
+	projectID string,
+	keys []*datastore.Key,
+) ([]*datastore.EntityResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, Call{Method: MethodGetMulti, ProjectID: projectID, Keys: cloneKeys(keys)})
+
+	items := make([]*datastore.EntityResult, len(keys))
+	for i := range keys {
+		encoded := cacheKey(projectID, keys[i])
+		if encoded == "" {
+			continue
+		}
+
+		if e, ok := c.entities[encoded]; ok {
+			items[i] = proto.Clone(e.result).(*datastore.EntityResult)
+			c.hits++
+		} else {
+			c.misses++
+		}
+	}
+
+	return items, nil
+}
+
+// SetMulti - Set to the cache, keeping the newest version of each entity.
+//              └── エンティティごとに最新のバージョンを保持してキャッシュする。
+func (c *Cache) SetMulti(_ context.Context, projectID string, items []*datastore.EntityResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	recorded := make([]*datastore.EntityResult, 0, len(items))
+	for _, e := range items {
+		recorded = append(recorded, proto.Clone(e).(*datastore.EntityResult))
+	}
+	c.calls = append(c.calls, Call{Method: MethodSetMulti, ProjectID: projectID, Items: recorded})
+
+	for _, e := range items {
+		key := e.GetEntity().GetKey()
+
+		encoded := cacheKey(projectID, key)
+		if encoded == "" {
+			continue
+		}
+
+		if current, ok := c.entities[encoded]; !ok || current.result.Version <= e.Version {
+			c.entities[encoded] = &entry{
+				projectless: projectless(key),
+				result:      proto.Clone(e).(*datastore.EntityResult),
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteMulti - Delete from the cache, recording the keys as invalidated.
+//                 └── キャッシュから削除し、キーを無効化されたものとして記録する。
+func (c *Cache) DeleteMulti(_ context.Context, projectID string, keys []*datastore.Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, Call{Method: MethodDeleteMulti, ProjectID: projectID, Keys: cloneKeys(keys)})
+	c.invalidated = append(c.invalidated, cloneKeys(keys)...)
+
+	for _, key := range keys {
+		delete(c.entities, cacheKey(projectID, key))
+	}
+
+	return nil
+}
+
+// Calls - Recorded calls in order.
+//           └── 順に記録された呼び出し。
+func (c *Cache) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Call(nil), c.calls...)
+}
+
+// Hits - Number of keys found by GetMulti.
+//          └── GetMultiで見つかったキーの数。
+func (c *Cache) Hits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits
+}
+
+// Misses - Number of keys not found by GetMulti. Keys of reserved partitions are not counted.
+//            └── GetMultiで見つからなかったキーの数。予約されたパーティションのキーは数えない。
+func (c *Cache) Misses() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.misses
+}
+
+// InvalidatedKeys - Keys passed to DeleteMulti in order, including duplicates.
+//                     └── DeleteMultiに渡された順のキー。重複を含む。
+func (c *Cache) InvalidatedKeys() []*cds.Key {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]*cds.Key, 0, len(c.invalidated))
+	for _, key := range c.invalidated {
+		keys = append(keys, toDatastoreKey(key))
+	}
+
+	return keys
+}
+
+// Cached - Whether the entity of key is cached in any project.
+//            └── keyのエンティティがいずれかのプロジェクトでキャッシュされているかどうか。
+func (c *Cache) Cached(key *cds.Key) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	encoded := projectless(toProtoKey(key))
+	for _, e := range c.entities {
+		if e.projectless == encoded {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AssertCached - Fail t if the entity of key is not cached.
+//                  └── keyのエンティティがキャッシュされていない場合にtを失敗させる。
+func (c *Cache) AssertCached(t testing.TB, key *cds.Key) {
+	t.Helper()
+
+	if !c.Cached(key) {
+		t.Errorf("%v is not cached", key)
+	}
+}
+
+// AssertNotCached - Fail t if the entity of key is cached.
+//                     └── keyのエンティティがキャッシュされている場合にtを失敗させる。
+func (c *Cache) AssertNotCached(t testing.TB, key *cds.Key) {
+	t.Helper()
+
+	if c.Cached(key) {
+		t.Errorf("%v is cached", key)
+	}
+}
+
+// Reset - Remove all entities and recorded calls.
+//           └── 全てのエンティティと記録された呼び出しを削除する。
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entities = map[string]*entry{}
+	c.calls = nil
+	c.hits = 0
+	c.misses = 0
+	c.invalidated = nil
+}
+
+// cacheKey - Key of the map, or an empty string if the key is in a reserved partition.
+//              └── マップのキー。予約されたパーティションのキーの場合は空文字列。
+func cacheKey(projectID string, key *datastore.Key) string {
+	if isReserved(projectID) ||
+		isReserved(key.GetPartitionId().GetProjectId()) || isReserved(key.GetPartitionId().GetNamespaceId()) {
+		return ""
+	}
+
+	return keyenc.Encode(projectID, key)
+}
+
+func isReserved(id string) bool {
+	return strings.HasPrefix(id, "__") && strings.HasSuffix(id, "__")
+}
+
+func cloneKeys(keys []*datastore.Key) []*datastore.Key {
+	cloned := make([]*datastore.Key, 0, len(keys))
+	for _, key := range keys {
+		cloned = append(cloned, proto.Clone(key).(*datastore.Key))
+	}
+
+	return cloned
+}
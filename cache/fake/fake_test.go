@@ -0,0 +1,137 @@
+package fake_test
+
+import (
+	"context"
+	"testing"
+
+	cds "cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/cachetest"
+	"github.com/gcp-kit/datastore-cache-go/cache/dstest"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+const (
+	projectID = "project-id"
+)
+
+type User struct {
+	Name string
+}
+
+func TestCache_Conformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) cache.Cache {
+		return fake.NewCache()
+	})
+}
+
+func TestCache_Middleware(t *testing.T) {
+	srv := dstest.NewServer()
+	defer srv.Close()
+
+	c := fake.NewCache()
+	middleware := cache.NewMiddleware(c)
+
+	conn, err := srv.Dial(grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	client, err := cds.NewClient(context.Background(), projectID, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("failed to initialize datastore client: %+v", err)
+	}
+
+	ctx := context.Background()
+	parent := cds.NameKey("Group", "g", nil)
+	parent.Namespace = "ns"
+	keys := []*cds.Key{cds.NameKey("User", "foo", parent), cds.IDKey("User", 1, nil)}
+	keys[0].Namespace = "ns"
+
+	if _, err := client.PutMulti(ctx, keys, []*User{{Name: "foo"}, {Name: "bar"}}); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	c.AssertNotCached(t, keys[0])
+	c.AssertNotCached(t, keys[1])
+
+	users := make([]*User, len(keys))
+	for i := 0; i < 2; i++ {
+		if err := client.GetMulti(ctx, keys, users); err != nil {
+			t.Fatalf("failed to get: %+v", err)
+		}
+	}
+
+	c.AssertCached(t, keys[0])
+	c.AssertCached(t, keys[1])
+
+	if c.Hits() != 2 || c.Misses() != 2 {
+		t.Errorf("unexpected hits and misses: %d, %d", c.Hits(), c.Misses())
+	}
+
+	if err := client.Delete(ctx, keys[0]); err != nil {
+		t.Fatalf("failed to delete: %+v", err)
+	}
+
+	c.AssertNotCached(t, keys[0])
+	c.AssertCached(t, keys[1])
+
+	// PutMulti before and after Commit, and Delete before and after Commit
+	//    └── PutMultiのCommit前後と、DeleteのCommit前後
+	expected := append(append([]*cds.Key{}, keys...), keys...)
+	expected = append(expected, keys[0], keys[0])
+	if diff := cmp.Diff(expected, c.InvalidatedKeys()); diff != "" {
+		t.Errorf("invalidated keys differed: %s", diff)
+	}
+
+	var methods []string
+	for _, call := range c.Calls() {
+		methods = append(methods, call.Method)
+	}
+
+	expectedMethods := []string{
+		fake.MethodDeleteMulti, fake.MethodDeleteMulti,
+		fake.MethodGetMulti, fake.MethodSetMulti, fake.MethodGetMulti,
+		fake.MethodDeleteMulti, fake.MethodDeleteMulti,
+	}
+	if diff := cmp.Diff(expectedMethods, methods); diff != "" {
+		t.Errorf("recorded calls differed: %s", diff)
+	}
+
+	c.Reset()
+	if c.Hits() != 0 || len(c.Calls()) != 0 || len(c.InvalidatedKeys()) != 0 {
+		t.Errorf("records remained after Reset")
+	}
+	c.AssertNotCached(t, keys[1])
+}
+
+func TestCache_AssertCached(t *testing.T) {
+	c := fake.NewCache()
+	key := cds.NameKey("User", "foo", nil)
+
+	tb := &recorder{TB: t}
+	c.AssertCached(tb, key)
+	if !tb.failed {
+		t.Errorf("AssertCached must fail for a missing entity")
+	}
+
+	tb = &recorder{TB: t}
+	c.AssertNotCached(tb, key)
+	if tb.failed {
+		t.Errorf("AssertNotCached must not fail for a missing entity")
+	}
+}
+
+// recorder - testing.TB that records failures instead of failing the test.
+//              └── テストを失敗させる代わりに失敗を記録するtesting.TB。
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Errorf(string, ...interface{}) {
+	r.failed = true
+}
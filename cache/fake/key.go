@@ -0,0 +1,63 @@
+package fake
+
+import (
+	cds "cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// toProtoKey - Convert a key of the Datastore client into a key of the API, without the project.
+//                └── Datastoreクライアントのキーを、プロジェクトを持たないAPIのキーに変換する。
+func toProtoKey(key *cds.Key) *datastore.Key {
+	var path []*datastore.Key_PathElement
+
+	for k := key; k != nil; k = k.Parent {
+		element := &datastore.Key_PathElement{Kind: k.Kind}
+
+		switch {
+		case k.Name != "":
+			element.IdType = &datastore.Key_PathElement_Name{Name: k.Name}
+		case k.ID != 0:
+			element.IdType = &datastore.Key_PathElement_Id{Id: k.ID}
+		}
+
+		path = append([]*datastore.Key_PathElement{element}, path...)
+	}
+
+	return &datastore.Key{
+		PartitionId: &datastore.PartitionId{NamespaceId: key.Namespace},
+		Path:        path,
+	}
+}
+
+// toDatastoreKey - Convert a key of the API into a key of the Datastore client.
+//                    └── APIのキーをDatastoreクライアントのキーに変換する。
+func toDatastoreKey(key *datastore.Key) *cds.Key {
+	var converted *cds.Key
+
+	for _, element := range key.GetPath() {
+		converted = &cds.Key{
+			Kind:      element.Kind,
+			ID:        element.GetId(),
+			Name:      element.GetName(),
+			Parent:    converted,
+			Namespace: key.GetPartitionId().GetNamespaceId(),
+		}
+	}
+
+	return converted
+}
+
+// projectless - Encode key ignoring its project, so that keys of the Datastore client can be matched.
+//                 └── Datastoreクライアントのキーと照合できるよう、プロジェクトを無視してkeyをエンコードする。
+// The database is kept, so keys of the Datastore client only match those in the default database.
+//    └── データベースは残すため、Datastoreクライアントのキーはデフォルトのデータベースのキーとのみ一致する。
+func projectless(key *datastore.Key) string {
+	return keyenc.Encode("", &datastore.Key{
+		PartitionId: &datastore.PartitionId{
+			DatabaseId:  key.GetPartitionId().GetDatabaseId(),
+			NamespaceId: key.GetPartitionId().GetNamespaceId(),
+		},
+		Path: key.GetPath(),
+	})
+}
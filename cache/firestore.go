@@ -0,0 +1,550 @@
+package cache
+
+import (
+	"context"
+	"io"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/genproto/googleapis/firestore/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// FirestoreMethodGetDocument - Called by Get of a document.
+	//                                └── ドキュメントのGetにより呼ばれる
+	FirestoreMethodGetDocument = "/google.firestore.v1.Firestore/GetDocument"
+
+	// FirestoreMethodBatchGetDocuments - Called by GetAll. This is a server streaming RPC.
+	//                                      └── GetAllにより呼ばれる。サーバーストリーミングのRPC。
+	FirestoreMethodBatchGetDocuments = "/google.firestore.v1.Firestore/BatchGetDocuments"
+
+	// FirestoreMethodCommit - Called by Create, Set, Update, Delete, batches and transactions.
+	//                           └── Create, Set, Update, Delete, バッチ、トランザクションにより呼ばれる
+	FirestoreMethodCommit = "/google.firestore.v1.Firestore/Commit"
+
+	// FirestoreMethodCreateDocument - Creates a document.
+	//                                   └── ドキュメントを作成する
+	FirestoreMethodCreateDocument = "/google.firestore.v1.Firestore/CreateDocument"
+
+	// FirestoreMethodUpdateDocument - Updates or inserts a document.
+	//                                   └── ドキュメントを更新または挿入する
+	FirestoreMethodUpdateDocument = "/google.firestore.v1.Firestore/UpdateDocument"
+
+	// FirestoreMethodDeleteDocument - Deletes a document.
+	//                                   └── ドキュメントを削除する
+	FirestoreMethodDeleteDocument = "/google.firestore.v1.Firestore/DeleteDocument"
+
+	// FirestoreMethodBatchWrite - Applies writes without atomicity. Requests are read through GetWrites.
+	//                               └── 原子性なしに書き込みを適用する。リクエストはGetWritesを通して読む。
+	FirestoreMethodBatchWrite = "/google.firestore.v1.Firestore/BatchWrite"
+)
+
+// FirestoreUnaryClientInterceptor - Called from Firestore gRPC in native mode.
+//                                     └── ネイティブモードのFirestoreのgRPCから呼ばれる
+// Documents share the cache, policies and metrics with Datastore, keyed by document name and update_time.
+//    └── ドキュメントはドキュメント名とupdate_timeをキーとして、キャッシュ、ポリシー、メトリクスをDatastoreと共有する。
+func (m *Middleware) FirestoreUnaryClientInterceptor(
+	ctx context.Context,
+	method string, req,
+	reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) (err error) {
+	ctx = withOutgoingCacheControl(ctx)
+	cachingMode := m.cachingMode(ctx, method, req, reply, cc, invoker, opts...)
+
+	switch method {
+	case FirestoreMethodGetDocument:
+		// Cache reference
+		//    └── キャッシュの参照
+		return m.getDocument(
+			ctx,
+			cachingMode,
+			method,
+			req.(*firestore.GetDocumentRequest),
+			reply.(*firestore.Document),
+			cc,
+			invoker,
+			opts...,
+		)
+	case FirestoreMethodCommit,
+		FirestoreMethodCreateDocument,
+		FirestoreMethodUpdateDocument,
+		FirestoreMethodDeleteDocument,
+		FirestoreMethodBatchWrite:
+		// Clear cache
+		//    └── キャッシュの削除
+		return m.writeDocuments(ctx, cachingMode, method, req, reply, cc, invoker, opts...)
+	default:
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// FirestoreStreamClientInterceptor - Called from Firestore gRPC in native mode for streaming RPCs.
+//                                      └── ネイティブモードのFirestoreのgRPCからストリーミングのRPCで呼ばれる
+// BatchGetDocuments is served from the cache, and only cache misses are sent to Firestore.
+// Fetched documents are cached when the stream is read to the end.
+// CachingModeFunc receives a nil reply and invoker for BatchGetDocuments.
+//    └── BatchGetDocumentsはキャッシュから返し、キャッシュミスのみをFirestoreに送る。
+//    └── 取得したドキュメントはストリームを最後まで読んだ時にキャッシュする。
+//    └── BatchGetDocumentsではCachingModeFuncはnilのreplyとinvokerを受け取る。
+func (m *Middleware) FirestoreStreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	ctx = withOutgoingCacheControl(ctx)
+	if method != FirestoreMethodBatchGetDocuments {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+
+	// The stream is opened when the request is sent
+	//    └── ストリームはリクエストを送る時に開く
+	return &batchGetDocumentsStream{
+		middleware: m,
+		ctx:        ctx,
+		desc:       desc,
+		cc:         cc,
+		method:     method,
+		streamer:   streamer,
+		opts:       opts,
+	}, nil
+}
+
+// getDocument - Process at GetDocument of Firestore.
+//                 └── FirestoreのGetDocumentのときの処理
+func (m *Middleware) getDocument(
+	ctx context.Context,
+	cachingMode CachingModeType,
+	method string,
+	req *firestore.GetDocumentRequest,
+	reply *firestore.Document,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	projectID, key, ok := parseDocumentName(req.GetName())
+
+	// Do not include if transaction, read time or mask is specified
+	//    └── トランザクション、読み取り時刻、マスクが指定されていれば対象としない
+	if !ok || req.GetConsistencySelector() != nil || req.GetMask() != nil {
+		cachingMode = CachingModeNever
+	}
+
+	keys := []*datastore.Key{key}
+
+	var shadowed []*datastore.EntityResult
+	if ok {
+		var cached []*firestore.Document
+		cached, keys, shadowed = m.beforeGetDocuments(ctx, cachingMode, projectID, keys)
+		if len(cached) == 1 {
+			reply.Reset()
+			proto.Merge(reply, cached[0])
+			return nil
+		}
+	}
+
+	// Original processing
+	//    └── 本来の処理
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	switch {
+	case !ok:
+		return err
+	case status.Code(err) == codes.NotFound:
+		m.afterGetDocuments(ctx, cachingMode, projectID, keys, nil, shadowed)
+		return err
+	case err != nil:
+		return err
+	}
+
+	m.afterGetDocuments(ctx, cachingMode, projectID, keys, []*firestore.Document{reply}, shadowed)
+
+	return nil
+}
+
+// beforeGetDocuments - Called before documents are fetched from Firestore.
+//                        └── Firestoreからドキュメントを取得する前に呼ばれる
+// Returns documents found in the cache, and the keys to be fetched from Firestore.
+//    └── キャッシュで見つかったドキュメントと、Firestoreから取得するキーを返す。
+func (m *Middleware) beforeGetDocuments(
+	ctx context.Context,
+	cachingMode CachingModeType,
+	projectID string,
+	keys []*datastore.Key,
+) (cached []*firestore.Document, misses []*datastore.Key, shadowed []*datastore.EntityResult) {
+	if cachingMode&CachingModeReadOnly == 0 {
+		return nil, keys, nil
+	}
+
+	items, err := m.cache.GetMulti(ctx, projectID, keys)
+	if err == nil && len(items) != len(keys) {
+		err = xerrors.Errorf("cache middleware should return %d, but returned %d", len(keys), len(items))
+	}
+	if err != nil {
+		m.logPrintError(xerrors.Errorf("search on cache before GetDocument failed: %w", err))
+		return nil, keys, nil
+	}
+
+	shadowed = m.takeShadowed(keys, items)
+	m.transformAfterRetrieve(ctx, keys, items)
+
+	stats := statsFrom(ctx)
+	for i := range items {
+		if items[i] == nil {
+			misses = append(misses, keys[i])
+			continue
+		}
+
+		doc, err := entityToDocument(projectID, items[i])
+		if err != nil {
+			m.logPrintError(xerrors.Errorf("cached document was broken: %w", err))
+			misses = append(misses, keys[i])
+			continue
+		}
+
+		cached = append(cached, doc)
+		stats.add(statsServed, keys[i])
+	}
+
+	return cached, misses, shadowed
+}
+
+// afterGetDocuments - Called after documents of keys are fetched from Firestore. Keys not in found were missing.
+//                       └── keysのドキュメントをFirestoreから取得した後に呼ばれる。foundにないキーは存在しなかった。
+func (m *Middleware) afterGetDocuments(
+	ctx context.Context,
+	cachingMode CachingModeType,
+	projectID string,
+	keys []*datastore.Key,
+	found []*firestore.Document,
+	shadowed []*datastore.EntityResult,
+) {
+	statsFrom(ctx).add(statsFetched, keys...)
+
+	if cachingMode&CachingModeWriteOnly == 0 && len(shadowed) == 0 {
+		return
+	}
+
+	reply := &datastore.LookupResponse{}
+	fetched := map[string]bool{}
+	for _, doc := range found {
+		_, key, ok := parseDocumentName(doc.GetName())
+		if !ok {
+			continue
+		}
+
+		entity, err := documentToEntity(key, doc)
+		if err != nil {
+			m.logPrintError(xerrors.Errorf("cache after GetDocument failed: %w", err))
+			continue
+		}
+
+		reply.Found = append(reply.Found, entity)
+		fetched[keyenc.Encode(projectID, key)] = true
+	}
+
+	for _, key := range keys {
+		if !fetched[keyenc.Encode(projectID, key)] {
+			reply.Missing = append(reply.Missing, &datastore.EntityResult{Entity: &datastore.Entity{Key: key}})
+		}
+	}
+
+	// Verify cache of ShadowKinds
+	//    └── ShadowKindsのキャッシュの検証
+	m.compareShadowed(projectID, shadowed, reply)
+
+	// Save cache
+	//    └── キャッシュの保存
+	if cachingMode&CachingModeWriteOnly != 0 {
+		err := m.afterLookup(ctx, &datastore.LookupRequest{ProjectId: projectID}, reply)
+		if err != nil {
+			m.logPrintError(xerrors.Errorf("cache after GetDocument failed: %w", err))
+		}
+	}
+}
+
+// writeDocuments - Processing at writes of documents.
+//                    └── ドキュメントの書き込みのときの処理
+func (m *Middleware) writeDocuments(
+	ctx context.Context,
+	cachingMode CachingModeType,
+	method string,
+	req,
+	reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) (err error) {
+	names := writtenDocuments(req)
+
+	// Clear cache
+	//    └── キャッシュの削除
+	if m.deletesBeforeCommit(cachingMode) {
+		if err := m.deleteDocuments(ctx, names); err != nil {
+			err = xerrors.Errorf("cache before commit failed: %w", err)
+			m.logPrintError(err)
+			return err
+		}
+	}
+
+	// Original processing
+	//    └── 本来の処理
+	err = invoker(ctx, method, req, reply, cc, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Clear cache
+	//    └── キャッシュの削除
+	if m.deletesAfterCommit(cachingMode) {
+		if err := m.deleteDocuments(ctx, names); err != nil {
+			m.logPrintError(xerrors.Errorf("cache after commit failed: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// writtenDocuments - Names of the documents written by req.
+//                      └── reqが書き込むドキュメントの名前。
+// Documents created with an ID allocated by Firestore are not included, as they have never been cached.
+//    └── Firestoreが割り当てたIDで作成されるドキュメントは、キャッシュされたことがないため含まない。
+func writtenDocuments(req interface{}) (names []string) {
+	switch r := req.(type) {
+	case *firestore.CreateDocumentRequest:
+		if r.GetDocumentId() != "" {
+			names = append(names, r.GetParent()+"/"+r.GetCollectionId()+"/"+r.GetDocumentId())
+		}
+	case *firestore.UpdateDocumentRequest:
+		names = append(names, r.GetDocument().GetName())
+	case *firestore.DeleteDocumentRequest:
+		names = append(names, r.GetName())
+	case interface{ GetWrites() []*firestore.Write }:
+		// CommitRequest and BatchWriteRequest
+		//    └── CommitRequestとBatchWriteRequest
+		for _, w := range r.GetWrites() {
+			switch {
+			case w.GetUpdate() != nil:
+				names = append(names, w.GetUpdate().GetName())
+			case w.GetDelete() != "":
+				names = append(names, w.GetDelete())
+			case w.GetTransform() != nil:
+				names = append(names, w.GetTransform().GetDocument())
+			}
+		}
+	}
+
+	return names
+}
+
+// deleteDocuments - Delete the documents of names from the cache.
+//                     └── namesのドキュメントをキャッシュから削除する。
+func (m *Middleware) deleteDocuments(ctx context.Context, names []string) error {
+	var projectIDs []string
+	keys := map[string][]*datastore.Key{}
+	for _, name := range names {
+		projectID, key, ok := parseDocumentName(name)
+		if !ok {
+			continue
+		}
+		if _, ok := keys[projectID]; !ok {
+			projectIDs = append(projectIDs, projectID)
+		}
+		keys[projectID] = append(keys[projectID], key)
+	}
+
+	for _, projectID := range projectIDs {
+		if err := m.cache.DeleteMulti(ctx, projectID, keys[projectID]); err != nil {
+			return err
+		}
+
+		statsFrom(ctx).add(statsInvalidated, keys[projectID]...)
+	}
+
+	return nil
+}
+
+// batchGetDocumentsStream - Stream of BatchGetDocuments that returns cached documents before those of Firestore.
+//                             └── Firestoreのドキュメントの前にキャッシュしたドキュメントを返すBatchGetDocumentsのストリーム。
+type batchGetDocumentsStream struct {
+	middleware *Middleware
+	ctx        context.Context
+	desc       *grpc.StreamDesc
+	cc         *grpc.ClientConn
+	method     string
+	streamer   grpc.Streamer
+	opts       []grpc.CallOption
+
+	// stream - Stream to Firestore. nil if no request was sent.
+	//            └── Firestoreへのストリーム。リクエストを送っていない場合はnil。
+	stream grpc.ClientStream
+
+	cachingMode CachingModeType
+	projectID   string
+	cached      []*firestore.Document
+	fetched     []*datastore.Key
+	found       []*firestore.Document
+	shadowed    []*datastore.EntityResult
+	finished    bool
+}
+
+var _ grpc.ClientStream = &batchGetDocumentsStream{}
+
+// SendMsg - Look up the cache, and send the request for cache misses to Firestore.
+//             └── キャッシュを参照し、キャッシュミスのリクエストをFirestoreに送る。
+func (s *batchGetDocumentsStream) SendMsg(msg interface{}) error {
+	req, ok := msg.(*firestore.BatchGetDocumentsRequest)
+	if !ok || s.stream != nil || s.finished {
+		return xerrors.Errorf("unexpected message for %s: %T", s.method, msg)
+	}
+
+	m := s.middleware
+	s.cachingMode = m.cachingMode(s.ctx, s.method, req, nil, s.cc, nil, s.opts...)
+
+	keys, projectID, ok := parseDocumentNames(req.GetDocuments())
+
+	// Do not include if transaction, read time or mask is specified
+	//    └── トランザクション、読み取り時刻、マスクが指定されていれば対象としない
+	if !ok || req.GetConsistencySelector() != nil || req.GetMask() != nil {
+		s.cachingMode = CachingModeNever
+	}
+
+	if ok {
+		s.projectID = projectID
+		s.cached, s.fetched, s.shadowed = m.beforeGetDocuments(s.ctx, s.cachingMode, projectID, keys)
+		if len(s.fetched) == 0 {
+			return nil
+		}
+
+		if len(s.cached) > 0 {
+			req = proto.Clone(req).(*firestore.BatchGetDocumentsRequest)
+			req.Documents = make([]string, 0, len(s.fetched))
+			for _, key := range s.fetched {
+				req.Documents = append(req.Documents, documentName(projectID, key))
+			}
+		}
+	}
+
+	// Original processing
+	//    └── 本来の処理
+	stream, err := s.streamer(s.ctx, s.desc, s.cc, s.method, s.opts...)
+	if err != nil {
+		return err
+	}
+	s.stream = stream
+
+	return stream.SendMsg(req)
+}
+
+// RecvMsg - Receive cached documents, and then those of Firestore.
+//             └── キャッシュしたドキュメントを受け取り、その後Firestoreのドキュメントを受け取る。
+func (s *batchGetDocumentsStream) RecvMsg(msg interface{}) error {
+	if len(s.cached) > 0 {
+		resp, ok := msg.(*firestore.BatchGetDocumentsResponse)
+		if !ok {
+			return xerrors.Errorf("unexpected message for %s: %T", s.method, msg)
+		}
+
+		resp.Reset()
+		resp.Result = &firestore.BatchGetDocumentsResponse_Found{Found: s.cached[0]}
+		// The cached version is the one at its update_time, which is never later than reads of Firestore
+		//    └── キャッシュしたバージョンはupdate_time時点のものであり、Firestoreの読み取りより後になることはない
+		resp.ReadTime = s.cached[0].GetUpdateTime()
+		s.cached = s.cached[1:]
+
+		return nil
+	}
+
+	if s.stream == nil {
+		s.finish()
+		return io.EOF
+	}
+
+	err := s.stream.RecvMsg(msg)
+	if err == io.EOF {
+		s.finish()
+	}
+	if err != nil {
+		return err
+	}
+
+	if resp, ok := msg.(*firestore.BatchGetDocumentsResponse); ok && resp.GetFound() != nil {
+		s.found = append(s.found, proto.Clone(resp.GetFound()).(*firestore.Document))
+	}
+
+	return nil
+}
+
+// finish - Cache the documents fetched from Firestore once.
+//            └── Firestoreから取得したドキュメントを一度だけキャッシュする。
+func (s *batchGetDocumentsStream) finish() {
+	if s.finished {
+		return
+	}
+	s.finished = true
+
+	if s.projectID == "" || s.stream == nil {
+		return
+	}
+
+	s.middleware.afterGetDocuments(s.ctx, s.cachingMode, s.projectID, s.fetched, s.found, s.shadowed)
+}
+
+func (s *batchGetDocumentsStream) Header() (metadata.MD, error) {
+	if s.stream == nil {
+		return metadata.MD{}, nil
+	}
+	return s.stream.Header()
+}
+
+func (s *batchGetDocumentsStream) Trailer() metadata.MD {
+	if s.stream == nil {
+		return metadata.MD{}
+	}
+	return s.stream.Trailer()
+}
+
+func (s *batchGetDocumentsStream) CloseSend() error {
+	if s.stream == nil {
+		return nil
+	}
+	return s.stream.CloseSend()
+}
+
+func (s *batchGetDocumentsStream) Context() context.Context {
+	if s.stream == nil {
+		return s.ctx
+	}
+	return s.stream.Context()
+}
+
+// parseDocumentNames - Convert names of documents in a project to keys.
+//                        └── あるプロジェクトのドキュメントの名前をキーに変換する。
+// ok is false if one of them cannot be cached or they are in different projects.
+//    └── いずれかがキャッシュできない場合や、異なるプロジェクトのものである場合はokはfalseになる。
+func parseDocumentNames(names []string) (keys []*datastore.Key, projectID string, ok bool) {
+	if len(names) == 0 {
+		return nil, "", false
+	}
+
+	for _, name := range names {
+		p, key, ok := parseDocumentName(name)
+		if !ok || (projectID != "" && p != projectID) {
+			return nil, "", false
+		}
+		projectID = p
+		keys = append(keys, key)
+	}
+
+	return keys, projectID, true
+}
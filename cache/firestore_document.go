@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/genproto/googleapis/firestore/v1"
+)
+
+const (
+	// firestoreDefaultDatabase - ID of the default database in names of documents. It is empty in keys.
+	//                              └── ドキュメントの名前でのデフォルトのデータベースのID。キーでは空になる。
+	firestoreDefaultDatabase = "(default)"
+
+	// firestoreCreateTimeProperty - Property holding create_time of a cached document.
+	//                                 └── キャッシュしたドキュメントのcreate_timeを保持するプロパティ。
+	// Firestore reserves field names like __name__, so it never collides with a field.
+	//    └── Firestoreは__name__のようなフィールド名を予約しているため、フィールドとは衝突しない。
+	firestoreCreateTimeProperty = "__create_time__"
+
+	// firestoreUpdateTimeProperty - Property holding update_time of a cached document.
+	//                                 └── キャッシュしたドキュメントのupdate_timeを保持するプロパティ。
+	firestoreUpdateTimeProperty = "__update_time__"
+)
+
+// parseDocumentName - Convert the name of a document to the key it is cached with.
+//                       └── ドキュメントの名前をキャッシュに使うキーに変換する。
+// Each pair of collection and document ID becomes an element of the path, in the empty namespace.
+// Documents in the (default) database share keys with the default database of Datastore mode.
+//    └── コレクションとドキュメントIDの組はそれぞれパスの要素になり、名前空間は空になる。
+//    └── (default)データベースのドキュメントは、Datastoreモードのデフォルトのデータベースとキーを共有する。
+func parseDocumentName(name string) (projectID string, key *datastore.Key, ok bool) {
+	// projects/{project_id}/databases/{database_id}/documents/{document_path}
+	parts := strings.Split(name, "/")
+	if len(parts) < 7 || len(parts)%2 == 0 ||
+		parts[0] != "projects" || parts[2] != "databases" || parts[4] != "documents" {
+		return "", nil, false
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return "", nil, false
+		}
+	}
+
+	key = &datastore.Key{PartitionId: &datastore.PartitionId{ProjectId: parts[1]}}
+	if parts[3] != firestoreDefaultDatabase {
+		key.PartitionId.DatabaseId = parts[3]
+	}
+	for i := 5; i < len(parts); i += 2 {
+		key.Path = append(key.Path, &datastore.Key_PathElement{
+			Kind:   parts[i],
+			IdType: &datastore.Key_PathElement_Name{Name: parts[i+1]},
+		})
+	}
+
+	return parts[1], key, true
+}
+
+// documentName - Convert a key made by parseDocumentName back to the name of the document.
+//                  └── parseDocumentNameで作ったキーをドキュメントの名前に戻す。
+func documentName(projectID string, key *datastore.Key) string {
+	databaseID := key.GetPartitionId().GetDatabaseId()
+	if databaseID == "" {
+		databaseID = firestoreDefaultDatabase
+	}
+
+	parts := []string{"projects", projectID, "databases", databaseID, "documents"}
+	for _, e := range key.GetPath() {
+		parts = append(parts, e.GetKind(), e.GetName())
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// documentToEntity - Convert doc to the entity it is cached as.
+//                      └── docをキャッシュするエンティティに変換する。
+// Each field is kept as a blob of the encoded firestore.Value, and update_time becomes the version.
+// Properties are still named after fields, so PropertyPolicies and Admission apply to documents as well.
+//    └── 各フィールドはエンコードしたfirestore.Valueのblobとして保持し、update_timeをバージョンにする。
+//    └── プロパティ名はフィールド名のままのため、PropertyPoliciesとAdmissionはドキュメントにも適用される。
+func documentToEntity(key *datastore.Key, doc *firestore.Document) (*datastore.EntityResult, error) {
+	properties := make(map[string]*datastore.Value, len(doc.GetFields())+2)
+	for name, value := range doc.GetFields() {
+		buf := proto.NewBuffer(nil)
+		buf.SetDeterministic(true)
+		if err := buf.Marshal(value); err != nil {
+			return nil, xerrors.Errorf("failed to encode field %s of %s: %w", name, doc.GetName(), err)
+		}
+		properties[name] = &datastore.Value{ValueType: &datastore.Value_BlobValue{BlobValue: buf.Bytes()}}
+	}
+
+	properties[firestoreCreateTimeProperty] = &datastore.Value{
+		ValueType: &datastore.Value_TimestampValue{TimestampValue: doc.GetCreateTime()},
+	}
+	properties[firestoreUpdateTimeProperty] = &datastore.Value{
+		ValueType: &datastore.Value_TimestampValue{TimestampValue: doc.GetUpdateTime()},
+	}
+
+	updateTime := doc.GetUpdateTime()
+
+	return &datastore.EntityResult{
+		Entity:  &datastore.Entity{Key: key, Properties: properties},
+		Version: updateTime.GetSeconds()*1000000 + int64(updateTime.GetNanos()/1000),
+	}, nil
+}
+
+// entityToDocument - Convert an entity made by documentToEntity back to the document.
+//                      └── documentToEntityで作ったエンティティをドキュメントに戻す。
+func entityToDocument(projectID string, entity *datastore.EntityResult) (*firestore.Document, error) {
+	doc := &firestore.Document{
+		Name:   documentName(projectID, entity.GetEntity().GetKey()),
+		Fields: map[string]*firestore.Value{},
+	}
+
+	for name, value := range entity.GetEntity().GetProperties() {
+		switch name {
+		case firestoreCreateTimeProperty:
+			doc.CreateTime = value.GetTimestampValue()
+		case firestoreUpdateTimeProperty:
+			doc.UpdateTime = value.GetTimestampValue()
+		default:
+			field := &firestore.Value{}
+			if err := proto.Unmarshal(value.GetBlobValue(), field); err != nil {
+				return nil, xerrors.Errorf("failed to decode field %s of %s: %w", name, doc.Name, err)
+			}
+			doc.Fields[name] = field
+		}
+	}
+
+	if doc.UpdateTime == nil {
+		return nil, xerrors.Errorf("%s was not cached as a document", doc.Name)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,469 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	cds "cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/genproto/googleapis/firestore/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const firestoreDocuments = "projects/project-id/databases/(default)/documents"
+
+// firestoreServer - In-memory google.firestore.v1.Firestore serving documents and counting calls.
+//                     └── ドキュメントを提供し、呼び出しを数えるインメモリのgoogle.firestore.v1.Firestore。
+type firestoreServer struct {
+	firestore.UnimplementedFirestoreServer
+
+	mu        sync.Mutex
+	documents map[string]*firestore.Document
+	calls     map[string]int
+	// requested - Documents requested by the last BatchGetDocuments.
+	//               └── 最後のBatchGetDocumentsで要求されたドキュメント。
+	requested []string
+}
+
+func (s *firestoreServer) count(method string) {
+	s.calls[method]++
+}
+
+func (s *firestoreServer) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[method]
+}
+
+// write - Write doc, or delete the document of name if doc is nil.
+//           └── docを書き込む。docがnilの場合はnameのドキュメントを削除する。
+func (s *firestoreServer) write(name string, doc *firestore.Document) *firestore.Document {
+	if doc == nil {
+		delete(s.documents, name)
+		return nil
+	}
+
+	now := ptypes.TimestampNow()
+	doc = proto.Clone(doc).(*firestore.Document)
+	doc.Name, doc.UpdateTime, doc.CreateTime = name, now, now
+	if current, ok := s.documents[name]; ok {
+		doc.CreateTime = current.CreateTime
+	}
+	s.documents[name] = doc
+
+	return proto.Clone(doc).(*firestore.Document)
+}
+
+func (s *firestoreServer) GetDocument(
+	_ context.Context,
+	req *firestore.GetDocumentRequest,
+) (*firestore.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count("GetDocument")
+
+	doc, ok := s.documents[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s was not found", req.Name)
+	}
+
+	return proto.Clone(doc).(*firestore.Document), nil
+}
+
+func (s *firestoreServer) BatchGetDocuments(
+	req *firestore.BatchGetDocumentsRequest,
+	stream firestore.Firestore_BatchGetDocumentsServer,
+) error {
+	s.mu.Lock()
+	s.count("BatchGetDocuments")
+	s.requested = req.Documents
+
+	responses := make([]*firestore.BatchGetDocumentsResponse, 0, len(req.Documents))
+	for _, name := range req.Documents {
+		resp := &firestore.BatchGetDocumentsResponse{ReadTime: ptypes.TimestampNow()}
+		if doc, ok := s.documents[name]; ok {
+			resp.Result = &firestore.BatchGetDocumentsResponse_Found{Found: proto.Clone(doc).(*firestore.Document)}
+		} else {
+			resp.Result = &firestore.BatchGetDocumentsResponse_Missing{Missing: name}
+		}
+		responses = append(responses, resp)
+	}
+	s.mu.Unlock()
+
+	for _, resp := range responses {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *firestoreServer) CreateDocument(
+	_ context.Context,
+	req *firestore.CreateDocumentRequest,
+) (*firestore.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count("CreateDocument")
+
+	return s.write(req.Parent+"/"+req.CollectionId+"/"+req.DocumentId, req.Document), nil
+}
+
+func (s *firestoreServer) UpdateDocument(
+	_ context.Context,
+	req *firestore.UpdateDocumentRequest,
+) (*firestore.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count("UpdateDocument")
+
+	return s.write(req.Document.Name, req.Document), nil
+}
+
+func (s *firestoreServer) DeleteDocument(
+	_ context.Context,
+	req *firestore.DeleteDocumentRequest,
+) (*empty.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count("DeleteDocument")
+
+	s.write(req.Name, nil)
+
+	return &empty.Empty{}, nil
+}
+
+func (s *firestoreServer) Commit(_ context.Context, req *firestore.CommitRequest) (*firestore.CommitResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count("Commit")
+
+	resp := &firestore.CommitResponse{CommitTime: ptypes.TimestampNow()}
+	for _, w := range req.Writes {
+		if w.GetUpdate() != nil {
+			s.write(w.GetUpdate().Name, w.GetUpdate())
+		} else {
+			s.write(w.GetDelete(), nil)
+		}
+		resp.WriteResults = append(resp.WriteResults, &firestore.WriteResult{UpdateTime: resp.CommitTime})
+	}
+
+	return resp, nil
+}
+
+// startFirestore - Start firestoreServer, and return a client through m.
+//                    └── firestoreServerを起動し、mを通したクライアントを返す。
+func startFirestore(t *testing.T, m *cache.Middleware) (*firestoreServer, firestore.FirestoreClient, func()) {
+	t.Helper()
+
+	srv := &firestoreServer{documents: map[string]*firestore.Document{}, calls: map[string]int{}}
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	firestore.RegisterFirestoreServer(server, srv)
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(m.FirestoreUnaryClientInterceptor),
+		grpc.WithStreamInterceptor(m.FirestoreStreamClientInterceptor),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	return srv, firestore.NewFirestoreClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func stringValue(s string) *firestore.Value {
+	return &firestore.Value{ValueType: &firestore.Value_StringValue{StringValue: s}}
+}
+
+// batchGet - Get documents of names by BatchGetDocuments, and return found documents and missing names.
+//              └── namesのドキュメントをBatchGetDocumentsで取得し、見つかったドキュメントと存在しない名前を返す。
+func batchGet(
+	t *testing.T,
+	client firestore.FirestoreClient,
+	names ...string,
+) (found map[string]*firestore.Document, missing []string) {
+	t.Helper()
+
+	stream, err := client.BatchGetDocuments(context.Background(), &firestore.BatchGetDocumentsRequest{
+		Database:  "projects/project-id/databases/(default)",
+		Documents: names,
+	})
+	if err != nil {
+		t.Fatalf("failed to batch get: %+v", err)
+	}
+
+	found = map[string]*firestore.Document{}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return found, missing
+		}
+		if err != nil {
+			t.Fatalf("failed to receive: %+v", err)
+		}
+
+		if doc := resp.GetFound(); doc != nil {
+			found[doc.Name] = doc
+		} else {
+			missing = append(missing, resp.GetMissing())
+		}
+	}
+}
+
+func TestFirestore(t *testing.T) {
+	c := fake.NewCache()
+	srv, client, stop := startFirestore(t, cache.NewMiddleware(c))
+	defer stop()
+
+	ctx := context.Background()
+	alice := firestoreDocuments + "/users/alice"
+	bob := firestoreDocuments + "/users/bob"
+
+	created, err := client.CreateDocument(ctx, &firestore.CreateDocumentRequest{
+		Parent:       firestoreDocuments,
+		CollectionId: "users",
+		DocumentId:   "alice",
+		Document:     &firestore.Document{Fields: map[string]*firestore.Value{"name": stringValue("alice")}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create: %+v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		doc, err := client.GetDocument(ctx, &firestore.GetDocumentRequest{Name: alice})
+		if err != nil {
+			t.Fatalf("failed to get: %+v", err)
+		}
+		if !proto.Equal(doc, created) {
+			t.Errorf("retrieved document differed: %+v, expected %+v", doc, created)
+		}
+	}
+	if calls := srv.Calls("GetDocument"); calls != 1 {
+		t.Errorf("GetDocument reached Firestore %d times", calls)
+	}
+
+	// Documents are cached with keys of the path in the empty namespace
+	//    └── ドキュメントはパスのキーで空の名前空間にキャッシュされる
+	c.AssertCached(t, cds.NameKey("users", "alice", nil))
+
+	// BatchGetDocuments sends only cache misses
+	//    └── BatchGetDocumentsはキャッシュミスのみを送る
+	found, missing := batchGet(t, client, alice, bob)
+	if !proto.Equal(found[alice], created) || len(missing) != 1 || missing[0] != bob {
+		t.Errorf("unexpected batch get: %+v, %v", found, missing)
+	}
+	if len(srv.requested) != 1 || srv.requested[0] != bob {
+		t.Errorf("unexpected documents were requested: %v", srv.requested)
+	}
+
+	// Cached documents are read at their update_time, not later than reads of Firestore
+	//    └── キャッシュしたドキュメントはFirestoreの読み取りより後ではない、update_time時点で読まれる
+	stream, err := client.BatchGetDocuments(ctx, &firestore.BatchGetDocumentsRequest{
+		Database:  "projects/project-id/databases/(default)",
+		Documents: []string{alice},
+	})
+	if err != nil {
+		t.Fatalf("failed to batch get: %+v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil || !proto.Equal(resp.GetReadTime(), created.GetUpdateTime()) {
+		t.Errorf("unexpected read time of a cached document: %+v, %+v", resp, err)
+	}
+
+	// Documents fetched by BatchGetDocuments are cached
+	//    └── BatchGetDocumentsで取得したドキュメントはキャッシュされる
+	_, err = client.UpdateDocument(ctx, &firestore.UpdateDocumentRequest{
+		Document: &firestore.Document{Name: bob, Fields: map[string]*firestore.Value{"name": stringValue("bob")}},
+	})
+	if err != nil {
+		t.Fatalf("failed to update: %+v", err)
+	}
+	batchGet(t, client, alice, bob)
+	found, _ = batchGet(t, client, alice, bob)
+	if found[bob].GetFields()["name"].GetStringValue() != "bob" {
+		t.Errorf("unexpected batch get: %+v", found)
+	}
+	if calls := srv.Calls("BatchGetDocuments"); calls != 2 {
+		t.Errorf("BatchGetDocuments reached Firestore %d times", calls)
+	}
+
+	// Commit invalidates the cache
+	//    └── Commitはキャッシュを削除する
+	_, err = client.Commit(ctx, &firestore.CommitRequest{
+		Database: "projects/project-id/databases/(default)",
+		Writes: []*firestore.Write{
+			{Operation: &firestore.Write_Update{Update: &firestore.Document{
+				Name:   alice,
+				Fields: map[string]*firestore.Value{"name": stringValue("alice2")},
+			}}},
+			{Operation: &firestore.Write_Delete{Delete: bob}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %+v", err)
+	}
+
+	doc, err := client.GetDocument(ctx, &firestore.GetDocumentRequest{Name: alice})
+	if err != nil || doc.GetFields()["name"].GetStringValue() != "alice2" {
+		t.Errorf("cache was not invalidated: %+v, %+v", doc, err)
+	}
+	if _, err := client.GetDocument(ctx, &firestore.GetDocumentRequest{Name: bob}); status.Code(err) != codes.NotFound {
+		t.Errorf("deleted document was returned: %+v", err)
+	}
+
+	// DeleteDocument invalidates the cache
+	//    └── DeleteDocumentはキャッシュを削除する
+	if _, err := client.DeleteDocument(ctx, &firestore.DeleteDocumentRequest{Name: alice}); err != nil {
+		t.Fatalf("failed to delete: %+v", err)
+	}
+	c.AssertNotCached(t, cds.NameKey("users", "alice", nil))
+
+	// Reads in transactions are not cached
+	//    └── トランザクション内の読み取りはキャッシュされない
+	before := srv.Calls("GetDocument")
+	for i := 0; i < 2; i++ {
+		_, err := client.GetDocument(ctx, &firestore.GetDocumentRequest{
+			Name:                firestoreDocuments + "/users/carol",
+			ConsistencySelector: &firestore.GetDocumentRequest_Transaction{Transaction: []byte("tx")},
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("unexpected error: %+v", err)
+		}
+	}
+	if calls := srv.Calls("GetDocument") - before; calls != 2 {
+		t.Errorf("GetDocument in transactions reached Firestore %d times", calls)
+	}
+
+	// Documents in named databases are cached apart from (default)
+	//    └── 名前付きのデータベースのドキュメントは(default)とは別にキャッシュされる
+	inOther := "projects/project-id/databases/other/documents/users/alice"
+	_, err = client.UpdateDocument(ctx, &firestore.UpdateDocumentRequest{
+		Document: &firestore.Document{Name: inOther, Fields: map[string]*firestore.Value{"name": stringValue("other")}},
+	})
+	if err != nil {
+		t.Fatalf("failed to update: %+v", err)
+	}
+
+	before = srv.Calls("GetDocument")
+	for i := 0; i < 2; i++ {
+		doc, err := client.GetDocument(ctx, &firestore.GetDocumentRequest{Name: inOther})
+		if err != nil || doc.Name != inOther || doc.GetFields()["name"].GetStringValue() != "other" {
+			t.Errorf("unexpected document: %+v, %+v", doc, err)
+		}
+	}
+	if calls := srv.Calls("GetDocument") - before; calls != 1 {
+		t.Errorf("GetDocument in a named database reached Firestore %d times", calls)
+	}
+	c.AssertNotCached(t, cds.NameKey("users", "alice", nil))
+}
+
+func TestFirestore_Shared(t *testing.T) {
+	c := fake.NewCache()
+	counters := cache.NewCounters()
+
+	m := cache.NewMiddleware(c)
+	m.Metrics = counters
+	m.Admission = cache.NewAdmission()
+	m.Admission.MaxSizeByKind = map[string]int{"logs": 1}
+	m.PropertyPolicies = map[string]*cache.PropertyPolicy{
+		"users": {ExcludeProperties: []string{"token"}},
+	}
+
+	srv, client, stop := startFirestore(t, m)
+	defer stop()
+
+	ctx := context.Background()
+
+	for _, name := range []string{"users/alice", "logs/1"} {
+		_, err := client.UpdateDocument(ctx, &firestore.UpdateDocumentRequest{
+			Document: &firestore.Document{
+				Name:   firestoreDocuments + "/" + name,
+				Fields: map[string]*firestore.Value{"name": stringValue("alice"), "token": stringValue("secret")},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to update: %+v", err)
+		}
+	}
+
+	ctx, stats := cache.WithStats(ctx)
+	found, _ := batchGet(t, client, firestoreDocuments+"/users/alice", firestoreDocuments+"/logs/1")
+	if len(found) != 2 || found[firestoreDocuments+"/users/alice"].Fields["token"] == nil {
+		t.Errorf("unexpected batch get: %+v", found)
+	}
+
+	// ExcludeProperties are not cached
+	//    └── ExcludePropertiesはキャッシュされない
+	partial := cache.WithRequiredProperties(ctx)
+	doc, err := client.GetDocument(partial, &firestore.GetDocumentRequest{Name: firestoreDocuments + "/users/alice"})
+	if err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+	if doc.Fields["name"].GetStringValue() != "alice" || doc.Fields["token"] != nil {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+	if calls := srv.Calls("GetDocument"); calls != 0 {
+		t.Errorf("GetDocument reached Firestore %d times", calls)
+	}
+	if len(stats.Served()) != 1 {
+		t.Errorf("unexpected served keys: %v", stats.Served())
+	}
+
+	// Reads requiring an excluded field fall through to Firestore
+	//    └── 除外したフィールドを要求する読み取りはFirestoreから取得する
+	required := cache.WithRequiredProperties(ctx, "token")
+	doc, err = client.GetDocument(required, &firestore.GetDocumentRequest{Name: firestoreDocuments + "/users/alice"})
+	if err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+	if doc.Fields["token"].GetStringValue() != "secret" {
+		t.Errorf("excluded field was not returned: %+v", doc)
+	}
+	if calls := srv.Calls("GetDocument"); calls != 1 {
+		t.Errorf("GetDocument reached Firestore %d times", calls)
+	}
+
+	// Reads without the declaration may need any field and fall through to Firestore
+	//    └── 宣言の無い読み取りは全てのフィールドを必要とし得るため、Firestoreから取得する
+	doc, err = client.GetDocument(ctx, &firestore.GetDocumentRequest{Name: firestoreDocuments + "/users/alice"})
+	if err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+	if doc.Fields["token"].GetStringValue() != "secret" {
+		t.Errorf("document without the excluded field was returned: %+v", doc)
+	}
+	if calls := srv.Calls("GetDocument"); calls != 2 {
+		t.Errorf("GetDocument reached Firestore %d times", calls)
+	}
+
+	// Admission rejects large documents
+	//    └── Admissionは大きいドキュメントを拒否する
+	c.AssertNotCached(t, cds.NameKey("logs", "1", nil))
+	if rejected := counters.Get(cache.MetricRejectedByKindSize, "logs"); rejected != 1 {
+		t.Errorf("rejected was %d", rejected)
+	}
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// FlushFilter - Selects cached entities to flush.
+//                 └── 破棄するキャッシュを選択する。
+// Conditions are combined with AND.
+//    └── 条件はANDで結合される。
+type FlushFilter struct {
+	// ProjectID - Project of the entities. Required.
+	//               └── エンティティのプロジェクト。必須。
+	ProjectID string
+	// DatabaseID - Database of the entities. "" is the default database.
+	//                └── エンティティのデータベース。""はデフォルトのデータベース。
+	DatabaseID string
+	// Namespaces - Namespaces of the entities. All namespaces if empty. "" is the default namespace.
+	//                └── エンティティの名前空間。空の場合は全ての名前空間。""はデフォルトの名前空間。
+	Namespaces []string
+	// Kind - Kind of the entities. All kinds if empty.
+	//          └── エンティティのkind。空の場合は全てのkind。
+	Kind string
+	// Ancestor - Flush Ancestor itself and its descendants. All keys if nil.
+	//              └── Ancestor自身とその子孫を破棄する。nilの場合は全てのキー。
+	Ancestor *datastore.Key
+}
+
+// Flusher - Optional interface of Cache that flushes entities in bulk.
+//             └── キャッシュを一括で破棄する、Cacheの任意のインターフェイス。
+// It is used when data is changed directly in Datastore, for example by a backfill.
+//    └── バックフィルなど、Datastoreのデータを直接変更した場合に使う。
+type Flusher interface {
+	// Flush - Delete the entities selected by filter, and return how many were deleted.
+	//           └── filterで選択したキャッシュを削除し、削除した数を返す。
+	// With dryRun, nothing is deleted and the number of matching entities is returned.
+	//    └── dryRunの場合は何も削除せず、一致したキャッシュの数を返す。
+	Flush(ctx context.Context, filter *FlushFilter, dryRun bool) (n int64, err error)
+}
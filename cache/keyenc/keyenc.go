@@ -0,0 +1,233 @@
+/*
+Package keyenc - This package provides a reversible string encoding of Datastore keys
+shared by cache backends and tools.
+...
+このパッケージではキャッシュのバックエンドやツールで共有する、Datastoreのキーの可逆な文字列エンコーディングを提供します。
+
+Format:
+
+	project:namespace:Kind1:i:123:Kind2:n:name
+	project/database:namespace:Kind1:i:123
+
+Segments are separated by ":". Inside a segment, "\" and ":" are escaped with "\".
+Numeric IDs are written as "i:" followed by the decimal ID, and names as "n:" followed by the escaped name.
+Because every segment is escaped, the encoding of an ancestor followed by ":" is a prefix
+of the encodings of all its descendants.
+Keys in a database other than the default one have its ID after the project, separated by "/".
+"/" is not escaped, so project IDs must not contain it, as those of Google Cloud never do.
+    └── セグメントは":"で区切られ、セグメント内の"\"と":"は"\"でエスケープされる。
+    └── 数値IDは"i:"に続けて10進数で、名前は"n:"に続けてエスケープした名前で書かれる。
+    └── 全てのセグメントがエスケープされるため、祖先のエンコーディングに":"を続けたものは全ての子孫のエンコーディングの接頭辞となる。
+    └── デフォルト以外のデータベースのキーは、プロジェクトの後に"/"で区切ってデータベースのIDを持つ。
+    └── "/"はエスケープされないため、Google CloudのプロジェクトIDと同様に、プロジェクトIDに含めてはならない。
+*/
+package keyenc
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	separator = ':'
+	escape    = '\\'
+
+	typeID   = "i"
+	typeName = "n"
+
+	// databaseSeparator - Separates the project and the database. It is not escaped in the project ID.
+	//                       └── プロジェクトとデータベースを区切る。プロジェクトIDの中ではエスケープされない。
+	databaseSeparator = "/"
+)
+
+// Escape - Escape "\" and ":" in str.
+//            └── str内の"\"と":"をエスケープする。
+func Escape(str string) string {
+	str = strings.ReplaceAll(str, "\\", "\\\\")
+	str = strings.ReplaceAll(str, ":", "\\:")
+
+	return str
+}
+
+// Encode - Encode key.
+//            └── keyをエンコードする。
+// projectID is used when the key does not have the project of its own.
+// An empty string is returned for an incomplete key.
+//    └── keyがプロジェクトを持たない場合はprojectIDを使う。不完全なキーの場合は空文字列を返す。
+func Encode(projectID string, key *datastore.Key) string {
+	path := encodePath(key.GetPath())
+
+	if path == "" {
+		return ""
+	}
+
+	var namespaceID, databaseID string
+
+	if key.PartitionId != nil {
+		if key.PartitionId.ProjectId != "" {
+			projectID = key.PartitionId.ProjectId
+		}
+
+		namespaceID = key.PartitionId.NamespaceId
+		databaseID = key.PartitionId.DatabaseId
+	}
+
+	return PartitionPrefix(Project(projectID, databaseID), namespaceID) + path
+}
+
+// Project - The project segment of the keys in the database of the project.
+//             └── プロジェクトのデータベースにあるキーのプロジェクトのセグメント。
+// The default database, whose ID is empty, is the project itself, so keys encoded before databases stay valid.
+// Pass it as projectID of the prefixes to select keys in the database.
+//    └── IDが空のデフォルトのデータベースはプロジェクトそのものになるため、データベース以前にエンコードしたキーは有効なままとなる。
+//    └── データベースのキーを選択するには、接頭辞のprojectIDとして渡す。
+func Project(projectID, databaseID string) string {
+	if databaseID == "" {
+		return projectID
+	}
+
+	return projectID + databaseSeparator + databaseID
+}
+
+// Decode - Decode a string encoded by Encode.
+//            └── Encodeでエンコードされた文字列をデコードする。
+func Decode(encoded string) (*datastore.Key, error) {
+	segments := Split(encoded)
+
+	// project, namespace and at least one triple of kind, ID type and ID
+	if len(segments) < 5 || (len(segments)-2)%3 != 0 {
+		return nil, xerrors.Errorf("invalid number of segments: %d", len(segments))
+	}
+
+	projectID, databaseID := segments[0], ""
+	if i := strings.Index(projectID, databaseSeparator); i >= 0 {
+		projectID, databaseID = projectID[:i], projectID[i+len(databaseSeparator):]
+	}
+
+	key := &datastore.Key{
+		PartitionId: &datastore.PartitionId{
+			ProjectId:   projectID,
+			DatabaseId:  databaseID,
+			NamespaceId: segments[1],
+		},
+		Path: make([]*datastore.Key_PathElement, 0, (len(segments)-2)/3),
+	}
+
+	for i := 2; i < len(segments); i += 3 {
+		element := &datastore.Key_PathElement{
+			Kind: segments[i],
+		}
+
+		switch segments[i+1] {
+		case typeID:
+			id, err := strconv.ParseInt(segments[i+2], 10, 64)
+			if err != nil {
+				return nil, xerrors.Errorf("invalid ID %q: %w", segments[i+2], err)
+			}
+			element.IdType = &datastore.Key_PathElement_Id{Id: id}
+		case typeName:
+			element.IdType = &datastore.Key_PathElement_Name{Name: segments[i+2]}
+		default:
+			return nil, xerrors.Errorf("invalid ID type: %q", segments[i+1])
+		}
+
+		key.Path = append(key.Path, element)
+	}
+
+	return key, nil
+}
+
+// Split - Split an encoded string into unescaped segments.
+//           └── エンコードされた文字列をエスケープを解除したセグメントに分割する。
+func Split(encoded string) []string {
+	segments := make([]string, 0, strings.Count(encoded, ":")+1)
+
+	var segment strings.Builder
+
+	for i := 0; i < len(encoded); i++ {
+		switch encoded[i] {
+		case escape:
+			if i+1 < len(encoded) {
+				i++
+				segment.WriteByte(encoded[i])
+			}
+		case separator:
+			segments = append(segments, segment.String())
+			segment.Reset()
+		default:
+			segment.WriteByte(encoded[i])
+		}
+	}
+
+	return append(segments, segment.String())
+}
+
+// Kind - Get the kind of the entity from an encoded string without decoding the whole key.
+//          └── キー全体をデコードせずに、エンコードされた文字列からエンティティのkindを取得する。
+func Kind(encoded string) (string, error) {
+	segments := Split(encoded)
+
+	if len(segments) < 5 || (len(segments)-2)%3 != 0 {
+		return "", xerrors.Errorf("invalid number of segments: %d", len(segments))
+	}
+
+	return segments[len(segments)-3], nil
+}
+
+// PartitionPrefix - Prefix of the encodings of all keys in the namespace of the project.
+//                     └── プロジェクトの名前空間にある全てのキーのエンコーディングの接頭辞。
+func PartitionPrefix(projectID, namespaceID string) string {
+	return Escape(projectID) + ":" + Escape(namespaceID) + ":"
+}
+
+// KindPrefix - Prefix of the encodings of all root entities of kind in the namespace of the project.
+//                └── プロジェクトの名前空間にある、祖先を持たないkindの全てのエンティティのエンコーディングの接頭辞。
+// Entities of kind that have ancestors cannot be selected by a prefix; check them with Kind.
+//    └── 祖先を持つkindのエンティティは接頭辞では選択できないため、Kindで確認すること。
+func KindPrefix(projectID, namespaceID, kind string) string {
+	return PartitionPrefix(projectID, namespaceID) + Escape(kind) + ":"
+}
+
+// AncestorPrefix - Prefix of the encodings of all descendants of ancestor.
+//                    └── ancestorの全ての子孫のエンコーディングの接頭辞。
+// The ancestor itself is not included. An empty string is returned for an incomplete key.
+//    └── ancestor自身は含まない。不完全なキーの場合は空文字列を返す。
+func AncestorPrefix(projectID string, ancestor *datastore.Key) string {
+	encoded := Encode(projectID, ancestor)
+
+	if encoded == "" {
+		return ""
+	}
+
+	return encoded + ":"
+}
+
+// encodePath - Encode the path of a key, or return an empty string if it is incomplete.
+//                └── キーのパスをエンコードする。不完全な場合は空文字列を返す。
+func encodePath(path []*datastore.Key_PathElement) string {
+	if len(path) == 0 {
+		return ""
+	}
+
+	elements := make([]string, 0, len(path))
+
+	for _, p := range path {
+		var id string
+
+		switch idType := p.GetIdType().(type) {
+		case *datastore.Key_PathElement_Id:
+			id = typeID + ":" + strconv.FormatInt(idType.Id, 10)
+		case *datastore.Key_PathElement_Name:
+			id = typeName + ":" + Escape(idType.Name)
+		default:
+			return ""
+		}
+
+		elements = append(elements, Escape(p.Kind)+":"+id)
+	}
+
+	return strings.Join(elements, ":")
+}
@@ -0,0 +1,77 @@
+//go:build go1.18
+// +build go1.18
+
+package keyenc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func FuzzEncodeDecode(f *testing.F) {
+	f.Add("project", "database", "namespace", "Parent", int64(1), "Child", "name")
+	f.Add("p:j", "d:b", "", "k\\1", int64(-1), ":", "\\:")
+	f.Add("", "", "", "", int64(0), "", "")
+
+	f.Fuzz(func(
+		t *testing.T,
+		projectID, databaseID, namespaceID, parentKind string,
+		id int64,
+		childKind, name string,
+	) {
+		// the project segment does not escape the database separator
+		if strings.Contains(projectID, databaseSeparator) {
+			t.Skip()
+		}
+
+		key := &datastore.Key{
+			PartitionId: &datastore.PartitionId{
+				ProjectId:   projectID,
+				DatabaseId:  databaseID,
+				NamespaceId: namespaceID,
+			},
+			Path: []*datastore.Key_PathElement{
+				{Kind: parentKind, IdType: &datastore.Key_PathElement_Id{Id: id}},
+				{Kind: childKind, IdType: &datastore.Key_PathElement_Name{Name: name}},
+			},
+		}
+
+		encoded := Encode("", key)
+
+		decoded, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("failed to decode %q: %+v", encoded, err)
+		}
+
+		if diff := cmp.Diff(key, decoded, ignoreXXX); diff != "" {
+			t.Errorf("decoded key of %q differed: %s", encoded, diff)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add("project:namespace:Kind:i:1")
+	f.Add("p\\:j::Kind:n:a\\\\b")
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		key, err := Decode(encoded)
+		if err != nil {
+			return
+		}
+
+		// anything that decodes must encode back to a string that decodes to the same key
+		reencoded := Encode("", key)
+
+		decoded, err := Decode(reencoded)
+		if err != nil {
+			t.Fatalf("failed to decode re-encoded %q: %+v", reencoded, err)
+		}
+
+		if diff := cmp.Diff(key, decoded, ignoreXXX); diff != "" {
+			t.Errorf("decoded key of %q differed: %s", reencoded, diff)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package keyenc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+var ignoreXXX = cmp.FilterPath(func(path cmp.Path) bool {
+	return !strings.HasPrefix(path.Last().String(), "XXX_")
+}, cmp.Ignore())
+
+func testEscape(t *testing.T, query, expected string) {
+	t.Helper()
+	actual := Escape(query)
+
+	if expected != actual {
+		t.Errorf("the escaped key differed:\nactual  : %s\nexpected: %s", actual, expected)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	testEscape(t, "abc:abc", "abc\\:abc")
+	testEscape(t, "abc\\abc", "abc\\\\abc")
+	testEscape(t, "abc:\\:abc", "abc\\:\\\\\\:abc")
+	testEscape(t, "abc:\\\\abc", "abc\\:\\\\\\\\abc")
+}
+
+func testEncode(t *testing.T, expected string, query *datastore.Key) {
+	t.Helper()
+
+	actual := Encode("project", query)
+
+	if expected != actual {
+		t.Errorf("the encoded key differed:\nactual  : %s\nexpected: %s", actual, expected)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	testEncode(
+		t,
+		"pj:ns:kind1:i:10",
+		&datastore.Key{
+			PartitionId: &datastore.PartitionId{
+				ProjectId:   "pj",
+				NamespaceId: "ns",
+			},
+			Path: []*datastore.Key_PathElement{
+				{
+					Kind:   "kind1",
+					IdType: &datastore.Key_PathElement_Id{Id: 10},
+				},
+			},
+		},
+	)
+
+	testEncode(
+		t,
+		"pj:ns:kind1:i:10:kind2:n:abc:kind3:i:11",
+		&datastore.Key{
+			PartitionId: &datastore.PartitionId{
+				ProjectId:   "pj",
+				NamespaceId: "ns",
+			},
+			Path: []*datastore.Key_PathElement{
+				{
+					Kind:   "kind1",
+					IdType: &datastore.Key_PathElement_Id{Id: 10},
+				},
+				{
+					Kind:   "kind2",
+					IdType: &datastore.Key_PathElement_Name{Name: "abc"},
+				},
+				{
+					Kind:   "kind3",
+					IdType: &datastore.Key_PathElement_Id{Id: 11},
+				},
+			},
+		},
+	)
+
+	testEncode(
+		t,
+		"project::kind1:i:10:kind2:n:abc:kind3:i:11",
+		&datastore.Key{
+			PartitionId: nil,
+			Path: []*datastore.Key_PathElement{
+				{
+					Kind:   "kind1",
+					IdType: &datastore.Key_PathElement_Id{Id: 10},
+				},
+				{
+					Kind:   "kind2",
+					IdType: &datastore.Key_PathElement_Name{Name: "abc"},
+				},
+				{
+					Kind:   "kind3",
+					IdType: &datastore.Key_PathElement_Id{Id: 11},
+				},
+			},
+		},
+	)
+
+	// the default database is the project itself
+	testEncode(
+		t,
+		"pj/db:ns:kind1:i:10",
+		&datastore.Key{
+			PartitionId: &datastore.PartitionId{
+				ProjectId:   "pj",
+				DatabaseId:  "db",
+				NamespaceId: "ns",
+			},
+			Path: []*datastore.Key_PathElement{
+				{
+					Kind:   "kind1",
+					IdType: &datastore.Key_PathElement_Id{Id: 10},
+				},
+			},
+		},
+	)
+
+	testEncode(
+		t,
+		"",
+		&datastore.Key{
+			Path: []*datastore.Key_PathElement{
+				{
+					Kind: "incomplete",
+				},
+			},
+		},
+	)
+}
+
+func TestDecode(t *testing.T) {
+	key := &datastore.Key{
+		PartitionId: &datastore.PartitionId{
+			ProjectId:   "p:j",
+			NamespaceId: "n\\s",
+		},
+		Path: []*datastore.Key_PathElement{
+			{
+				Kind:   "kind:1",
+				IdType: &datastore.Key_PathElement_Id{Id: -10},
+			},
+			{
+				Kind:   "kind2",
+				IdType: &datastore.Key_PathElement_Name{Name: "a:b\\c"},
+			},
+		},
+	}
+
+	decoded, err := Decode(Encode("project", key))
+	if err != nil {
+		t.Fatalf("failed to decode: %+v", err)
+	}
+
+	if diff := cmp.Diff(key, decoded, ignoreXXX); diff != "" {
+		t.Errorf("decoded key differed: %s", diff)
+	}
+
+	key.PartitionId.DatabaseId = "db"
+
+	decoded, err = Decode(Encode("project", key))
+	if err != nil {
+		t.Fatalf("failed to decode: %+v", err)
+	}
+
+	if diff := cmp.Diff(key, decoded, ignoreXXX); diff != "" {
+		t.Errorf("decoded key in a database differed: %s", diff)
+	}
+
+	for _, invalid := range []string{"", "pj:ns:", "pj:ns:kind:x:1", "pj:ns:kind:i:abc", "pj:ns:kind:i:1:kind2"} {
+		if _, err := Decode(invalid); err == nil {
+			t.Errorf("%q must be invalid", invalid)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	parent := &datastore.Key{
+		Path: []*datastore.Key_PathElement{
+			{Kind: "Parent", IdType: &datastore.Key_PathElement_Id{Id: 1}},
+		},
+	}
+	child := &datastore.Key{
+		Path: append(parent.Path, &datastore.Key_PathElement{
+			Kind: "Child", IdType: &datastore.Key_PathElement_Name{Name: "x"},
+		}),
+	}
+	other := &datastore.Key{
+		Path: []*datastore.Key_PathElement{
+			{Kind: "Parent", IdType: &datastore.Key_PathElement_Id{Id: 10}},
+		},
+	}
+
+	if !strings.HasPrefix(Encode("pj", child), AncestorPrefix("pj", parent)) {
+		t.Errorf("descendant must have the ancestor prefix")
+	}
+
+	if strings.HasPrefix(Encode("pj", other), AncestorPrefix("pj", parent)) {
+		t.Errorf("sibling must not have the ancestor prefix")
+	}
+
+	if !strings.HasPrefix(Encode("pj", other), KindPrefix("pj", "", "Parent")) {
+		t.Errorf("root entity must have the kind prefix")
+	}
+
+	if strings.HasPrefix(Encode("pj", &datastore.Key{
+		PartitionId: &datastore.PartitionId{DatabaseId: "db"},
+		Path:        other.Path,
+	}), KindPrefix("pj", "", "Parent")) {
+		t.Errorf("entity in another database must not have the kind prefix")
+	}
+
+	if kind, err := Kind(Encode("pj", child)); err != nil || kind != "Child" {
+		t.Errorf("kind differed: %s, %+v", kind, err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	key := Encode("pj", &datastore.Key{
+		PartitionId: &datastore.PartitionId{NamespaceId: "n:s"},
+		Path: []*datastore.Key_PathElement{
+			{Kind: "kind1", IdType: &datastore.Key_PathElement_Name{Name: "a\\b:c"}},
+		},
+	})
+
+	expected := []string{"pj", "n:s", "kind1", "n", "a\\b:c"}
+
+	if diff := cmp.Diff(expected, Split(key)); diff != "" {
+		t.Errorf("split key differed: %s", diff)
+	}
+}
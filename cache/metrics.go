@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"sync"
+
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// Metrics - Receives counters about the cache.
+//             └── キャッシュに関するカウンタを受け取る。
+// Implement this interface to forward the counters to any monitoring system.
+//    └── このインターフェイスを実装することで、任意の監視システムにカウンタを送ることができる。
+type Metrics interface {
+	// Add - Add delta to the counter identified by name and kind.
+	//         └── nameとkindで識別されるカウンタにdeltaを加算する。
+	Add(name, kind string, delta int64)
+}
+
+const (
+	// MetricDecodeFailures - Number of cached entries that could not be decoded.
+	//                          └── デコードできなかったキャッシュエントリの数。
+	MetricDecodeFailures = "decode_failures"
+
+	// MetricSignatureFailures - Number of cached entries whose signature could not be verified.
+	//                             └── 署名を検証できなかったキャッシュエントリの数。
+	MetricSignatureFailures = "signature_failures"
+)
+
+// Counters - Metrics that keeps the counters in memory.
+//              └── カウンタをメモリ上に保持するMetrics。
+type Counters struct {
+	mu       sync.RWMutex
+	counters map[string]map[string]int64
+}
+
+var _ Metrics = &Counters{}
+
+// NewCounters - Initialize Counters.
+//                 └── Countersを初期化する。
+func NewCounters() *Counters {
+	return &Counters{
+		counters: map[string]map[string]int64{},
+	}
+}
+
+// Add - Add delta to the counter identified by name and kind.
+//         └── nameとkindで識別されるカウンタにdeltaを加算する。
+func (c *Counters) Add(name, kind string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kinds, ok := c.counters[name]
+	if !ok {
+		kinds = map[string]int64{}
+		c.counters[name] = kinds
+	}
+	kinds[kind] += delta
+}
+
+// Get - Get the counter identified by name and kind.
+//         └── nameとkindで識別されるカウンタを取得する。
+func (c *Counters) Get(name, kind string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.counters[name][kind]
+}
+
+// Snapshot - Copy all counters, indexed by name and then by kind.
+//              └── 全てのカウンタを名前、kindの順に索引してコピーする。
+func (c *Counters) Snapshot() map[string]map[string]int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := make(map[string]map[string]int64, len(c.counters))
+	for name, kinds := range c.counters {
+		snapshot[name] = make(map[string]int64, len(kinds))
+		for kind, v := range kinds {
+			snapshot[name][kind] = v
+		}
+	}
+
+	return snapshot
+}
+
+// KindOf - Get the kind of the entity pointed by key.
+//            └── keyが指すエンティティのkindを取得する。
+func KindOf(key *datastore.Key) string {
+	if len(key.GetPath()) == 0 {
+		return ""
+	}
+
+	return key.Path[len(key.Path)-1].Kind
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func TestCounters(t *testing.T) {
+	c := NewCounters()
+
+	c.Add(MetricDecodeFailures, "a", 1)
+	c.Add(MetricDecodeFailures, "a", 2)
+	c.Add(MetricDecodeFailures, "b", 1)
+
+	if v := c.Get(MetricDecodeFailures, "a"); v != 3 {
+		t.Errorf("counter differed: %d (expected: %d)", v, 3)
+	}
+
+	snapshot := c.Snapshot()
+	c.Add(MetricDecodeFailures, "b", 1)
+
+	if v := snapshot[MetricDecodeFailures]["b"]; v != 1 {
+		t.Errorf("snapshot was modified: %d (expected: %d)", v, 1)
+	}
+
+	if v := c.Get(MetricDecodeFailures, "c"); v != 0 {
+		t.Errorf("unknown counter must be zero: %d", v)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	if kind := KindOf(testKeys2[0]); kind != "a" {
+		t.Errorf("kind differed: %s (expected: %s)", kind, "a")
+	}
+
+	if kind := KindOf(&datastore.Key{}); kind != "" {
+		t.Errorf("kind of an empty key must be empty: %s", kind)
+	}
+}
@@ -21,7 +21,21 @@ type Middleware struct {
 	// CachingModeFunc - A function that individually manages cache deletion and status.
 	//                     └── Cacheの削除や状態を個別に管理する関数。
 	CachingModeFunc CachingModeFunc
-	Logger          *log.Logger
+	// Admission - Decides which entities are cached after Lookup. All entities are cached if nil.
+	//               └── Lookup後にキャッシュするエンティティを決める。nilの場合は全てキャッシュする。
+	Admission *Admission
+	// PropertyPolicies - Transformation of entities around the cache, indexed by kind.
+	//                      └── kindごとのキャッシュ前後のエンティティの変換。
+	PropertyPolicies map[string]*PropertyPolicy
+	// Metrics - Receives counters such as rejected entities. Nothing is reported if nil.
+	//             └── 拒否したエンティティ数などのカウンタを受け取る。nilの場合は何も送らない。
+	Metrics Metrics
+	// ShadowKinds - Kinds whose cache hits are verified against Datastore instead of being returned.
+	//                 └── キャッシュヒットを返す代わりにDatastoreと照合するkind。
+	// Lookup of these kinds always returns the reply of Datastore, and mismatches are reported to Metrics.
+	//    └── これらのkindのLookupは常にDatastoreの応答を返し、不一致はMetricsに送られる。
+	ShadowKinds map[string]bool
+	Logger      *log.Logger
 }
 
 // UnaryClientMethod - Datastore invocation method
@@ -69,10 +83,8 @@ func (m *Middleware) UnaryClientInterceptor(
 	invoker grpc.UnaryInvoker,
 	opts ...grpc.CallOption,
 ) (err error) {
-	cachingMode := CachingModeReadWrite
-	if m.CachingModeFunc != nil {
-		cachingMode = m.CachingModeFunc(ctx, method, req, reply, cc, invoker, opts...)
-	}
+	ctx = withOutgoingCacheControl(ctx)
+	cachingMode := m.cachingMode(ctx, method, req, reply, cc, invoker, opts...)
 
 	switch method {
 	case UnaryClientMethodLookup:
@@ -106,6 +118,31 @@ func (m *Middleware) UnaryClientInterceptor(
 	}
 }
 
+// cachingMode - Decide CachingModeType of a call by CachingModeFunc and the decision of the caller.
+//                 └── CachingModeFuncと呼び出し元の決定により、呼び出しのCachingModeTypeを決める。
+func (m *Middleware) cachingMode(
+	ctx context.Context,
+	method string, req,
+	reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) CachingModeType {
+	cachingMode := CachingModeReadWrite
+	if m.CachingModeFunc != nil {
+		cachingMode = m.CachingModeFunc(ctx, method, req, reply, cc, invoker, opts...)
+	}
+
+	// Narrow by the decision of the caller
+	//    └── 呼び出し元の決定により狭める
+	if control, ok := cacheControlFrom(ctx); ok {
+		mode, _ := control.cachingMode()
+		cachingMode &= mode
+	}
+
+	return cachingMode
+}
+
 // lookup - Process at Lookup of Datastore.
 //            └── DatastoreのLookupのときの処理
 func (m *Middleware) lookup(
@@ -118,16 +155,26 @@ func (m *Middleware) lookup(
 	invoker grpc.UnaryInvoker,
 	opts ...grpc.CallOption,
 ) (err error) {
-	// Do not include if transaction is valid
-	//    └── トランザクションが有効であれば対象としない
-	if req.GetReadOptions().GetTransaction() != nil || cachingMode == CachingModeNever {
-		return invoker(ctx, method, req, reply, cc, opts...)
+	// Do not include reads in a transaction or at a point in time
+	//    └── トランザクション内や特定の時点の読み取りは対象としない
+	if !cacheableReadOptions(req.GetReadOptions()) || cachingMode == CachingModeNever {
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			statsFrom(ctx).add(statsFetched, req.Keys...)
+		}
+		return err
 	}
 
+	// Keys of other databases than the default one are cached with the database
+	//    └── デフォルト以外のデータベースのキーはデータベースと共にキャッシュする
+	req.Keys = withDatabase(req.DatabaseId, req.Keys)
+
+	var shadowed []*datastore.EntityResult
+
 	// Get cache
 	//    └── キャッシュの取得
 	if cachingMode&CachingModeReadOnly != 0 {
-		err = m.beforeLookup(ctx, req, reply)
+		shadowed, err = m.beforeLookup(ctx, req, reply)
 		if err != nil {
 			err = xerrors.Errorf("search on cache before Lookup failed: %w", err)
 			m.logPrintError(err)
@@ -145,43 +192,79 @@ func (m *Middleware) lookup(
 	if err != nil {
 		return err
 	}
+	statsFrom(ctx).add(statsFetched, req.Keys...)
+
+	for _, e := range invokerReply.Found {
+		setDatabase(req.DatabaseId, e.GetEntity().GetKey())
+	}
+
+	// Verify cache of ShadowKinds
+	//    └── ShadowKindsのキャッシュの検証
+	m.compareShadowed(req.ProjectId, shadowed, invokerReply)
 
 	// Save cache
 	//    └── キャッシュの保存
 	if cachingMode&CachingModeWriteOnly != 0 {
 		err = m.afterLookup(ctx, req, invokerReply)
-		err = xerrors.Errorf("cache after Lookup failed: %w", err)
-		m.logPrintError(err)
+		if err != nil {
+			err = xerrors.Errorf("cache after Lookup failed: %w", err)
+			m.logPrintError(err)
+		}
 	}
 
 	reply.Found = append(reply.Found, invokerReply.Found...)
 	reply.Missing = invokerReply.Missing
 	reply.Deferred = invokerReply.Deferred
+	reply.Transaction = invokerReply.Transaction
+	reply.ReadTime = invokerReply.ReadTime
 
 	return nil
 }
 
+// cacheableReadOptions - Whether a Lookup with options may be answered from the cache.
+//                          └── optionsを持つLookupにキャッシュから応答してよいか。
+// Reads with any read consistency, or without options, are cached.
+// Reads in a transaction, that begin a new transaction or at a read time go to Datastore.
+//    └── オプションを持たないもの、任意の読み取り整合性を指定したものをキャッシュする。
+//    └── トランザクション内、新しいトランザクションを開始する、読み取り時刻を指定した読み取りはDatastoreに送る。
+func cacheableReadOptions(options *datastore.ReadOptions) bool {
+	switch options.GetConsistencyType().(type) {
+	case nil, *datastore.ReadOptions_ReadConsistency_:
+		return true
+	default:
+		return false
+	}
+}
+
 // beforeLookup - Called before Lookup.
 //                  └── Lookup前に呼ばれる
+// Cache hits of ShadowKinds are returned as shadowed, and left in req.Keys.
+//    └── ShadowKindsのキャッシュヒットはshadowedとして返し、req.Keysに残す。
 func (m *Middleware) beforeLookup(
 	ctx context.Context,
 	req *datastore.LookupRequest,
 	reply *datastore.LookupResponse,
-) (err error) {
+) (shadowed []*datastore.EntityResult, err error) {
 	cacheKeys := req.Keys
 	items, err := m.cache.GetMulti(ctx, req.ProjectId, cacheKeys)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(items) != len(req.Keys) {
-		return xerrors.Errorf("cache middleware should return %d, but returned %d", len(req.Keys), len(items))
+		return nil, xerrors.Errorf("cache middleware should return %d, but returned %d", len(req.Keys), len(items))
 	}
 
+	shadowed = m.takeShadowed(req.Keys, items)
+	m.transformAfterRetrieve(ctx, req.Keys, items)
+
+	stats := statsFrom(ctx)
 	nonCachedKeys := make([]*datastore.Key, 0, len(req.Keys))
 	for i := range items {
 		if items[i] == nil {
 			nonCachedKeys = append(nonCachedKeys, req.Keys[i])
+		} else {
+			stats.add(statsServed, req.Keys[i])
 		}
 	}
 
@@ -197,7 +280,7 @@ func (m *Middleware) beforeLookup(
 	reply.Found = items
 	req.Keys = nonCachedKeys
 
-	return nil
+	return shadowed, nil
 }
 
 // afterLookup - Called after Lookup.
@@ -207,11 +290,40 @@ func (m *Middleware) afterLookup(
 	req *datastore.LookupRequest,
 	reply *datastore.LookupResponse,
 ) (err error) {
-	entities := reply.GetFound()
+	entities := m.admit(req.ProjectId, m.transformBeforeCache(reply.GetFound()))
 	if len(entities) < 1 {
 		return nil
 	}
-	return m.cache.SetMulti(ctx, req.ProjectId, entities)
+
+	if err := m.cache.SetMulti(ctx, req.ProjectId, entities); err != nil {
+		return err
+	}
+
+	stats := statsFrom(ctx)
+	for _, e := range entities {
+		stats.add(statsWritten, e.GetEntity().GetKey())
+	}
+
+	return nil
+}
+
+// admit - Filter entities by Admission.
+//           └── Admissionによりエンティティを絞り込む。
+func (m *Middleware) admit(projectID string, entities []*datastore.EntityResult) []*datastore.EntityResult {
+	if m.Admission == nil {
+		return entities
+	}
+
+	admitted := make([]*datastore.EntityResult, 0, len(entities))
+	for _, e := range entities {
+		if reason := m.Admission.admit(e, m.sizeFunc(projectID)); reason != "" {
+			m.addMetric(reason, e.GetEntity().GetKey(), 1)
+			continue
+		}
+		admitted = append(admitted, e)
+	}
+
+	return admitted
 }
 
 // commit - Processing at Commit.
@@ -244,7 +356,7 @@ func (m *Middleware) commit(
 
 	// Clear cache
 	//    └── キャッシュの削除
-	err = m.afterCommit(ctx, req, cachingMode)
+	err = m.afterCommit(ctx, req, reply, cachingMode)
 	if err != nil {
 		err = xerrors.Errorf("cache after commit failed: %w", err)
 		m.logPrintError(err)
@@ -259,28 +371,67 @@ func (m *Middleware) beforeCommit(
 	req *datastore.CommitRequest,
 	cachingMode CachingModeType,
 ) (err error) {
-	if m.CacheDeleteTiming&DeleteTimingBeforeCommit == 0 && cachingMode&CachingModeWriteOnly == 0 {
+	if !m.deletesBeforeCommit(cachingMode) {
 		return nil
 	}
-	return m.deleteCache(ctx, req)
+	return m.deleteCache(ctx, req, nil)
 }
 
 // afterCommit - Called after Commit.
 //                 └── Commit後に呼ばれる
+// Keys allocated by Datastore for incomplete keys are only known from reply, so they are deleted here
+// even if the cache is deleted only before Commit.
+//    └── 不完全なキーにDatastoreが割り当てたキーはreplyからしか分からないため、
+//    └── Commit前にのみキャッシュを削除する場合でもここで削除する。
 func (m *Middleware) afterCommit(
 	ctx context.Context,
 	req *datastore.CommitRequest,
+	reply *datastore.CommitResponse,
 	cachingMode CachingModeType,
 ) (err error) {
-	if m.CacheDeleteTiming&DeleteTimingAfterCommit == 0 && cachingMode&CachingModeWriteOnly == 0 {
+	switch {
+	case m.deletesAfterCommit(cachingMode):
+		return m.deleteCache(ctx, req, reply)
+	case m.deletesBeforeCommit(cachingMode):
+		resolved := resolvedKeys(reply)
+		if len(resolved) == 0 {
+			return nil
+		}
+		return m.deleteKeys(ctx, req, resolved)
+	default:
 		return nil
 	}
-	return m.deleteCache(ctx, req)
+}
+
+// deletesBeforeCommit - Whether the cache is deleted before Commit.
+//                         └── Commit前にキャッシュを削除するかどうか。
+func (m *Middleware) deletesBeforeCommit(cachingMode CachingModeType) bool {
+	return m.CacheDeleteTiming&DeleteTimingBeforeCommit != 0 || cachingMode&CachingModeWriteOnly != 0
+}
+
+// deletesAfterCommit - Whether the cache is deleted after Commit.
+//                        └── Commit後にキャッシュを削除するかどうか。
+func (m *Middleware) deletesAfterCommit(cachingMode CachingModeType) bool {
+	return m.CacheDeleteTiming&DeleteTimingAfterCommit != 0 || cachingMode&CachingModeWriteOnly != 0
 }
 
 // deleteCache - Delete Cache.
 //                 └── CacheをDeleteさせる
-func (m *Middleware) deleteCache(ctx context.Context, req *datastore.CommitRequest) (err error) {
+// Keys written by req are merged with those allocated by Datastore in reply, which is nil before Commit.
+//    └── reqが書き込むキーと、replyでDatastoreが割り当てたキーを合わせる。Commit前のreplyはnilとなる。
+func (m *Middleware) deleteCache(
+	ctx context.Context,
+	req *datastore.CommitRequest,
+	reply *datastore.CommitResponse,
+) (err error) {
+	return m.deleteKeys(ctx, req, append(mutationKeys(req), resolvedKeys(reply)...))
+}
+
+// mutationKeys - Keys of the entities written by req.
+//                  └── reqが書き込むエンティティのキー。
+// Incomplete keys are included as they are, and ignored by Cache.
+//    └── 不完全なキーはそのまま含まれ、Cacheに無視される。
+func mutationKeys(req *datastore.CommitRequest) []*datastore.Key {
 	deleteKeys := make([]*datastore.Key, 0)
 
 	for _, m := range req.GetMutations() {
@@ -302,7 +453,48 @@ func (m *Middleware) deleteCache(ctx context.Context, req *datastore.CommitReque
 		deleteKeys = append(deleteKeys, m.GetDelete())
 	}
 
-	return m.cache.DeleteMulti(ctx, req.ProjectId, deleteKeys)
+	return deleteKeys
+}
+
+// resolvedKeys - Keys allocated by Datastore for incomplete keys, which are only set in MutationResults.
+//                  └── 不完全なキーにDatastoreが割り当てたキー。MutationResultsにのみ設定される。
+func resolvedKeys(reply *datastore.CommitResponse) []*datastore.Key {
+	var keys []*datastore.Key
+	for _, result := range reply.GetMutationResults() {
+		if result.GetKey() != nil {
+			keys = append(keys, result.GetKey())
+		}
+	}
+
+	return keys
+}
+
+// deleteKeys - Delete keys in the database of req from Cache.
+//                └── reqのデータベースにあるkeysをCacheから削除する。
+func (m *Middleware) deleteKeys(ctx context.Context, req *datastore.CommitRequest, deleteKeys []*datastore.Key) error {
+	deleteKeys = withDatabase(req.DatabaseId, deleteKeys)
+
+	if err := m.cache.DeleteMulti(ctx, req.ProjectId, deleteKeys); err != nil {
+		return err
+	}
+
+	statsFrom(ctx).add(statsInvalidated, deleteKeys...)
+
+	return nil
+}
+
+func (m *Middleware) addMetric(name string, key *datastore.Key, delta int64) {
+	if m.Metrics == nil {
+		return
+	}
+	m.Metrics.Add(name, KindOf(key), delta)
+}
+
+func (m *Middleware) logPrintf(format string, v ...interface{}) {
+	if m.Logger == nil {
+		return
+	}
+	m.Logger.Printf(format+"\n", v...)
 }
 
 func (m *Middleware) logPrintError(err error) {
@@ -0,0 +1,207 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/dstest"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	"google.golang.org/api/option"
+	pb "google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+)
+
+type dstestData struct {
+	Name string
+}
+
+// newDstestClients - Start dstest.Server and return clients with and without Middleware.
+//                      └── dstest.Serverを起動し、Middlewareを使うクライアントと使わないクライアントを返す。
+func newDstestClients(t *testing.T) (srv *dstest.Server, cached, nonCached *datastore.Client) {
+	t.Helper()
+
+	srv = dstest.NewServer()
+	middleware := cache.NewMiddleware(fake.NewCache())
+
+	newClient := func(opts ...grpc.DialOption) *datastore.Client {
+		conn, err := srv.Dial(opts...)
+		if err != nil {
+			t.Fatalf("failed to dial: %+v", err)
+		}
+
+		client, err := datastore.NewClient(context.Background(), "project-id-in-dstest", option.WithGRPCConn(conn))
+		if err != nil {
+			t.Fatalf("failed to initialize datastore client: %+v", err)
+		}
+
+		return client
+	}
+
+	cached = newClient(grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	nonCached = newClient()
+
+	return srv, cached, nonCached
+}
+
+// TestDstest_ConfirmCache - Get an entity after deleting it directly from Datastore, and confirm the cache is returned.
+//                             └── データをPutし、一度Getしキャッシュさせた後に直接datastoreから削除し、キャッシュから取得できることを確かめる
+func TestDstest_ConfirmCache(t *testing.T) {
+	srv, client, nonCached := newDstestClients(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	data := &dstestData{Name: "foo"}
+
+	key, err := client.Put(ctx, datastore.IncompleteKey("test", nil), data)
+	if err != nil {
+		t.Fatalf("failed to put new data: %+v", err)
+	}
+
+	var ret dstestData
+	if err := client.Get(ctx, key, &ret); err != nil {
+		t.Fatalf("failed to get data: %+v", err)
+	}
+
+	if err := nonCached.Delete(ctx, key); err != nil {
+		t.Fatalf("failed to delete data from datastore: %+v", err)
+	}
+
+	ret.Name = ""
+	if err := client.Get(ctx, key, &ret); err != nil {
+		t.Fatalf("failed to get data from cache: %+v", err)
+	}
+
+	if ret.Name != data.Name {
+		t.Errorf("retrieved data FROM CACHE differed: %s (expected: %s)", ret.Name, data.Name)
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 1 {
+		t.Errorf("Lookup reached Datastore %d times", calls)
+	}
+}
+
+// TestDstest_ClearCache - Put and Get an entity, update it, and confirm Get returns the new data.
+//                           └── データをPutし、一度Getしキャッシュさせた後にPutし、キャッシュが削除されていることを確かめる
+func TestDstest_ClearCache(t *testing.T) {
+	srv, client, _ := newDstestClients(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	data := &dstestData{Name: "foo"}
+
+	key, err := client.Put(ctx, datastore.IncompleteKey("test", nil), data)
+	if err != nil {
+		t.Fatalf("failed to put new data: %+v", err)
+	}
+
+	var ret dstestData
+	if err := client.Get(ctx, key, &ret); err != nil {
+		t.Fatalf("failed to get data: %+v", err)
+	}
+
+	data.Name = "bar"
+	if _, err := client.Put(ctx, key, data); err != nil {
+		t.Fatalf("failed to update entity: %+v", err)
+	}
+
+	ret.Name = ""
+	if err := client.Get(ctx, key, &ret); err != nil {
+		t.Fatalf("failed to get data: %+v", err)
+	}
+
+	if ret.Name != data.Name {
+		t.Errorf("retrieved data differed: %s (expected: %s)", ret.Name, data.Name)
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 2 {
+		t.Errorf("Lookup reached Datastore %d times", calls)
+	}
+}
+
+// TestDstest_Databases - Confirm entities with the same key in two databases do not collide in the cache.
+//                          └── 二つのデータベースにある同じキーのエンティティがキャッシュで衝突しないことを確かめる
+func TestDstest_Databases(t *testing.T) {
+	srv := dstest.NewServer()
+	defer srv.Close()
+
+	middleware := cache.NewMiddleware(fake.NewCache())
+
+	conn, err := srv.Dial(grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+	client := pb.NewDatastoreClient(conn)
+
+	ctx := context.Background()
+	key := &pb.Key{Path: []*pb.Key_PathElement{{Kind: "test", IdType: &pb.Key_PathElement_Name{Name: "foo"}}}}
+
+	commit := func(databaseID string, mutation *pb.Mutation) {
+		t.Helper()
+
+		_, err := client.Commit(ctx, &pb.CommitRequest{
+			ProjectId:  "project-id-in-dstest",
+			DatabaseId: databaseID,
+			Mode:       pb.CommitRequest_NON_TRANSACTIONAL,
+			Mutations:  []*pb.Mutation{mutation},
+		})
+		if err != nil {
+			t.Fatalf("failed to commit: %+v", err)
+		}
+	}
+
+	lookup := func(databaseID string) string {
+		t.Helper()
+
+		res, err := client.Lookup(ctx, &pb.LookupRequest{
+			ProjectId:  "project-id-in-dstest",
+			DatabaseId: databaseID,
+			Keys:       []*pb.Key{key},
+		})
+		if err != nil {
+			t.Fatalf("failed to lookup: %+v", err)
+		}
+		if len(res.Found) == 0 {
+			return ""
+		}
+
+		return res.Found[0].Entity.Properties["Name"].GetStringValue()
+	}
+
+	for _, databaseID := range []string{"", "other"} {
+		commit(databaseID, &pb.Mutation{Operation: &pb.Mutation_Upsert{Upsert: &pb.Entity{
+			Key: key,
+			Properties: map[string]*pb.Value{
+				"Name": {ValueType: &pb.Value_StringValue{StringValue: "in " + databaseID}},
+			},
+		}}})
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, databaseID := range []string{"", "other"} {
+			if name := lookup(databaseID); name != "in "+databaseID {
+				t.Errorf("unexpected entity in %q: %s", databaseID, name)
+			}
+		}
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 2 {
+		t.Errorf("Lookup reached Datastore %d times", calls)
+	}
+
+	// Commit invalidates only the cache of its database
+	//    └── Commitは自身のデータベースのキャッシュのみを削除する
+	commit("other", &pb.Mutation{Operation: &pb.Mutation_Delete{Delete: key}})
+
+	if name := lookup("other"); name != "" {
+		t.Errorf("deleted entity was returned: %s", name)
+	}
+	if name := lookup(""); name != "in " {
+		t.Errorf("unexpected entity in the default database: %s", name)
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 3 {
+		t.Errorf("Lookup reached Datastore %d times", calls)
+	}
+}
@@ -1,4 +1,5 @@
-//+abuild emulator,redis
+// +build emulator,redis
+
 package cache_test
 
 import (
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gcp-kit/datastore-cache-go/cache/mock"
 	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/ptypes"
 	"google.golang.org/genproto/googleapis/datastore/v1"
 	"google.golang.org/grpc"
 )
@@ -128,7 +129,7 @@ func TestCacheMiddleware_beforeLookup(t *testing.T) {
 	}
 
 	reply := new(datastore.LookupResponse)
-	err := c.beforeLookup(ctx, testData, reply)
+	_, err := c.beforeLookup(ctx, testData, reply)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -185,7 +186,7 @@ func TestCacheMiddleware_deleteCache(t *testing.T) {
 		},
 	}
 
-	err := c.deleteCache(ctx, testData)
+	err := c.deleteCache(ctx, testData, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -253,7 +254,7 @@ func TestCacheMiddleware_afterCommit(t *testing.T) {
 	c := NewMiddleware(m)
 	c.CacheDeleteTiming = DeleteTimingBeforeCommit
 
-	err := c.afterCommit(ctx, req, CachingModeNever)
+	err := c.afterCommit(ctx, req, nil, CachingModeNever)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -261,12 +262,81 @@ func TestCacheMiddleware_afterCommit(t *testing.T) {
 	c = NewMiddleware(m)
 	c.CacheDeleteTiming = DeleteTimingBeforeAndAfterCommit
 
-	err = c.afterCommit(ctx, req, CachingModeNever)
+	err = c.afterCommit(ctx, req, nil, CachingModeNever)
 	if err == nil || err.Error() != "e" {
 		t.Fatal(err)
 	}
 }
 
+func TestCacheMiddleware_afterCommit_resolvedKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	incomplete := &datastore.Key{
+		PartitionId: testKeys[0].PartitionId,
+		Path:        []*datastore.Key_PathElement{{Kind: "a"}},
+	}
+	allocated := testKeys2[1]
+
+	req := &datastore.CommitRequest{
+		ProjectId: projectID,
+		Mutations: []*datastore.Mutation{
+			{
+				Operation: &datastore.Mutation_Insert{
+					Insert: &datastore.Entity{Key: incomplete},
+				},
+			},
+			{
+				Operation: &datastore.Mutation_Delete{
+					Delete: testKeys[0],
+				},
+			},
+		},
+	}
+	reply := &datastore.CommitResponse{
+		MutationResults: []*datastore.MutationResult{
+			{Key: allocated},
+			{},
+		},
+	}
+
+	// Only allocated keys are deleted after Commit when the others were deleted before it
+	//    └── 他のキーをCommit前に削除した場合、Commit後には割り当てられたキーのみを削除する
+	m.EXPECT().
+		DeleteMulti(ctx, projectID, []*datastore.Key{allocated}).
+		Return(nil)
+
+	c := NewMiddleware(m)
+	c.CacheDeleteTiming = DeleteTimingBeforeCommit
+
+	if err := c.afterCommit(ctx, req, reply, CachingModeNever); err != nil {
+		t.Fatal(err)
+	}
+
+	m.EXPECT().
+		DeleteMulti(ctx, projectID, []*datastore.Key{incomplete, testKeys[0], allocated}).
+		Return(nil)
+
+	c = NewMiddleware(m)
+	c.CacheDeleteTiming = DeleteTimingBeforeAndAfterCommit
+
+	if err := c.afterCommit(ctx, req, reply, CachingModeNever); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is deleted when Datastore allocated no keys
+	//    └── Datastoreがキーを割り当てなかった場合は何も削除しない
+	c = NewMiddleware(m)
+	c.CacheDeleteTiming = DeleteTimingBeforeCommit
+
+	if err := c.afterCommit(ctx, req, &datastore.CommitResponse{}, CachingModeNever); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestCacheMiddleware_lookup(t *testing.T) {
 	t.Run("normal", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
@@ -441,4 +511,140 @@ func TestCacheMiddleware_lookup(t *testing.T) {
 			t.Fatalf("lookup returned nil item")
 		}
 	})
+
+	t.Run("read_options", func(t *testing.T) {
+		ctx := context.Background()
+		transaction := []byte("transaction")
+		readTime := ptypes.TimestampNow()
+
+		for _, readOptions := range []*datastore.ReadOptions{
+			{
+				ConsistencyType: &datastore.ReadOptions_NewTransaction{
+					NewTransaction: &datastore.TransactionOptions{},
+				},
+			},
+			{
+				ConsistencyType: &datastore.ReadOptions_ReadTime{
+					ReadTime: readTime,
+				},
+			},
+			{
+				ConsistencyType: &datastore.ReadOptions_Transaction{
+					Transaction: transaction,
+				},
+			},
+		} {
+			ctrl := gomock.NewController(t)
+			m := mock.NewMockCache(ctrl)
+
+			// The cache must not be used
+			//    └── キャッシュは使われてはならない
+			invoked := false
+			invoker := func(
+				ctx context.Context,
+				method string,
+				req,
+				reply interface{},
+				cc *grpc.ClientConn,
+				opts ...grpc.CallOption,
+			) error {
+				invoked = true
+				reply.(*datastore.LookupResponse).Transaction = transaction
+				reply.(*datastore.LookupResponse).ReadTime = readTime
+
+				return nil
+			}
+
+			req := &datastore.LookupRequest{
+				ProjectId:   projectID,
+				ReadOptions: readOptions,
+				Keys:        testKeys,
+			}
+			reply := new(datastore.LookupResponse)
+
+			c := NewMiddleware(m)
+
+			err := c.lookup(ctx, CachingModeReadWrite, "", req, reply, new(grpc.ClientConn), invoker, nil)
+			if err != nil {
+				t.Fatalf("lookup with %v failed: %+v", readOptions, err)
+			}
+
+			if !invoked {
+				t.Errorf("lookup with %v did not call Datastore", readOptions)
+			}
+			if string(reply.Transaction) != string(transaction) || reply.ReadTime != readTime {
+				t.Errorf("lookup with %v did not return the transaction and read time: %v", readOptions, reply)
+			}
+
+			ctrl.Finish()
+		}
+	})
+
+	t.Run("read_consistency", func(t *testing.T) {
+		// Strong reads outside a transaction are cached as eventual ones
+		//    └── トランザクション外の強整合性の読み取りは結果整合性のものと同様にキャッシュする
+		for _, consistency := range []datastore.ReadOptions_ReadConsistency{
+			datastore.ReadOptions_EVENTUAL,
+			datastore.ReadOptions_STRONG,
+		} {
+			ctrl := gomock.NewController(t)
+			m := mock.NewMockCache(ctrl)
+
+			ctx := context.Background()
+			readTime := ptypes.TimestampNow()
+			founds := []*datastore.EntityResult{
+				{
+					Entity: &datastore.Entity{
+						Key: testKeys[0],
+					},
+					Version: 99,
+				},
+			}
+
+			invoker := func(
+				ctx context.Context,
+				method string,
+				req,
+				reply interface{},
+				cc *grpc.ClientConn,
+				opts ...grpc.CallOption,
+			) error {
+				reply.(*datastore.LookupResponse).Found = founds
+				reply.(*datastore.LookupResponse).ReadTime = readTime
+
+				return nil
+			}
+
+			req := &datastore.LookupRequest{
+				ProjectId: projectID,
+				ReadOptions: &datastore.ReadOptions{
+					ConsistencyType: &datastore.ReadOptions_ReadConsistency_{
+						ReadConsistency: consistency,
+					},
+				},
+				Keys: testKeys,
+			}
+			reply := new(datastore.LookupResponse)
+
+			m.EXPECT().
+				GetMulti(ctx, projectID, testKeys).
+				Return(nil, nil)
+			m.EXPECT().
+				SetMulti(ctx, projectID, founds).
+				Return(nil)
+
+			c := NewMiddleware(m)
+
+			err := c.lookup(ctx, CachingModeReadWrite, "", req, reply, new(grpc.ClientConn), invoker, nil)
+			if err != nil {
+				t.Fatalf("lookup with %v failed: %+v", consistency, err)
+			}
+
+			if len(reply.Found) != 1 || reply.ReadTime != readTime {
+				t.Errorf("unexpected reply with %v: %v", consistency, reply)
+			}
+
+			ctrl.Finish()
+		}
+	})
 }
@@ -1,65 +1,96 @@
 package redis
 
 import (
-	"strconv"
 	"strings"
 
-	"github.com/golang/protobuf/proto"
+	"github.com/gcp-kit/datastore-cache-go/cache/codec"
+	"github.com/gcp-kit/datastore-cache-go/cache/compress"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
 	"golang.org/x/xerrors"
 	"google.golang.org/genproto/googleapis/datastore/v1"
 )
 
-func escapeKey(str string) string {
-	str = strings.ReplaceAll(str, "\\", "\\\\")
-	str = strings.ReplaceAll(str, ":", "\\:")
+var errSchemaVersionMismatch = xerrors.New("schema version mismatch")
 
-	return str
-}
+// encode serializes entity with the codec and wraps it in an envelope.
+// The envelope is signed with the key of the entity if a signing key is configured.
+func (r *Redis) encode(projectID string, entity *datastore.EntityResult) ([]byte, error) {
+	payload, err := r.codec.Marshal(entity)
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal entity: %w", err)
+	}
+
+	if r.compressor != nil {
+		payload, err = r.compressor.Compress(payload)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	envelope := &codec.Envelope{
+		CodecID:       r.codec.ID(),
+		SchemaVersion: r.schemaVersion,
+		Payload:       payload,
+	}
+
+	if r.signingKey == nil {
+		return envelope.Seal(), nil
+	}
 
-func encodeEntity(entity *datastore.EntityResult) ([]byte, error) {
-	return proto.Marshal(entity)
+	return r.sign(keyenc.Encode(projectID, entity.Entity.Key), envelope.Seal()), nil
 }
 
-func decodeEntity(data []byte) (*datastore.EntityResult, error) {
-	entity := &datastore.EntityResult{}
+// EncodedSize returns the size of the value written for entity, which Admission limits.
+func (r *Redis) EncodedSize(projectID string, entity *datastore.EntityResult) (int, error) {
+	encoded, err := r.encode(projectID, entity)
 
-	if err := proto.Unmarshal(data, entity); err != nil {
-		return nil, xerrors.Errorf("failed to unmarshal protobuf", err)
+	if err != nil {
+		return 0, err
 	}
 
-	return entity, nil
+	return len(encoded), nil
 }
 
-func calcKeyForEntity(projectID string, key *datastore.Key) string {
-	paths := make([]string, 0, len(key.Path))
-	for _, path := range key.Path {
-		var id string
-		if idInt, ok := path.GetIdType().(*datastore.Key_PathElement_Id); ok {
-			id = "i:" + strconv.FormatInt(idInt.Id, 10)
-		} else if name, ok := path.GetIdType().(*datastore.Key_PathElement_Name); ok {
-			id = "n:" + escapeKey(name.Name)
-		} else {
-			return ""
-		}
+// decode deserializes data written by encode for key.
+// Entries written before the envelope was introduced are read as protobuf.
+func (r *Redis) decode(projectID string, key *datastore.Key, data []byte) (*datastore.EntityResult, error) {
+	data, err := r.verify(keyenc.Encode(projectID, key), data)
 
-		paths = append(paths, escapeKey(path.Kind)+":"+id)
+	if err != nil {
+		return nil, err
 	}
 
-	var namespaceID string
+	c := codec.Protobuf
+
+	if codec.IsEnvelope(data) {
+		envelope, err := codec.Open(data)
+
+		if err != nil {
+			return nil, xerrors.Errorf("failed to open envelope: %w", err)
+		}
+
+		if envelope.SchemaVersion != r.schemaVersion {
+			return nil, errSchemaVersionMismatch
+		}
+
+		c, err = codec.Lookup(envelope.CodecID)
 
-	if key.PartitionId != nil {
-		if key.PartitionId.ProjectId != "" {
-			projectID = key.PartitionId.ProjectId
+		if err != nil {
+			return nil, err
 		}
 
-		namespaceID = key.PartitionId.NamespaceId
+		data = envelope.Payload
+	}
+
+	decompressed, err := compress.Decompress(data)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return escapeKey(projectID) +
-		":" +
-		escapeKey(namespaceID) +
-		":" +
-		strings.Join(paths, ":")
+	return c.Unmarshal(decompressed)
 }
 
 func isReserved(id string) bool {
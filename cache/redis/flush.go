@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"github.com/gomodule/redigo/redis"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// scanCount is the COUNT hint passed to SCAN. Keys found in a page are removed by a single UNLINK.
+const scanCount = 1000
+
+var _ cache.Flusher = &Redis{}
+
+// Flush deletes the entities selected by filter with SCAN and UNLINK.
+// Keys are narrowed down with MATCH and then checked one by one, so escaped characters never cause false matches.
+func (r *Redis) Flush(_ context.Context, filter *cache.FlushFilter, dryRun bool) (n int64, err error) {
+	err = r.scan(filter, func(conn redis.Conn, keys []string) error {
+		n += int64(len(keys))
+
+		if dryRun {
+			return nil
+		}
+
+		args := make([]interface{}, len(keys))
+		for i := range keys {
+			args[i] = keys[i]
+		}
+
+		if _, err := conn.Do("UNLINK", args...); err != nil {
+			return xerrors.Errorf("UNLINK failed: %w", err)
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+// scan calls f with each page of the keys selected by filter.
+func (r *Redis) scan(filter *cache.FlushFilter, f func(conn redis.Conn, keys []string) error) error {
+	if filter.ProjectID == "" {
+		return xerrors.New("project ID is required")
+	}
+
+	if filter.Ancestor != nil && keyenc.Encode(filter.ProjectID, filter.Ancestor) == "" {
+		return xerrors.New("ancestor must be a complete key")
+	}
+
+	namespaces := filter.Namespaces
+	patterns := make([]string, 0, len(namespaces))
+
+	if len(namespaces) == 0 {
+		patterns = append(patterns, r.scanPattern(filter, nil))
+	}
+
+	for i := range namespaces {
+		patterns = append(patterns, r.scanPattern(filter, &namespaces[i]))
+	}
+
+	conn := r.connPool.Get()
+	defer conn.Close()
+
+	for _, pattern := range patterns {
+		if err := r.scanMatching(conn, pattern, filter, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanPattern returns the MATCH pattern for filter in namespace, or in all namespaces if namespace is nil.
+func (r *Redis) scanPattern(filter *cache.FlushFilter, namespace *string) string {
+	project := keyenc.Project(filter.ProjectID, filter.DatabaseID)
+
+	if namespace == nil {
+		return escapeGlob(r.keySpacePrefix()+keyenc.Escape(project)+":") + "*"
+	}
+
+	if filter.Ancestor != nil {
+		// the ancestor itself is selected as well as its descendants
+		ancestor := r.redisKey(filter.ProjectID, &datastore.Key{
+			PartitionId: &datastore.PartitionId{
+				ProjectId:   filter.ProjectID,
+				DatabaseId:  filter.DatabaseID,
+				NamespaceId: *namespace,
+			},
+			Path:        filter.Ancestor.Path,
+		})
+
+		return escapeGlob(ancestor) + "*"
+	}
+
+	return escapeGlob(r.keySpacePrefix()+keyenc.PartitionPrefix(project, *namespace)) + "*"
+}
+
+// scanMatching scans keys matching pattern and calls f with the ones selected by filter.
+func (r *Redis) scanMatching(
+	conn redis.Conn,
+	pattern string,
+	filter *cache.FlushFilter,
+	f func(conn redis.Conn, keys []string) error,
+) error {
+	var cursor int64
+
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", scanCount))
+
+		if err != nil {
+			return xerrors.Errorf("SCAN failed: %w", err)
+		}
+
+		if len(values) != 2 {
+			return xerrors.Errorf("SCAN returned %d values", len(values))
+		}
+
+		cursor, err = redis.Int64(values[0], nil)
+
+		if err != nil {
+			return xerrors.Errorf("failed to parse cursor: %w", err)
+		}
+
+		keys, err := redis.Strings(values[1], nil)
+
+		if err != nil {
+			return xerrors.Errorf("failed to parse keys: %w", err)
+		}
+
+		selected := keys[:0]
+
+		for _, key := range keys {
+			if r.matchFlushFilter(key, filter) {
+				selected = append(selected, key)
+			}
+		}
+
+		if len(selected) > 0 {
+			if err := f(conn, selected); err != nil {
+				return err
+			}
+		}
+
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// matchFlushFilter reports whether the Redis key belongs to an entity selected by filter.
+func (r *Redis) matchFlushFilter(redisKey string, filter *cache.FlushFilter) bool {
+	prefix := r.keySpacePrefix()
+
+	if !strings.HasPrefix(redisKey, prefix) {
+		return false
+	}
+
+	key, err := keyenc.Decode(redisKey[len(prefix):])
+
+	if err != nil {
+		return false
+	}
+
+	if key.PartitionId.ProjectId != filter.ProjectID || key.PartitionId.DatabaseId != filter.DatabaseID {
+		return false
+	}
+
+	if len(filter.Namespaces) > 0 && !contains(filter.Namespaces, key.PartitionId.NamespaceId) {
+		return false
+	}
+
+	if filter.Kind != "" && key.Path[len(key.Path)-1].Kind != filter.Kind {
+		return false
+	}
+
+	if filter.Ancestor != nil {
+		ancestor := filter.Ancestor.Path
+
+		if len(ancestor) > len(key.Path) {
+			return false
+		}
+
+		for i := range ancestor {
+			if !proto.Equal(ancestor[i], key.Path[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// escapeGlob escapes the special characters of Redis glob patterns.
+func escapeGlob(str string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(str); i++ {
+		switch str[i] {
+		case '\\', '*', '?', '[', ']':
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(str[i])
+	}
+
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func TestRedis_Flush(t *testing.T) {
+	conn, _ := initRedis(t)
+	r := NewRedis(initPool(conn), WithKeyPrefix("app"))
+
+	parent := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID, NamespaceId: "ns"},
+		Path: []*datastore.Key_PathElement{
+			{Kind: "Parent", IdType: &datastore.Key_PathElement_Id{Id: 1}},
+		},
+	}
+	child := &datastore.Key{
+		PartitionId: parent.PartitionId,
+		Path: append(parent.Path, &datastore.Key_PathElement{
+			Kind: "Child", IdType: &datastore.Key_PathElement_Id{Id: 2},
+		}),
+	}
+	otherParent := &datastore.Key{
+		PartitionId: parent.PartitionId,
+		Path: []*datastore.Key_PathElement{
+			{Kind: "Parent", IdType: &datastore.Key_PathElement_Id{Id: 10}},
+		},
+	}
+
+	keys := []interface{}{
+		[]byte(r.redisKey(projectID, parent)),
+		[]byte(r.redisKey(projectID, child)),
+		[]byte(r.redisKey(projectID, otherParent)),
+	}
+
+	// SCAN returns the keys over two pages
+	conn.Command("SCAN", int64(0), "MATCH", "app:project-id:ns:Parent:i:1*", "COUNT", scanCount).
+		Expect([]interface{}{[]byte("7"), keys[:2]})
+	conn.Command("SCAN", int64(7), "MATCH", "app:project-id:ns:Parent:i:1*", "COUNT", scanCount).
+		Expect([]interface{}{[]byte("0"), keys[2:]})
+	unlink := conn.Command("UNLINK", r.redisKey(projectID, child)).Expect(int64(1))
+
+	filter := &cache.FlushFilter{
+		ProjectID:  projectID,
+		Namespaces: []string{"ns"},
+		Kind:       "Child",
+		Ancestor:   parent,
+	}
+
+	n, err := r.Flush(context.Background(), filter, true)
+
+	if err != nil {
+		t.Fatalf("failed to Flush in dry-run mode: %+v", err)
+	}
+
+	if n != 1 || conn.Stats(unlink) != 0 {
+		t.Fatalf("dry-run flushed %d keys with %d UNLINK", n, conn.Stats(unlink))
+	}
+
+	filter.Kind = ""
+
+	conn.Command("UNLINK", r.redisKey(projectID, parent), r.redisKey(projectID, child)).Expect(int64(2))
+
+	n, err = r.Flush(context.Background(), filter, false)
+
+	if err != nil {
+		t.Fatalf("failed to Flush: %+v", err)
+	}
+
+	if n != 2 {
+		t.Errorf("Flush deleted %d keys (expected: %d)", n, 2)
+	}
+}
+
+func TestRedis_FlushDatabase(t *testing.T) {
+	conn, _ := initRedis(t)
+	r := NewRedis(initPool(conn), WithKeyPrefix("app"))
+
+	key := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID, DatabaseId: "db"},
+		Path: []*datastore.Key_PathElement{
+			{Kind: "Parent", IdType: &datastore.Key_PathElement_Id{Id: 1}},
+		},
+	}
+	inDefault := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID},
+		Path:        key.Path,
+	}
+
+	// keys in the default database are not selected even if SCAN returns them
+	conn.Command("SCAN", int64(0), "MATCH", "app:project-id/db:*", "COUNT", scanCount).
+		Expect([]interface{}{[]byte("0"), []interface{}{
+			[]byte(r.redisKey(projectID, key)),
+			[]byte(r.redisKey(projectID, inDefault)),
+		}})
+	unlink := conn.Command("UNLINK", r.redisKey(projectID, key)).Expect(int64(1))
+
+	n, err := r.Flush(context.Background(), &cache.FlushFilter{ProjectID: projectID, DatabaseID: "db"}, false)
+
+	if err != nil {
+		t.Fatalf("failed to Flush: %+v", err)
+	}
+
+	if n != 1 || conn.Stats(unlink) != 1 {
+		t.Errorf("Flush deleted %d keys with %d UNLINK", n, conn.Stats(unlink))
+	}
+}
@@ -9,6 +9,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/cachetest"
+	"github.com/gcp-kit/datastore-cache-go/cache/encrypt"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
 	"github.com/gcp-kit/datastore-cache-go/cache/redis"
 	redigo "github.com/gomodule/redigo/redis"
 	"github.com/google/go-cmp/cmp"
@@ -19,21 +23,23 @@ const (
 	projectID = "project-id"
 )
 
-func newRedis(t *testing.T) *redis.Redis {
+func newPool(t *testing.T) *redigo.Pool {
 	addr := os.Getenv("REDIS_ADDR")
 
 	if len(addr) == 0 {
 		t.Fatalf("$REDIS_ADDR is not set")
 	}
 
-	pool := &redigo.Pool{
+	return &redigo.Pool{
 		MaxIdle:     3,
 		MaxActive:   0,
 		IdleTimeout: 240 * time.Second,
 		Dial:        func() (redigo.Conn, error) { return redigo.Dial("tcp", addr) },
 	}
+}
 
-	return redis.NewRedis(pool)
+func newRedis(t *testing.T) *redis.Redis {
+	return redis.NewRedis(newPool(t))
 }
 
 var (
@@ -156,3 +162,49 @@ func TestRedis_GetAfterDelete(t *testing.T) {
 		t.Fatalf("GetMulti returned %d results: %v", len(results), results)
 	}
 }
+
+// TestRedis_SetSameVersionTwice - 同じバージョンを2回Setしてもエントリが1つだけ残ることをテスト
+func TestRedis_SetSameVersionTwice(t *testing.T) {
+	pool := newPool(t)
+	defer pool.Close()
+
+	keyring, err := encrypt.NewKeyring("k1", map[string][]byte{"k1": []byte("0123456789abcdef")})
+
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %+v", err)
+	}
+
+	r := redis.NewRedis(pool)
+	ctx := context.Background()
+	key := entityResults[0].Entity.Key
+
+	for _, c := range []cache.Cache{r, encrypt.NewCache(r, keyring)} {
+		for i := 0; i < 2; i++ {
+			if err := c.SetMulti(ctx, projectID, []*datastore.EntityResult{entityResults[0]}); err != nil {
+				t.Fatalf("SetMulti failed: %+v", err)
+			}
+		}
+
+		conn := pool.Get()
+		n, err := redigo.Int(conn.Do("ZCARD", keyenc.Encode(projectID, key)))
+		conn.Close()
+
+		if err != nil {
+			t.Fatalf("ZCARD failed: %+v", err)
+		}
+
+		if n != 1 {
+			t.Errorf("%T kept %d members for a version", c, n)
+		}
+
+		if err := c.DeleteMulti(ctx, projectID, []*datastore.Key{key}); err != nil {
+			t.Fatalf("DeleteMulti failed: %+v", err)
+		}
+	}
+}
+
+func TestRedis_Conformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) cache.Cache {
+		return newRedis(t)
+	})
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/codec"
+	"github.com/gcp-kit/datastore-cache-go/cache/compress"
+)
+
+// Option configures optional behavior of Redis.
+type Option func(r *Redis)
+
+// WithMaxBatchSize limits the number of keys sent in a single pipeline by GetMulti.
+// Larger key sets are split into several pipelines that run concurrently on
+// separate pooled connections. Zero or a negative value disables splitting.
+func WithMaxBatchSize(n int) Option {
+	return func(r *Redis) {
+		r.maxBatchSize = n
+	}
+}
+
+// WithKeyPrefix puts prefix in front of every Redis key so that several applications can share one Redis.
+// The prefix is used verbatim and separated from the rest of the key by ":".
+func WithKeyPrefix(prefix string) Option {
+	return func(r *Redis) {
+		r.keyPrefix = prefix
+	}
+}
+
+// WithSchemaVersion adds a "v<version>" segment to every Redis key.
+// Bumping the version makes entries written with another version invisible,
+// so that deployments with different encodings can run side by side.
+// Zero keeps the unversioned layout.
+func WithSchemaVersion(version int) Option {
+	return func(r *Redis) {
+		r.schemaVersion = version
+	}
+}
+
+// WithCompression compresses payloads of threshold bytes or more with alg.
+// Payloads are prefixed with a one-byte header recording the codec,
+// and entries written without compression can still be read.
+func WithCompression(alg compress.Algorithm, threshold int) Option {
+	return func(r *Redis) {
+		r.compressor = compress.NewCompressor(alg, threshold)
+	}
+}
+
+// WithCodec serializes entities with c instead of protobuf.
+// The codec is recorded in the envelope of every entry,
+// so entries written with other registered codecs can still be read.
+func WithCodec(c codec.EntityCodec) Option {
+	return func(r *Redis) {
+		r.codec = c
+	}
+}
+
+// WithMetrics reports counters such as decode failures to m.
+func WithMetrics(m cache.Metrics) Option {
+	return func(r *Redis) {
+		r.metrics = m
+	}
+}
+
+// WithSigningKey signs every entry with HMAC-SHA256 keyed by key.
+// The signature covers the Datastore key of the entity, so an entry cannot be swapped between keys.
+// Entries without a valid signature are treated as misses and removed.
+// Use a different key for each application sharing the Redis.
+func WithSigningKey(key []byte) Option {
+	return func(r *Redis) {
+		r.signingKey = key
+	}
+}
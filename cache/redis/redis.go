@@ -2,25 +2,70 @@ package redis
 
 import (
 	"context"
+	"strconv"
+	"sync"
 
 	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/codec"
+	"github.com/gcp-kit/datastore-cache-go/cache/compress"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
 	"github.com/gomodule/redigo/redis"
 	"golang.org/x/xerrors"
 	"google.golang.org/genproto/googleapis/datastore/v1"
 )
 
 type Redis struct {
-	connPool *redis.Pool
+	connPool      *redis.Pool
+	maxBatchSize  int
+	keyPrefix     string
+	schemaVersion int
+	compressor    *compress.Compressor
+	codec         codec.EntityCodec
+	metrics       cache.Metrics
+	signingKey    []byte
 }
 
-func NewRedis(connPool *redis.Pool) *Redis {
-	return &Redis{
+func NewRedis(connPool *redis.Pool, opts ...Option) *Redis {
+	r := &Redis{
 		connPool: connPool,
+		codec:    codec.Protobuf,
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
 }
 
 var _ cache.Cache = &Redis{}
 
+// redisKey returns the Redis key for key, including the configured prefix and schema version.
+func (r *Redis) redisKey(projectID string, key *datastore.Key) string {
+	entityKey := keyenc.Encode(projectID, key)
+
+	if entityKey == "" {
+		return ""
+	}
+
+	return r.keySpacePrefix() + entityKey
+}
+
+// keySpacePrefix returns the part of the Redis keys that precedes the project ID.
+func (r *Redis) keySpacePrefix() string {
+	var prefix string
+
+	if r.keyPrefix != "" {
+		prefix += r.keyPrefix + ":"
+	}
+
+	if r.schemaVersion != 0 {
+		prefix += "v" + strconv.Itoa(r.schemaVersion) + ":"
+	}
+
+	return prefix
+}
+
 func (r *Redis) runInTransaction(f func(conn redis.Conn) error) ([]interface{}, error) {
 	conn := r.connPool.Get()
 	defer conn.Close()
@@ -49,16 +94,37 @@ func (r *Redis) runInTransaction(f func(conn redis.Conn) error) ([]interface{},
 	return reply, nil
 }
 
+func (r *Redis) runInPipeline(f func(conn redis.Conn) error) ([]interface{}, error) {
+	conn := r.connPool.Get()
+	defer conn.Close()
+
+	if err := f(conn); err != nil {
+		return nil, xerrors.Errorf("failed to exec in-pipeline function: %w", err)
+	}
+
+	reply, err := redis.Values(conn.Do(""))
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to flush pipeline: %w", err)
+	}
+
+	return reply, nil
+}
+
 func (r *Redis) GetMulti(
 	_ context.Context,
 	projectID string,
 	keys []*datastore.Key,
 ) (items []*datastore.EntityResult, err error) {
+	items = make([]*datastore.EntityResult, len(keys))
+
+	// reserved partitions are never cached, so they are always misses
 	if isReserved(projectID) {
-		return nil, nil
+		return items, nil
 	}
 
 	filtered := make([]*datastore.Key, 0, len(keys))
+	indexes := make([]int, 0, len(keys))
 
 	for i := range keys {
 		partitionID := keys[i].PartitionId
@@ -69,21 +135,84 @@ func (r *Redis) GetMulti(
 		}
 
 		filtered = append(filtered, keys[i])
+		indexes = append(indexes, i)
 	}
 
-	keys = filtered
+	found := make([]*datastore.EntityResult, len(filtered))
 
-	slices, err := r.runInTransaction(func(conn redis.Conn) error {
-		for i := range keys {
-			key := calcKeyForEntity(projectID, keys[i])
+	batches := r.splitBatches(len(filtered))
+	errs := make([]error, len(batches))
 
-			if key == "" {
-				continue
-			}
+	var wg sync.WaitGroup
+	for i := range batches {
+		wg.Add(1)
 
-			_, err = conn.Do("ZREVRANGE", key, 0, 0)
+		go func(i int) {
+			defer wg.Done()
 
-			if err != nil {
+			begin, end := batches[i][0], batches[i][1]
+			errs[i] = r.getBatch(projectID, filtered[begin:end], found[begin:end])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] != nil {
+			return nil, xerrors.Errorf("GetMulti in pipeline failed: %w", errs[i])
+		}
+	}
+
+	for i := range found {
+		items[indexes[i]] = found[i]
+	}
+
+	return items, nil
+}
+
+// splitBatches returns [begin, end) ranges covering n keys, each holding at most maxBatchSize keys.
+func (r *Redis) splitBatches(n int) [][2]int {
+	size := r.maxBatchSize
+	if size <= 0 || size > n {
+		size = n
+	}
+
+	batches := make([][2]int, 0, 1)
+	for begin := 0; begin < n; begin += size {
+		end := begin + size
+		if end > n {
+			end = n
+		}
+
+		batches = append(batches, [2]int{begin, end})
+	}
+
+	return batches
+}
+
+// getBatch looks up keys in a single pipeline and stores the decoded entities in items,
+// which must have the same length as keys.
+func (r *Redis) getBatch(projectID string, keys []*datastore.Key, items []*datastore.EntityResult) error {
+	redisKeys := make([]string, 0, len(keys))
+	indexes := make([]int, 0, len(keys))
+
+	for i := range keys {
+		key := r.redisKey(projectID, keys[i])
+
+		if key == "" {
+			continue
+		}
+
+		redisKeys = append(redisKeys, key)
+		indexes = append(indexes, i)
+	}
+
+	if len(redisKeys) == 0 {
+		return nil
+	}
+
+	slices, err := r.runInPipeline(func(conn redis.Conn) error {
+		for i := range redisKeys {
+			if err := conn.Send("ZREVRANGE", redisKeys[i], 0, 0); err != nil {
 				return xerrors.Errorf("ZREVRANGE failed: %w", err)
 			}
 		}
@@ -92,10 +221,15 @@ func (r *Redis) GetMulti(
 	})
 
 	if err != nil {
-		return nil, xerrors.Errorf("GetMulti in transaction failed: %w", err)
+		return err
 	}
 
-	items = make([]*datastore.EntityResult, len(keys))
+	if len(slices) != len(indexes) {
+		return xerrors.Errorf("pipeline returned %d replies for %d commands", len(slices), len(indexes))
+	}
+
+	corrupted := make([]int, 0)
+
 	for i, buf := range slices {
 		if buf == nil {
 			continue
@@ -104,23 +238,63 @@ func (r *Redis) GetMulti(
 		b, err := redis.ByteSlices(buf, nil)
 
 		if err != nil {
-			return nil, xerrors.Errorf("failed to convert result to []byte for %dth element: %+v", i, err)
+			return xerrors.Errorf("failed to convert result to []byte for %dth element: %w", indexes[i], err)
 		}
 
 		if len(b) == 0 {
 			continue
 		}
 
-		entity, err := decodeEntity(b[0])
+		entity, err := r.decode(projectID, keys[indexes[i]], b[0])
+
+		if xerrors.Is(err, errSchemaVersionMismatch) {
+			continue
+		}
+
+		if xerrors.Is(err, errInvalidSignature) {
+			r.addMetric(cache.MetricSignatureFailures, keys[indexes[i]], 1)
+			corrupted = append(corrupted, i)
+
+			continue
+		}
 
 		if err != nil {
+			r.addMetric(cache.MetricDecodeFailures, keys[indexes[i]], 1)
+			corrupted = append(corrupted, i)
+
 			continue
 		}
 
-		items[i] = entity
+		items[indexes[i]] = entity
 	}
 
-	return items, nil
+	if len(corrupted) == 0 {
+		return nil
+	}
+
+	// Only the corrupted member is removed so that a newer version written meanwhile survives.
+	// nolint:errcheck
+	r.runInPipeline(func(conn redis.Conn) error {
+		for _, i := range corrupted {
+			member, _ := redis.ByteSlices(slices[i], nil)
+
+			if err := conn.Send("ZREM", redisKeys[i], member[0]); err != nil {
+				return xerrors.Errorf("ZREM failed: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	return nil
+}
+
+func (r *Redis) addMetric(name string, key *datastore.Key, delta int64) {
+	if r.metrics == nil {
+		return
+	}
+
+	r.metrics.Add(name, cache.KindOf(key), delta)
 }
 
 func (r *Redis) SetMulti(_ context.Context, projectID string, items []*datastore.EntityResult) (err error) {
@@ -130,24 +304,31 @@ func (r *Redis) SetMulti(_ context.Context, projectID string, items []*datastore
 
 	_, err = r.runInTransaction(func(conn redis.Conn) error {
 		for i := range items {
-			partitionID := items[i].Entity.Key.PartitionId
-			if isReserved(partitionID.ProjectId) || isReserved(partitionID.NamespaceId) {
+			partitionID := items[i].Entity.Key.GetPartitionId()
+			if isReserved(partitionID.GetProjectId()) || isReserved(partitionID.GetNamespaceId()) {
 				continue
 			}
 
 			//nolint:govet
-			encoded, err := encodeEntity(items[i])
+			encoded, err := r.encode(projectID, items[i])
 
 			if err != nil {
 				return xerrors.Errorf("failed to encode entity for Redis: %w", err)
 			}
 
-			key := calcKeyForEntity(projectID, items[i].Entity.Key)
+			key := r.redisKey(projectID, items[i].Entity.Key)
 
 			if key == "" {
 				continue
 			}
 
+			// Encodings of the same version may differ, so the old one is removed instead of being left beside it
+			_, err = conn.Do("ZREMRANGEBYSCORE", key, items[i].Version, items[i].Version)
+
+			if err != nil {
+				return xerrors.Errorf("ZREMRANGEBYSCORE failed: %w", err)
+			}
+
 			_, err = conn.Do("ZADD", key, items[i].Version, encoded)
 
 			if err != nil {
@@ -179,7 +360,7 @@ func (r *Redis) DeleteMulti(_ context.Context, projectID string, keys []*datasto
 				continue
 			}
 
-			key := calcKeyForEntity(projectID, keys[i])
+			key := r.redisKey(projectID, keys[i])
 
 			if key == "" {
 				continue
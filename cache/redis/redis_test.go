@@ -3,8 +3,14 @@ package redis
 import (
 	"context"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/codec"
+	"github.com/gcp-kit/datastore-cache-go/cache/compress"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
 	redigo "github.com/gomodule/redigo/redis"
 	"github.com/google/go-cmp/cmp"
 	"github.com/rafaeljusto/redigomock"
@@ -15,19 +21,25 @@ const (
 	projectID = "project-id"
 )
 
-func initRedis(t *testing.T) (*redigomock.Conn, *Redis) {
-	t.Helper()
-
-	conn := redigomock.NewConn()
+var ignoreXXX = cmp.FilterPath(func(path cmp.Path) bool {
+	return !strings.HasPrefix(path.Last().String(), "XXX_")
+}, cmp.Ignore())
 
-	pool := &redigo.Pool{
+func initPool(conn *redigomock.Conn) *redigo.Pool {
+	return &redigo.Pool{
 		Dial: func() (redigo.Conn, error) {
 			return conn, nil
 		},
 		MaxIdle: 10,
 	}
+}
+
+func initRedis(t *testing.T) (*redigomock.Conn, *Redis) {
+	t.Helper()
+
+	conn := redigomock.NewConn()
 
-	return conn, NewRedis(pool)
+	return conn, NewRedis(initPool(conn))
 }
 
 var (
@@ -138,15 +150,18 @@ func setEntityResults(t *testing.T, conn *redigomock.Conn, r *Redis) {
 
 	var redisResults []interface{}
 	for i, res := range entityResults {
-		encoded, err := encodeEntity(res)
+		encoded, err := r.encode(projectID, res)
 
 		if err != nil {
 			t.Fatalf("failed to encode %dth entity: %+v", i, err)
 		}
 
-		conn.Command("ZADD", calcKeyForEntity(projectID, res.Entity.Key), res.Version, encoded).Expect([]byte("queued"))
+		redisKey := keyenc.Encode(projectID, res.Entity.Key)
 
-		redisResults = append(redisResults, "1")
+		conn.Command("ZREMRANGEBYSCORE", redisKey, res.Version, res.Version).Expect([]byte("queued"))
+		conn.Command("ZADD", redisKey, res.Version, encoded).Expect([]byte("queued"))
+
+		redisResults = append(redisResults, "0", "1")
 	}
 
 	conn.Command("EXEC").ExpectSlice(redisResults...)
@@ -162,7 +177,7 @@ func TestRedis_setThenGet(t *testing.T) {
 	setEntityResults(t, conn, r)
 
 	encode := func(entity *datastore.EntityResult) []interface{} {
-		b, err := encodeEntity(entity)
+		b, err := r.encode(projectID, entity)
 
 		if err != nil {
 			t.Fatalf("failed to encode entity: %+v", err)
@@ -203,27 +218,115 @@ func TestRedis_setThenGet(t *testing.T) {
 		entityResults[3].Entity.Key,
 	}
 
-	conn.Command("MULTI").Expect("ok")
+	for i, key := range keys {
+		conn.Command("ZREVRANGE", keyenc.Encode(projectID, key), 0, 0).Expect(redisResults[i])
+	}
 
-	for _, key := range keys {
-		conn.Command("ZREVRANGE", calcKeyForEntity(projectID, key), 0, 0).Expect("queued")
+	items, err := r.GetMulti(context.Background(), "project", keys)
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti entites: %+v", err)
 	}
 
-	conn.Command("EXEC").ExpectSlice(redisResults...)
+	if diff := cmp.Diff(expectedResults, items, ignoreXXX); diff != "" {
+		t.Errorf("returned values from GetMulti differed: %s", diff)
+	}
+}
 
-	items, err := r.GetMulti(context.Background(), "project", keys)
+func TestRedis_getMultiReservedPartitions(t *testing.T) {
+	conn, r := initRedis(t)
+
+	key := entityResults[1].Entity.Key
+	reserved := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID, NamespaceId: "__reserved__"},
+		Path:        key.Path,
+	}
+
+	encoded, err := r.encode(projectID, entityResults[1])
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	conn.Command("ZREVRANGE", keyenc.Encode(projectID, key), 0, 0).Expect([]interface{}{encoded})
+
+	items, err := r.GetMulti(context.Background(), projectID, []*datastore.Key{reserved, key, reserved})
 
 	if err != nil {
 		t.Fatalf("failed to GetMulti entites: %+v", err)
 	}
 
-	filter := cmp.FilterPath(func(path cmp.Path) bool {
-		return !strings.HasPrefix(path.Last().String(), "XXX_")
-	}, cmp.Ignore())
+	expected := []*datastore.EntityResult{nil, entityResults[1], nil}
 
-	if diff := cmp.Diff(expectedResults, items, filter); diff != "" {
+	if diff := cmp.Diff(expected, items, ignoreXXX); diff != "" {
 		t.Errorf("returned values from GetMulti differed: %s", diff)
 	}
+
+	items, err = r.GetMulti(context.Background(), "__reserved__", []*datastore.Key{key})
+
+	if err != nil || len(items) != 1 || items[0] != nil {
+		t.Errorf("reserved project must return a miss for each key: %v, %+v", items, err)
+	}
+}
+
+func TestRedis_getMultiInBatches(t *testing.T) {
+	encode := func(entity *datastore.EntityResult) []interface{} {
+		b, err := NewRedis(nil).encode(projectID, entity)
+
+		if err != nil {
+			t.Fatalf("failed to encode entity: %+v", err)
+		}
+
+		return []interface{}{b}
+	}
+
+	// each batch runs on its own connection, so every connection knows all the replies
+	var mu sync.Mutex
+	conns := make([]*redigomock.Conn, 0)
+
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			conn := redigomock.NewConn()
+
+			for _, res := range entityResults[1:] {
+				conn.Command("ZREVRANGE", keyenc.Encode(projectID, res.Entity.Key), 0, 0).Expect(encode(res))
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			return conn, nil
+		},
+	}
+
+	r := NewRedis(pool, WithMaxBatchSize(2))
+
+	keys := []*datastore.Key{
+		entityResults[3].Entity.Key,
+		entityResults[2].Entity.Key,
+		entityResults[1].Entity.Key,
+	}
+
+	items, err := r.GetMulti(context.Background(), projectID, keys)
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti entites: %+v", err)
+	}
+
+	expectedResults := []*datastore.EntityResult{
+		entityResults[3],
+		entityResults[2],
+		entityResults[1],
+	}
+
+	if diff := cmp.Diff(expectedResults, items, ignoreXXX); diff != "" {
+		t.Errorf("returned values from GetMulti differed: %s", diff)
+	}
+
+	if len(conns) != 2 {
+		t.Errorf("GetMulti used %d connections (expected: %d)", len(conns), 2)
+	}
 }
 
 func TestRedis_setThenDelete(t *testing.T) {
@@ -260,7 +363,7 @@ func TestRedis_setThenDelete(t *testing.T) {
 	conn.Command("MULTI").Expect("ok")
 
 	for _, key := range keys {
-		conn.Command("DEL", calcKeyForEntity(projectID, key)).Expect("queued")
+		conn.Command("DEL", keyenc.Encode(projectID, key)).Expect("queued")
 	}
 
 	conn.Command("EXEC").ExpectSlice(redisResults...)
@@ -271,3 +374,272 @@ func TestRedis_setThenDelete(t *testing.T) {
 		t.Fatalf("failed to DeleteMulti entites: %+v", err)
 	}
 }
+
+func TestRedis_keyPrefixAndSchemaVersion(t *testing.T) {
+	key := entityResults[0].Entity.Key
+
+	testCases := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{
+			name:     "default",
+			expected: "project-id:namespace-id:kind:i:10",
+		},
+		{
+			name:     "prefix",
+			opts:     []Option{WithKeyPrefix("app")},
+			expected: "app:project-id:namespace-id:kind:i:10",
+		},
+		{
+			name:     "schema_version",
+			opts:     []Option{WithSchemaVersion(2)},
+			expected: "v2:project-id:namespace-id:kind:i:10",
+		},
+		{
+			name:     "prefix_and_schema_version",
+			opts:     []Option{WithKeyPrefix("app"), WithSchemaVersion(2)},
+			expected: "app:v2:project-id:namespace-id:kind:i:10",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			conn := redigomock.NewConn()
+			pool := &redigo.Pool{
+				Dial: func() (redigo.Conn, error) {
+					return conn, nil
+				},
+			}
+
+			cmd := conn.Command("ZREVRANGE", tc.expected, 0, 0).Expect([]interface{}{})
+
+			r := NewRedis(pool, tc.opts...)
+
+			if _, err := r.GetMulti(context.Background(), projectID, []*datastore.Key{key}); err != nil {
+				t.Fatalf("failed to GetMulti entities: %+v", err)
+			}
+
+			if conn.Stats(cmd) != 1 {
+				t.Errorf("ZREVRANGE was not called for %s", tc.expected)
+			}
+		})
+	}
+}
+
+func TestRedis_compression(t *testing.T) {
+	conn, _ := initRedis(t)
+	r := NewRedis(&redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return conn, nil
+		},
+	}, WithCompression(compress.NewSnappy(), 0))
+
+	compressed, err := r.encode(projectID, entityResults[1])
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	envelope, err := codec.Open(compressed)
+
+	if err != nil {
+		t.Fatalf("failed to open envelope: %+v", err)
+	}
+
+	if compress.Codec(envelope.Payload[0]) != compress.CodecSnappy {
+		t.Fatalf("encoded entity has header %d (expected: %d)", envelope.Payload[0], compress.CodecSnappy)
+	}
+
+	// entries written before compression was enabled must remain readable
+	uncompressed, err := codec.Protobuf.Marshal(entityResults[2])
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	conn.Command("ZREVRANGE", keyenc.Encode(projectID, entityResults[1].Entity.Key), 0, 0).
+		Expect([]interface{}{compressed})
+	conn.Command("ZREVRANGE", keyenc.Encode(projectID, entityResults[2].Entity.Key), 0, 0).
+		Expect([]interface{}{uncompressed})
+
+	items, err := r.GetMulti(context.Background(), projectID, []*datastore.Key{
+		entityResults[1].Entity.Key,
+		entityResults[2].Entity.Key,
+	})
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti entities: %+v", err)
+	}
+
+	if diff := cmp.Diff(entityResults[1:3], items, ignoreXXX); diff != "" {
+		t.Errorf("returned values from GetMulti differed: %s", diff)
+	}
+}
+
+func TestRedis_EncodedSize(t *testing.T) {
+	conn, _ := initRedis(t)
+	r := NewRedis(initPool(conn), WithCompression(compress.NewSnappy(), 0))
+
+	entity := &datastore.EntityResult{
+		Entity: &datastore.Entity{
+			Key: entityResults[1].Entity.Key,
+			Properties: map[string]*datastore.Value{
+				"text": {ValueType: &datastore.Value_StringValue{StringValue: strings.Repeat("x", 2000)}},
+			},
+		},
+		Version: 1,
+	}
+
+	size, err := r.EncodedSize(projectID, entity)
+
+	if err != nil {
+		t.Fatalf("EncodedSize failed: %+v", err)
+	}
+
+	encoded, err := r.encode(projectID, entity)
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	if size != len(encoded) || size >= proto.Size(entity) {
+		t.Errorf("size of the compressed entry differed: %d (encoded: %d, proto: %d)", size, len(encoded), proto.Size(entity))
+	}
+}
+
+func TestRedis_codec(t *testing.T) {
+	conn, _ := initRedis(t)
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return conn, nil
+		},
+	}
+
+	metrics := cache.NewCounters()
+	r := NewRedis(pool, WithCodec(codec.JSON), WithMetrics(metrics))
+
+	encoded, err := r.encode(projectID, entityResults[1])
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	// entries written with another registered codec must remain readable
+	protobuf, err := NewRedis(pool).encode(projectID, entityResults[2])
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	corrupted := append([]byte{}, encoded...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	conn.Command("ZREVRANGE", keyenc.Encode(projectID, entityResults[1].Entity.Key), 0, 0).
+		Expect([]interface{}{encoded})
+	conn.Command("ZREVRANGE", keyenc.Encode(projectID, entityResults[2].Entity.Key), 0, 0).
+		Expect([]interface{}{protobuf})
+	conn.Command("ZREVRANGE", keyenc.Encode(projectID, entityResults[3].Entity.Key), 0, 0).
+		Expect([]interface{}{corrupted})
+	zrem := conn.Command("ZREM", keyenc.Encode(projectID, entityResults[3].Entity.Key), corrupted).Expect(1)
+
+	items, err := r.GetMulti(context.Background(), projectID, []*datastore.Key{
+		entityResults[1].Entity.Key,
+		entityResults[2].Entity.Key,
+		entityResults[3].Entity.Key,
+	})
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti entities: %+v", err)
+	}
+
+	expectedResults := []*datastore.EntityResult{
+		entityResults[1],
+		entityResults[2],
+		nil,
+	}
+
+	if diff := cmp.Diff(expectedResults, items, ignoreXXX); diff != "" {
+		t.Errorf("returned values from GetMulti differed: %s", diff)
+	}
+
+	if conn.Stats(zrem) != 1 {
+		t.Errorf("corrupted entry was not removed")
+	}
+
+	if v := metrics.Get(cache.MetricDecodeFailures, "kind"); v != 1 {
+		t.Errorf("decode failures differed: %d (expected: %d)", v, 1)
+	}
+}
+
+func TestRedis_signature(t *testing.T) {
+	conn, _ := initRedis(t)
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return conn, nil
+		},
+	}
+
+	metrics := cache.NewCounters()
+	r := NewRedis(pool, WithSigningKey([]byte("app-key")), WithMetrics(metrics))
+
+	signed, err := r.encode(projectID, entityResults[1])
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	unsigned, err := NewRedis(pool).encode(projectID, entityResults[3])
+
+	if err != nil {
+		t.Fatalf("failed to encode entity: %+v", err)
+	}
+
+	key1 := keyenc.Encode(projectID, entityResults[1].Entity.Key)
+	key2 := keyenc.Encode(projectID, entityResults[2].Entity.Key)
+	key3 := keyenc.Encode(projectID, entityResults[3].Entity.Key)
+
+	conn.Command("ZREVRANGE", key1, 0, 0).Expect([]interface{}{signed})
+	// the entry signed for key1 is swapped into key2
+	conn.Command("ZREVRANGE", key2, 0, 0).Expect([]interface{}{signed})
+	conn.Command("ZREVRANGE", key3, 0, 0).Expect([]interface{}{unsigned})
+	zrem2 := conn.Command("ZREM", key2, signed).Expect(1)
+	zrem3 := conn.Command("ZREM", key3, unsigned).Expect(1)
+
+	keys := []*datastore.Key{
+		entityResults[1].Entity.Key,
+		entityResults[2].Entity.Key,
+		entityResults[3].Entity.Key,
+	}
+
+	items, err := r.GetMulti(context.Background(), projectID, keys)
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti entities: %+v", err)
+	}
+
+	if diff := cmp.Diff([]*datastore.EntityResult{entityResults[1], nil, nil}, items, ignoreXXX); diff != "" {
+		t.Errorf("returned values from GetMulti differed: %s", diff)
+	}
+
+	if conn.Stats(zrem2) != 1 || conn.Stats(zrem3) != 1 {
+		t.Errorf("entries with invalid signature were not removed")
+	}
+
+	if v := metrics.Get(cache.MetricSignatureFailures, "kind"); v != 2 {
+		t.Errorf("signature failures differed: %d (expected: %d)", v, 2)
+	}
+
+	// readers without a signing key still read signed entries
+	items, err = NewRedis(pool).GetMulti(context.Background(), projectID, keys[:1])
+
+	if err != nil {
+		t.Fatalf("failed to GetMulti entities: %+v", err)
+	}
+
+	if diff := cmp.Diff(entityResults[1:2], items, ignoreXXX); diff != "" {
+		t.Errorf("returned values from GetMulti differed: %s", diff)
+	}
+}
@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/gomodule/redigo/redis"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+var (
+	_ cache.Sampler = &Redis{}
+	_ cache.Sizer   = &Redis{}
+)
+
+// Sample picks keys of projectID with n pipelined RANDOMKEY commands.
+// Pass keyenc.Project(projectID, databaseID) to pick keys of a database other than the default one.
+// Keys of other projects, databases, prefixes or schema versions are skipped, so fewer than n keys may be returned
+// when the Redis is shared with other data.
+func (r *Redis) Sample(_ context.Context, projectID string, n int) ([]*datastore.Key, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	replies, err := r.runInPipeline(func(conn redis.Conn) error {
+		for i := 0; i < n; i++ {
+			if err := conn.Send("RANDOMKEY"); err != nil {
+				return xerrors.Errorf("RANDOMKEY failed: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := r.keySpacePrefix()
+	seen := make(map[string]bool, len(replies))
+	keys := make([]*datastore.Key, 0, len(replies))
+
+	for i := range replies {
+		// RANDOMKEY returns nil when the database is empty
+		redisKey, err := redis.String(replies[i], nil)
+
+		if err != nil || seen[redisKey] || !strings.HasPrefix(redisKey, prefix) {
+			continue
+		}
+		seen[redisKey] = true
+
+		key, err := keyenc.Decode(redisKey[len(prefix):])
+
+		if err != nil || keyenc.Project(key.PartitionId.ProjectId, key.PartitionId.DatabaseId) != projectID {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func TestRedis_Sample(t *testing.T) {
+	conn, _ := initRedis(t)
+	r := NewRedis(initPool(conn), WithKeyPrefix("app"))
+
+	key := entityResults[1].Entity.Key
+	otherProject := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: "other-project"},
+		Path:        key.Path,
+	}
+
+	conn.Command("RANDOMKEY").
+		Expect([]byte(r.redisKey(projectID, key))).
+		Expect([]byte(r.redisKey(projectID, key))).
+		Expect([]byte("unrelated")).
+		Expect([]byte(r.redisKey(projectID, otherProject))).
+		Expect([]byte(keyenc.Encode(projectID, key))).
+		Expect(nil)
+
+	keys, err := r.Sample(context.Background(), projectID, 6)
+
+	if err != nil {
+		t.Fatalf("Sample failed: %+v", err)
+	}
+
+	if diff := cmp.Diff([]*datastore.Key{key}, keys, ignoreXXX); diff != "" {
+		t.Errorf("sampled keys differed: %s", diff)
+	}
+}
+
+func TestRedis_SampleDatabase(t *testing.T) {
+	conn, _ := initRedis(t)
+	r := NewRedis(initPool(conn))
+
+	key := entityResults[1].Entity.Key
+	inDatabase := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: projectID, DatabaseId: "db"},
+		Path:        key.Path,
+	}
+
+	conn.Command("RANDOMKEY").
+		Expect([]byte(r.redisKey(projectID, key))).
+		Expect([]byte(r.redisKey(projectID, inDatabase)))
+
+	keys, err := r.Sample(context.Background(), keyenc.Project(projectID, "db"), 2)
+
+	if err != nil {
+		t.Fatalf("Sample failed: %+v", err)
+	}
+
+	if diff := cmp.Diff([]*datastore.Key{inDatabase}, keys, ignoreXXX); diff != "" {
+		t.Errorf("sampled keys differed: %s", diff)
+	}
+}
@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"golang.org/x/xerrors"
+)
+
+// signatureMagic is the first byte of a signed entry.
+// Its wire type (7) is invalid in Protocol Buffers, so signed entries are never mistaken for other layouts.
+const signatureMagic byte = 0xff
+
+var errInvalidSignature = xerrors.New("invalid signature")
+
+// sign prefixes payload with an HMAC that covers both entityKey and payload,
+// so that the entry cannot be moved to another key.
+func (r *Redis) sign(entityKey string, payload []byte) []byte {
+	mac := r.mac(entityKey, payload)
+
+	signed := make([]byte, 0, 1+len(mac)+len(payload))
+	signed = append(signed, signatureMagic)
+	signed = append(signed, mac...)
+
+	return append(signed, payload...)
+}
+
+// verify checks the signature of data and returns the signed payload.
+// Without a signing key the signature is stripped but not verified.
+func (r *Redis) verify(entityKey string, data []byte) ([]byte, error) {
+	signed := len(data) > 0 && data[0] == signatureMagic
+
+	if r.signingKey == nil {
+		if signed && len(data) >= 1+sha256.Size {
+			return data[1+sha256.Size:], nil
+		}
+
+		return data, nil
+	}
+
+	if !signed || len(data) < 1+sha256.Size {
+		return nil, xerrors.Errorf("missing signature: %w", errInvalidSignature)
+	}
+
+	mac, payload := data[1:1+sha256.Size], data[1+sha256.Size:]
+
+	if !hmac.Equal(mac, r.mac(entityKey, payload)) {
+		return nil, errInvalidSignature
+	}
+
+	return payload, nil
+}
+
+func (r *Redis) mac(entityKey string, payload []byte) []byte {
+	h := hmac.New(sha256.New, r.signingKey)
+
+	// the length prevents ambiguity between the key and the payload
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(entityKey)))
+
+	// nolint:errcheck
+	h.Write(length[:])
+	// nolint:errcheck
+	h.Write([]byte(entityKey))
+	// nolint:errcheck
+	h.Write(payload)
+
+	return h.Sum(nil)
+}
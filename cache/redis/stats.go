@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/gomodule/redigo/redis"
+	"golang.org/x/xerrors"
+)
+
+// KindStats is the usage of Redis by the entities of a kind.
+type KindStats struct {
+	// Keys is the number of cached entities.
+	Keys int64 `json:"keys"`
+	// Bytes is the memory used by the entities, as reported by MEMORY USAGE.
+	Bytes int64 `json:"bytes"`
+}
+
+// Stats counts the entities selected by filter and their memory usage, indexed by kind.
+// It walks the keys with SCAN, so it is slow on a large Redis.
+func (r *Redis) Stats(_ context.Context, filter *cache.FlushFilter) (map[string]*KindStats, error) {
+	stats := map[string]*KindStats{}
+
+	err := r.scan(filter, func(conn redis.Conn, keys []string) error {
+		for i := range keys {
+			if err := conn.Send("MEMORY", "USAGE", keys[i]); err != nil {
+				return xerrors.Errorf("MEMORY USAGE failed: %w", err)
+			}
+		}
+
+		usages, err := redis.Values(conn.Do(""))
+
+		if err != nil {
+			return xerrors.Errorf("failed to flush pipeline: %w", err)
+		}
+
+		for i := range usages {
+			// the key may have been removed after SCAN
+			usage, err := redis.Int64(usages[i], nil)
+
+			if err != nil && err != redis.ErrNil {
+				return xerrors.Errorf("failed to parse memory usage: %w", err)
+			}
+
+			kind := r.kindOfKey(keys[i])
+
+			if stats[kind] == nil {
+				stats[kind] = &KindStats{}
+			}
+
+			stats[kind].Keys++
+			stats[kind].Bytes += usage
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// kindOfKey returns the kind of the entity stored in the Redis key.
+func (r *Redis) kindOfKey(redisKey string) string {
+	// keys are selected by matchFlushFilter, so they are always valid
+	kind, _ := keyenc.Kind(redisKey[len(r.keySpacePrefix()):])
+
+	return kind
+}
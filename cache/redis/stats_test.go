@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedis_Stats(t *testing.T) {
+	conn, r := initRedis(t)
+
+	keys := []interface{}{
+		[]byte(r.redisKey(projectID, entityResults[0].Entity.Key)),
+		[]byte(r.redisKey(projectID, entityResults[2].Entity.Key)),
+	}
+
+	conn.Command("SCAN", int64(0), "MATCH", "project-id:*", "COUNT", scanCount).
+		Expect([]interface{}{[]byte("0"), keys})
+	conn.Command("MEMORY", "USAGE", string(keys[0].([]byte))).Expect(int64(100))
+	conn.Command("MEMORY", "USAGE", string(keys[1].([]byte))).Expect(int64(50))
+
+	stats, err := r.Stats(context.Background(), &cache.FlushFilter{ProjectID: projectID})
+
+	if err != nil {
+		t.Fatalf("failed to get stats: %+v", err)
+	}
+
+	expected := map[string]*KindStats{
+		"kind": {Keys: 2, Bytes: 150},
+	}
+
+	if diff := cmp.Diff(expected, stats); diff != "" {
+		t.Errorf("stats differed: %s", diff)
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	// MetricShadowHits - Number of cache hits of ShadowKinds compared against Datastore.
+	//                      └── Datastoreと比較したShadowKindsのキャッシュヒット数。
+	MetricShadowHits = "shadow_hits"
+
+	// MetricShadowVersionMismatches - Number of cache hits whose version differed from Datastore.
+	//                                   └── バージョンがDatastoreと異なったキャッシュヒット数。
+	// Entities cached but missing in Datastore are also counted.
+	//    └── キャッシュされているがDatastoreに存在しないエンティティも数える。
+	MetricShadowVersionMismatches = "shadow_version_mismatches"
+
+	// MetricShadowPropertyMismatches - Number of cache hits whose version matched but properties differed from Datastore.
+	//                                    └── バージョンは一致したが、プロパティがDatastoreと異なったキャッシュヒット数。
+	MetricShadowPropertyMismatches = "shadow_property_mismatches"
+)
+
+// isShadowed - Whether the entity pointed by key is looked up in shadow mode.
+//                └── keyが指すエンティティをシャドウモードで取得するかどうか。
+func (m *Middleware) isShadowed(key *datastore.Key) bool {
+	return m.ShadowKinds[KindOf(key)]
+}
+
+// takeShadowed - Move cache hits of ShadowKinds out of items.
+//                  └── ShadowKindsのキャッシュヒットをitemsから取り出す。
+// The keys of the returned entities are looked up in Datastore as cache misses.
+//    └── 取り出したエンティティのキーはキャッシュミスとしてDatastoreから取得される。
+func (m *Middleware) takeShadowed(keys []*datastore.Key, items []*datastore.EntityResult) []*datastore.EntityResult {
+	if len(m.ShadowKinds) == 0 {
+		return nil
+	}
+
+	var shadowed []*datastore.EntityResult
+	for i := range items {
+		if items[i] != nil && m.isShadowed(keys[i]) {
+			shadowed = append(shadowed, items[i])
+			items[i] = nil
+		}
+	}
+
+	return shadowed
+}
+
+// compareShadowed - Compare cache hits of ShadowKinds with the reply of Datastore.
+//                     └── ShadowKindsのキャッシュヒットをDatastoreの応答と比較する。
+// Entities are compared after PropertyPolicies are applied, as they would have been cached.
+//    └── エンティティはキャッシュされる時と同じく、PropertyPoliciesを適用した後に比較する。
+func (m *Middleware) compareShadowed(
+	projectID string,
+	shadowed []*datastore.EntityResult,
+	reply *datastore.LookupResponse,
+) {
+	if len(shadowed) == 0 {
+		return
+	}
+
+	found := make(map[string]*datastore.EntityResult, len(reply.GetFound()))
+	for _, e := range m.transformBeforeCache(reply.GetFound()) {
+		found[keyenc.Encode(projectID, e.GetEntity().GetKey())] = e
+	}
+
+	missing := make(map[string]bool, len(reply.GetMissing()))
+	for _, e := range reply.GetMissing() {
+		missing[keyenc.Encode(projectID, e.GetEntity().GetKey())] = true
+	}
+
+	for _, cached := range shadowed {
+		key := cached.GetEntity().GetKey()
+		encoded := keyenc.Encode(projectID, key)
+
+		actual, ok := found[encoded]
+		if !ok && !missing[encoded] {
+			// deferred, or not cached by PropertyPolicies
+			continue
+		}
+
+		m.addMetric(MetricShadowHits, key, 1)
+
+		switch {
+		case !ok || actual.Version != cached.Version:
+			m.addMetric(MetricShadowVersionMismatches, key, 1)
+			m.logPrintf("shadow: version of %s differed: cached %d, datastore %d", encoded, cached.Version, actual.GetVersion())
+		case !proto.Equal(actual.Entity, cached.Entity):
+			m.addMetric(MetricShadowPropertyMismatches, key, 1)
+			m.logPrintf("shadow: properties of %s differed at version %d", encoded, cached.Version)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/mock"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+)
+
+func TestCacheMiddleware_lookupWithShadowKinds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	stale := newUserEntity(testKeys2[0])
+	stale.Version = 1
+	modified := newUserEntity(testKeys2[1])
+	modified.Version = 5
+	deleted := newUserEntity(testKeys2[2])
+	notShadowed := newUserEntity(testKeys2[3])
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, testKeys2).
+		Return([]*datastore.EntityResult{stale, modified, deleted, notShadowed}, nil)
+	m.EXPECT().
+		SetMulti(ctx, projectID, gomock.Any()).
+		Return(nil)
+
+	latest := newUserEntity(testKeys2[0])
+	latest.Version = 2
+	updated := newUserEntity(testKeys2[1])
+	updated.Version = 5
+	updated.Entity.Properties["Name"] = &datastore.Value{
+		ValueType: &datastore.Value_StringValue{StringValue: "updated"},
+	}
+
+	var requested []*datastore.Key
+	invoker := func(
+		ctx context.Context,
+		method string,
+		req,
+		reply interface{},
+		cc *grpc.ClientConn,
+		opts ...grpc.CallOption,
+	) error {
+		requested = req.(*datastore.LookupRequest).Keys
+		reply.(*datastore.LookupResponse).Found = []*datastore.EntityResult{latest, updated}
+		reply.(*datastore.LookupResponse).Missing = []*datastore.EntityResult{
+			{Entity: &datastore.Entity{Key: testKeys2[2]}},
+		}
+
+		return nil
+	}
+
+	counters := NewCounters()
+
+	c := NewMiddleware(m)
+	c.Metrics = counters
+	c.ShadowKinds = map[string]bool{"a": true, "b": true, "c": true}
+
+	req := &datastore.LookupRequest{
+		ProjectId: projectID,
+		Keys:      testKeys2,
+	}
+	reply := new(datastore.LookupResponse)
+
+	if err := c.lookup(ctx, CachingModeReadWrite, "", req, reply, new(grpc.ClientConn), invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requested) != 3 {
+		t.Errorf("cache hits of ShadowKinds must be looked up in Datastore: %d keys", len(requested))
+	}
+
+	if len(reply.Found) != 3 || reply.Found[0] != notShadowed || reply.Found[1] != latest || reply.Found[2] != updated {
+		t.Errorf("reply of Datastore was not returned: %v", reply.Found)
+	}
+
+	if len(reply.Missing) != 1 {
+		t.Errorf("deleted entity was not returned as missing: %v", reply.Missing)
+	}
+
+	expected := map[string]map[string]int64{
+		MetricShadowHits:               {"a": 1, "b": 1, "c": 1},
+		MetricShadowVersionMismatches:  {"a": 1, "c": 1},
+		MetricShadowPropertyMismatches: {"b": 1},
+	}
+
+	for name, kinds := range expected {
+		for kind, v := range kinds {
+			if actual := counters.Get(name, kind); actual != v {
+				t.Errorf("%s of %s differed: %d (expected: %d)", name, kind, actual, v)
+			}
+		}
+	}
+
+	if actual := counters.Get(MetricShadowHits, "d"); actual != 0 {
+		t.Errorf("kinds not in ShadowKinds must not be compared: %d", actual)
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+type statsKey struct{}
+
+// statsCategory - Index of the keys recorded in Stats.
+//                   └── Statsに記録するキーの添字。
+type statsCategory int
+
+const (
+	statsServed statsCategory = iota
+	statsFetched
+	statsWritten
+	statsInvalidated
+	statsCategories
+)
+
+// Stats - Keys handled by Middleware for the requests made with a context.
+//           └── あるコンテキストで行われたリクエストに対し、Middlewareが扱ったキー。
+// Keys are recorded once per operation, so they may appear more than once.
+//    └── キーは操作ごとに記録されるため、複数回現れることがある。
+type Stats struct {
+	mu   sync.Mutex
+	keys [statsCategories][]*datastore.Key
+}
+
+// WithStats - Attach a new Stats to ctx. Middleware records the keys of calls made with the returned context.
+//               └── ctxに新しいStatsを付与する。返されたコンテキストでの呼び出しのキーをMiddlewareが記録する。
+func WithStats(ctx context.Context) (context.Context, *Stats) {
+	stats := &Stats{}
+
+	return context.WithValue(ctx, statsKey{}, stats), stats
+}
+
+// statsFrom - Stats attached to ctx, or nil.
+//               └── ctxに付与されたStats。無い場合はnil。
+func statsFrom(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(statsKey{}).(*Stats)
+
+	return stats
+}
+
+// Served - Keys whose entities were returned from the cache.
+//            └── キャッシュからエンティティを返したキー。
+func (s *Stats) Served() []*datastore.Key {
+	return s.get(statsServed)
+}
+
+// Fetched - Keys looked up in Datastore, whether they were found or not.
+//             └── Datastoreで検索したキー。見つかったかどうかは問わない。
+// Queries are not intercepted and are not recorded.
+//    └── クエリはインターセプトされないため記録されない。
+func (s *Stats) Fetched() []*datastore.Key {
+	return s.get(statsFetched)
+}
+
+// Written - Keys whose entities were written to the cache after Lookup.
+//             └── Lookup後にエンティティをキャッシュに書き込んだキー。
+func (s *Stats) Written() []*datastore.Key {
+	return s.get(statsWritten)
+}
+
+// Invalidated - Keys deleted from the cache around Commit.
+//                 └── Commitの前後にキャッシュから削除したキー。
+func (s *Stats) Invalidated() []*datastore.Key {
+	return s.get(statsInvalidated)
+}
+
+func (s *Stats) get(category statsCategory) []*datastore.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*datastore.Key(nil), s.keys[category]...)
+}
+
+// add - Record keys. Nothing is recorded if s is nil.
+//         └── keysを記録する。sがnilの場合は何も記録しない。
+func (s *Stats) add(category statsCategory, keys ...*datastore.Key) {
+	if s == nil || len(keys) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[category] = append(s.keys[category], keys...)
+}
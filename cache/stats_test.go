@@ -0,0 +1,94 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	pb "google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func keyNames(keys []*pb.Key) []string {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.Path[len(key.Path)-1].GetName())
+	}
+	return names
+}
+
+func equalNames(keys []*pb.Key, names ...string) bool {
+	actual := keyNames(keys)
+	if len(actual) != len(names) {
+		return false
+	}
+	for i := range names {
+		if actual[i] != names[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWithStats(t *testing.T) {
+	srv, client, _ := newDstestClients(t)
+	defer srv.Close()
+
+	foo := datastore.NameKey("test", "foo", nil)
+	bar := datastore.NameKey("test", "bar", nil)
+
+	ctx, stats := cache.WithStats(context.Background())
+
+	entities := []*dstestData{{Name: "foo"}, {Name: "bar"}}
+	if _, err := client.PutMulti(ctx, []*datastore.Key{foo, bar}, entities); err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	// Deleted before and after Commit
+	//    └── Commitの前後で削除される
+	if !equalNames(stats.Invalidated(), "foo", "bar", "foo", "bar") {
+		t.Errorf("unexpected invalidated keys: %v", keyNames(stats.Invalidated()))
+	}
+
+	var data dstestData
+	if err := client.Get(ctx, foo, &data); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+
+	if !equalNames(stats.Fetched(), "foo") || !equalNames(stats.Written(), "foo") || len(stats.Served()) != 0 {
+		t.Errorf("unexpected stats after a miss: %v, %v, %v",
+			keyNames(stats.Fetched()), keyNames(stats.Written()), keyNames(stats.Served()))
+	}
+
+	// A request that did not read Datastore
+	//    └── Datastoreを読まなかったリクエスト
+	handlerCtx, handlerStats := cache.WithStats(ctx)
+	if err := client.Get(handlerCtx, foo, &data); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+
+	if len(handlerStats.Fetched()) != 0 || !equalNames(handlerStats.Served(), "foo") {
+		t.Errorf("unexpected stats after a hit: %v, %v",
+			keyNames(handlerStats.Fetched()), keyNames(handlerStats.Served()))
+	}
+	if len(stats.Served()) != 0 {
+		t.Errorf("keys were recorded in the outer stats: %v", keyNames(stats.Served()))
+	}
+
+	// Lookup in a transaction bypasses the cache
+	//    └── トランザクション内のLookupはキャッシュを通らない
+	txCtx, txStats := cache.WithStats(context.Background())
+	tx, err := client.NewTransaction(txCtx)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %+v", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.Get(bar, &data); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+
+	if !equalNames(txStats.Fetched(), "bar") || len(txStats.Served()) != 0 {
+		t.Errorf("unexpected stats in a transaction: %v", keyNames(txStats.Fetched()))
+	}
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// TransformFunc - Function that transforms an entity around the cache.
+//                   └── キャッシュの前後でエンティティを変換する関数。
+// entity may be modified in place. Returning nil means the entity is not cached, or is treated as a cache miss.
+//    └── entityは直接変更してよい。nilを返した場合はキャッシュしない、またはキャッシュミスとして扱う。
+type TransformFunc = func(entity *datastore.EntityResult) *datastore.EntityResult
+
+// PropertyPolicy - Transformation of the entities of a kind before caching and after retrieval.
+//                    └── あるkindのエンティティに対する、キャッシュ前と取得後の変換。
+type PropertyPolicy struct {
+	// ExcludeProperties - Properties that are never written to the cache, such as tokens and password hashes.
+	//                       └── トークンやパスワードハッシュなど、キャッシュに書き込まないプロパティ。
+	// Cached entities lack them, so they are returned only to Lookups that declared their properties
+	// with WithRequiredProperties and do not require one of them. Other Lookups fall through to Datastore.
+	//    └── キャッシュしたエンティティはこれらを持たないため、WithRequiredPropertiesでプロパティを宣言し、
+	//    └── かつこれらを要求していないLookupにのみ返す。それ以外のLookupはDatastoreから取得する。
+	ExcludeProperties []string
+	// BeforeCache - Called with a copy of the entity after ExcludeProperties are removed and before it is cached.
+	//                 └── ExcludePropertiesを取り除いた後、キャッシュする前にエンティティのコピーを渡して呼ばれる。
+	BeforeCache TransformFunc
+	// AfterRetrieve - Called with the entity retrieved from the cache before it is returned.
+	//                   └── キャッシュから取得したエンティティを返す前に呼ばれる。
+	AfterRetrieve TransformFunc
+}
+
+type requiredPropertiesKey struct{}
+
+// WithRequiredProperties - Declare that the caller needs properties.
+//                            └── 呼び出し元がプロパティを必要としていることを宣言する。
+// Lookups with the returned context do not use cached entities whose PropertyPolicy excludes one of properties,
+// and accept cached entities without the other excluded properties. Call it without properties to accept all.
+// Lookups without the declaration never get entities lacking excluded properties.
+//    └── 返されたcontextでのLookupは、PropertyPolicyでいずれかのプロパティを除外しているキャッシュを使わず、
+//    └── その他の除外されたプロパティを持たないキャッシュを受け入れる。プロパティを渡さずに呼ぶと全てを受け入れる。
+//    └── 宣言の無いLookupが、除外されたプロパティを持たないエンティティを受け取ることはない。
+func WithRequiredProperties(ctx context.Context, properties ...string) context.Context {
+	required := map[string]struct{}{}
+	if parent, ok := ctx.Value(requiredPropertiesKey{}).(map[string]struct{}); ok {
+		for p := range parent {
+			required[p] = struct{}{}
+		}
+	}
+	for _, p := range properties {
+		required[p] = struct{}{}
+	}
+
+	return context.WithValue(ctx, requiredPropertiesKey{}, required)
+}
+
+// requiresExcluded - Report whether ctx requires a property excluded by p.
+//                      └── ctxがpで除外しているプロパティを必要としているかを返す。
+// A context without the declaration requires all properties.
+//    └── 宣言の無いcontextは全てのプロパティを必要とする。
+func (p *PropertyPolicy) requiresExcluded(ctx context.Context) bool {
+	if len(p.ExcludeProperties) == 0 {
+		return false
+	}
+
+	required, ok := ctx.Value(requiredPropertiesKey{}).(map[string]struct{})
+	if !ok {
+		return true
+	}
+
+	for _, name := range p.ExcludeProperties {
+		if _, ok := required[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// beforeCache - Copy entity and transform it to be cached.
+//                 └── entityをコピーし、キャッシュするために変換する。
+func (p *PropertyPolicy) beforeCache(entity *datastore.EntityResult) *datastore.EntityResult {
+	entity = proto.Clone(entity).(*datastore.EntityResult)
+
+	if entity.Entity != nil {
+		for _, name := range p.ExcludeProperties {
+			delete(entity.Entity.Properties, name)
+		}
+	}
+
+	if p.BeforeCache == nil {
+		return entity
+	}
+	return p.BeforeCache(entity)
+}
+
+// afterRetrieve - Transform entity retrieved from the cache.
+//                   └── キャッシュから取得したentityを変換する。
+func (p *PropertyPolicy) afterRetrieve(ctx context.Context, entity *datastore.EntityResult) *datastore.EntityResult {
+	if p.requiresExcluded(ctx) {
+		return nil
+	}
+
+	if p.AfterRetrieve == nil {
+		return entity
+	}
+	return p.AfterRetrieve(entity)
+}
+
+// propertyPolicy - Get the PropertyPolicy for the kind of key.
+//                    └── keyのkindに対するPropertyPolicyを取得する。
+func (m *Middleware) propertyPolicy(key *datastore.Key) *PropertyPolicy {
+	if m.PropertyPolicies == nil {
+		return nil
+	}
+	return m.PropertyPolicies[KindOf(key)]
+}
+
+// transformBeforeCache - Apply PropertyPolicies to entities before caching.
+//                          └── キャッシュする前にエンティティにPropertyPoliciesを適用する。
+func (m *Middleware) transformBeforeCache(entities []*datastore.EntityResult) []*datastore.EntityResult {
+	if len(m.PropertyPolicies) == 0 {
+		return entities
+	}
+
+	transformed := make([]*datastore.EntityResult, 0, len(entities))
+	for _, e := range entities {
+		if p := m.propertyPolicy(e.GetEntity().GetKey()); p != nil {
+			e = p.beforeCache(e)
+		}
+		if e != nil {
+			transformed = append(transformed, e)
+		}
+	}
+
+	return transformed
+}
+
+// transformAfterRetrieve - Apply PropertyPolicies to items retrieved from the cache in place.
+//                            └── キャッシュから取得したitemsにPropertyPoliciesを適用する。
+func (m *Middleware) transformAfterRetrieve(
+	ctx context.Context,
+	keys []*datastore.Key,
+	items []*datastore.EntityResult,
+) {
+	if len(m.PropertyPolicies) == 0 {
+		return
+	}
+
+	for i := range items {
+		if items[i] == nil {
+			continue
+		}
+		if p := m.propertyPolicy(keys[i]); p != nil {
+			items[i] = p.afterRetrieve(ctx, items[i])
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/mock"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func newUserEntity(key *datastore.Key) *datastore.EntityResult {
+	return &datastore.EntityResult{
+		Entity: &datastore.Entity{
+			Key: key,
+			Properties: map[string]*datastore.Value{
+				"Name": {
+					ValueType: &datastore.Value_StringValue{StringValue: "name"},
+				},
+				"Token": {
+					ValueType: &datastore.Value_StringValue{StringValue: "secret"},
+				},
+			},
+		},
+		Version: 1,
+	}
+}
+
+func TestCacheMiddleware_afterLookupWithPropertyPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+	found := newUserEntity(testKeys[0])
+
+	m.EXPECT().
+		SetMulti(ctx, projectID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, items []*datastore.EntityResult) error {
+			if len(items) != 1 {
+				t.Fatalf("SetMulti received %d entities (expected: %d)", len(items), 1)
+			}
+			if _, ok := items[0].Entity.Properties["Token"]; ok {
+				t.Errorf("excluded property was cached")
+			}
+			if _, ok := items[0].Entity.Properties["Name"]; !ok {
+				t.Errorf("property was not cached")
+			}
+			return nil
+		})
+
+	c := NewMiddleware(m)
+	c.PropertyPolicies = map[string]*PropertyPolicy{
+		"a": {ExcludeProperties: []string{"Token"}},
+	}
+
+	req := &datastore.LookupRequest{
+		ProjectId: projectID,
+		Keys:      testKeys,
+	}
+	reply := &datastore.LookupResponse{
+		Found: []*datastore.EntityResult{found},
+	}
+
+	if err := c.afterLookup(ctx, req, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := found.Entity.Properties["Token"]; !ok {
+		t.Errorf("entity returned to the caller was redacted")
+	}
+}
+
+func TestCacheMiddleware_beforeLookupWithPropertyPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	cached := newUserEntity(testKeys[0])
+	delete(cached.Entity.Properties, "Token")
+
+	m.EXPECT().
+		GetMulti(gomock.Any(), projectID, gomock.Any()).
+		Return([]*datastore.EntityResult{cached}, nil).
+		Times(3)
+
+	retrieved := 0
+
+	c := NewMiddleware(m)
+	c.PropertyPolicies = map[string]*PropertyPolicy{
+		"a": {
+			ExcludeProperties: []string{"Token"},
+			AfterRetrieve: func(entity *datastore.EntityResult) *datastore.EntityResult {
+				retrieved++
+				return entity
+			},
+		},
+	}
+
+	req := &datastore.LookupRequest{
+		ProjectId: projectID,
+		Keys:      testKeys,
+	}
+	reply := new(datastore.LookupResponse)
+
+	// the caller accepts entities without the excluded properties
+	if _, err := c.beforeLookup(WithRequiredProperties(context.Background()), req, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reply.Found) != 1 || len(req.Keys) != 0 || retrieved != 1 {
+		t.Errorf("cached entity was not used: found %d, keys %d, retrieved %d", len(reply.Found), len(req.Keys), retrieved)
+	}
+
+	// the caller did not declare its properties, so it may need the excluded ones
+	req = &datastore.LookupRequest{
+		ProjectId: projectID,
+		Keys:      testKeys,
+	}
+	reply = new(datastore.LookupResponse)
+
+	if _, err := c.beforeLookup(context.Background(), req, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reply.Found) != 0 || len(req.Keys) != 1 {
+		t.Errorf("redacted entity was returned without the declaration: found %d, keys %d", len(reply.Found), len(req.Keys))
+	}
+
+	// the caller needs the excluded property
+	ctx := WithRequiredProperties(context.Background(), "Token")
+	req = &datastore.LookupRequest{
+		ProjectId: projectID,
+		Keys:      testKeys,
+	}
+	reply = new(datastore.LookupResponse)
+
+	if _, err := c.beforeLookup(ctx, req, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reply.Found) != 0 || len(req.Keys) != 1 {
+		t.Errorf("redacted entity must fall through to Datastore: found %d, keys %d", len(reply.Found), len(req.Keys))
+	}
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+)
+
+// restMethodPattern - Path of lookup and commit of the Datastore REST API.
+//                       └── DatastoreのREST APIのlookupとcommitのパス。
+var restMethodPattern = regexp.MustCompile(`/v1/projects/([^/]+):(lookup|commit)$`)
+
+// Transport - http.RoundTripper that applies Middleware to lookup and commit of the Datastore REST API.
+//               └── DatastoreのREST APIのlookupとcommitにMiddlewareを適用するhttp.RoundTripper。
+// Bodies are converted to the same protos as gRPC, so REST and gRPC clients share one cache.
+// CachingModeFunc receives a nil *grpc.ClientConn for REST requests.
+//    └── ボディはgRPCと同じprotoに変換されるため、RESTとgRPCのクライアントは一つのキャッシュを共有する。
+//    └── RESTのリクエストではCachingModeFuncはnilの*grpc.ClientConnを受け取る。
+type Transport struct {
+	middleware *Middleware
+	base       http.RoundTripper
+}
+
+var _ http.RoundTripper = &Transport{}
+
+// NewTransport - Initialize Transport sending requests through base. http.DefaultTransport is used if base is nil.
+//                  └── baseを通してリクエストを送るTransportを初期化する。baseがnilの場合はhttp.DefaultTransportを使う。
+func NewTransport(m *Middleware, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		middleware: m,
+		base:       base,
+	}
+}
+
+// restCall - Result of the request sent to the REST API by the invoker.
+//              └── invokerがREST APIに送ったリクエストの結果。
+type restCall struct {
+	resp *http.Response
+}
+
+// errRESTFailed - Returned by the invoker when the REST API responded with an error, which is passed to the caller.
+//                   └── REST APIがエラーを返した場合にinvokerが返す。エラーの応答は呼び出し元に渡される。
+var errRESTFailed = xerrors.New("REST API responded with an error")
+
+// RoundTrip - Apply Middleware to lookup and commit, and send other requests through as they are.
+//               └── lookupとcommitにMiddlewareを適用し、その他のリクエストはそのまま送る。
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	matches := restMethodPattern.FindStringSubmatch(req.URL.Path)
+	if req.Method != http.MethodPost || matches == nil || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read request body: %w", err)
+	}
+
+	var (
+		method     UnaryClientMethod
+		protoReq   proto.Message
+		protoReply proto.Message
+	)
+
+	switch matches[2] {
+	case "lookup":
+		lookupReq := &datastore.LookupRequest{}
+		method, protoReq, protoReply = UnaryClientMethodLookup, lookupReq, &datastore.LookupResponse{}
+		err = unmarshalRESTRequest(body, lookupReq)
+		lookupReq.ProjectId = matches[1]
+	default:
+		commitReq := &datastore.CommitRequest{}
+		method, protoReq, protoReply = UnaryClientMethodCommit, commitReq, &datastore.CommitResponse{}
+		err = unmarshalRESTRequest(body, commitReq)
+		commitReq.ProjectId = matches[1]
+	}
+
+	if err != nil {
+		// Send bodies with fields unknown to the proto as they are, since re-encoding would drop them.
+		// Malformed bodies are reported by the REST API.
+		//    └── protoが知らないフィールドを持つボディは、再エンコードで失われるためそのまま送る。
+		//    └── 不正なボディはREST APIに報告させる。
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return t.base.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	if control := req.Header.Get(CacheControlHeader); control != "" {
+		ctx = WithCacheControl(ctx, CacheControl(control))
+	}
+
+	call := &restCall{}
+
+	invoker := func(ctx context.Context, _ string, in, out interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		return t.invoke(ctx, req, in.(proto.Message), out.(proto.Message), call)
+	}
+
+	err = t.middleware.UnaryClientInterceptor(ctx, method, protoReq, protoReply, nil, invoker)
+	if xerrors.Is(err, errRESTFailed) {
+		return call.resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newRESTResponse(req, call.resp, protoReply)
+}
+
+// invoke - Send in to the REST API and decode the response into out.
+//            └── inをREST APIに送り、応答をoutにデコードする。
+func (t *Transport) invoke(
+	ctx context.Context,
+	original *http.Request,
+	in, out proto.Message,
+	call *restCall,
+) error {
+	// The project is in the path, not in the body
+	//    └── プロジェクトはボディではなくパスにある
+	in = proto.Clone(in)
+	switch r := in.(type) {
+	case *datastore.LookupRequest:
+		r.ProjectId = ""
+	case *datastore.CommitRequest:
+		r.ProjectId = ""
+	}
+
+	var body bytes.Buffer
+	if err := (&jsonpb.Marshaler{}).Marshal(&body, in); err != nil {
+		return xerrors.Errorf("failed to encode request: %w", err)
+	}
+
+	req := original.WithContext(ctx)
+	req.Header = cloneHeader(original.Header)
+	// Let base negotiate the compression so that the response can be decoded
+	//    └── 応答をデコードできるよう、圧縮の交渉はbaseに任せる
+	req.Header.Del("Accept-Encoding")
+	req.Body = ioutil.NopCloser(&body)
+	req.ContentLength = int64(body.Len())
+	req.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	call.resp = resp
+
+	if resp.StatusCode != http.StatusOK {
+		return errRESTFailed
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return xerrors.Errorf("failed to read response body: %w", err)
+	}
+
+	if err := unmarshalRESTResponse(respBody, out); err != nil {
+		return xerrors.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// newRESTResponse - Encode reply as the response to req. Headers are copied from upstream if it was called.
+//                     └── replyをreqへの応答としてエンコードする。upstreamが呼ばれた場合はヘッダをコピーする。
+func newRESTResponse(req *http.Request, upstream *http.Response, reply proto.Message) (*http.Response, error) {
+	var body bytes.Buffer
+	if err := (&jsonpb.Marshaler{}).Marshal(&body, reply); err != nil {
+		return nil, xerrors.Errorf("failed to encode response: %w", err)
+	}
+
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    req,
+	}
+
+	if upstream != nil {
+		resp.Header = cloneHeader(upstream.Header)
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = upstream.Proto, upstream.ProtoMajor, upstream.ProtoMinor
+	} else {
+		resp.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+	resp.ContentLength = int64(body.Len())
+	resp.Body = ioutil.NopCloser(&body)
+
+	return resp, nil
+}
+
+// unmarshalRESTRequest - Decode a request body, failing on fields unknown to m.
+//                          └── リクエストのボディをデコードする。mが知らないフィールドがある場合は失敗する。
+func unmarshalRESTRequest(body []byte, m proto.Message) error {
+	return (&jsonpb.Unmarshaler{}).Unmarshal(bytes.NewReader(body), m)
+}
+
+// unmarshalRESTResponse - Decode a response body, ignoring fields unknown to m.
+//                           └── 応答のボディをデコードする。mが知らないフィールドは無視する。
+// Only the fields known to m are needed to cache the response.
+//    └── 応答をキャッシュするにはmが知っているフィールドのみが必要となる。
+func unmarshalRESTResponse(body []byte, m proto.Message) error {
+	return (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(bytes.NewReader(body), m)
+}
+
+func cloneHeader(header http.Header) http.Header {
+	cloned := make(http.Header, len(header))
+	for k, v := range header {
+		cloned[k] = append([]string(nil), v...)
+	}
+
+	return cloned
+}
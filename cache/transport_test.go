@@ -0,0 +1,230 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/dstest"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	dsapi "google.golang.org/api/datastore/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	pb "google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+)
+
+const restProjectID = "project-id-in-rest"
+
+var restPath = regexp.MustCompile(`^/v1/projects/([^/]+):(lookup|commit)$`)
+
+// restGateway - Serve lookup and commit of the REST API by forwarding them to client.
+//                 └── REST APIのlookupとcommitをclientに転送して提供する。
+func restGateway(t *testing.T, client pb.DatastoreClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matches := restPath.FindStringSubmatch(r.URL.Path)
+		if matches == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %+v", err)
+		}
+
+		var reply proto.Message
+		switch matches[2] {
+		case "lookup":
+			req := &pb.LookupRequest{}
+			if err = jsonpb.Unmarshal(bytes.NewReader(body), req); err == nil {
+				req.ProjectId = matches[1]
+				reply, err = client.Lookup(r.Context(), req)
+			}
+		case "commit":
+			req := &pb.CommitRequest{}
+			if err = jsonpb.Unmarshal(bytes.NewReader(body), req); err == nil {
+				req.ProjectId = matches[1]
+				reply, err = client.Commit(r.Context(), req)
+			}
+		}
+
+		if err != nil {
+			http.Error(w, `{"error": {"code": 400, "message": "bad request"}}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		if err := (&jsonpb.Marshaler{}).Marshal(w, reply); err != nil {
+			t.Errorf("failed to encode reply: %+v", err)
+		}
+	})
+}
+
+func TestTransport(t *testing.T) {
+	srv := dstest.NewServer()
+	defer srv.Close()
+
+	middleware := cache.NewMiddleware(fake.NewCache())
+
+	conn, err := srv.Dial()
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	gateway := httptest.NewServer(restGateway(t, pb.NewDatastoreClient(conn)))
+	defer gateway.Close()
+
+	ctx := context.Background()
+
+	rest, err := dsapi.NewService(ctx,
+		option.WithHTTPClient(&http.Client{Transport: cache.NewTransport(middleware, nil)}),
+		option.WithEndpoint(gateway.URL+"/"),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize REST client: %+v", err)
+	}
+
+	key := &dsapi.Key{Path: []*dsapi.PathElement{{Kind: "test", Name: "foo"}}}
+	entity := &dsapi.Entity{Key: key, Properties: map[string]dsapi.Value{"Name": {StringValue: "foo"}}}
+
+	_, err = rest.Projects.Commit(restProjectID, &dsapi.CommitRequest{
+		Mode:      "NON_TRANSACTIONAL",
+		Mutations: []*dsapi.Mutation{{Upsert: entity}},
+	}).Do()
+	if err != nil {
+		t.Fatalf("failed to commit: %+v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := rest.Projects.Lookup(restProjectID, &dsapi.LookupRequest{Keys: []*dsapi.Key{key}}).Do()
+		if err != nil {
+			t.Fatalf("failed to lookup: %+v", err)
+		}
+		if len(resp.Found) != 1 || resp.Found[0].Entity.Properties["Name"].StringValue != "foo" {
+			t.Errorf("unexpected lookup response: %+v", resp)
+		}
+		if resp.Found[0].Version == 0 {
+			t.Errorf("version was lost")
+		}
+	}
+
+	if calls := srv.Calls("Lookup"); calls != 1 {
+		t.Errorf("Lookup reached Datastore %d times", calls)
+	}
+
+	// gRPC clients share the cache filled by REST clients
+	//    └── gRPCのクライアントはRESTのクライアントが満たしたキャッシュを共有する
+	grpcConn, err := srv.Dial(grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	client, err := datastore.NewClient(ctx, restProjectID, option.WithGRPCConn(grpcConn))
+	if err != nil {
+		t.Fatalf("failed to initialize datastore client: %+v", err)
+	}
+
+	var data dstestData
+	if err := client.Get(ctx, datastore.NameKey("test", "foo", nil), &data); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+	if data.Name != "foo" || srv.Calls("Lookup") != 1 {
+		t.Errorf("gRPC client did not use the cache: %+v, %d", data, srv.Calls("Lookup"))
+	}
+
+	// Commit through REST invalidates the cache
+	//    └── RESTでのCommitはキャッシュを削除する
+	_, err = rest.Projects.Commit(restProjectID, &dsapi.CommitRequest{
+		Mode:      "NON_TRANSACTIONAL",
+		Mutations: []*dsapi.Mutation{{Delete: key}},
+	}).Do()
+	if err != nil {
+		t.Fatalf("failed to commit: %+v", err)
+	}
+
+	resp, err := rest.Projects.Lookup(restProjectID, &dsapi.LookupRequest{Keys: []*dsapi.Key{key}}).Do()
+	if err != nil {
+		t.Fatalf("failed to lookup: %+v", err)
+	}
+	if len(resp.Found) != 0 || len(resp.Missing) != 1 {
+		t.Errorf("deleted entity was returned: %+v", resp)
+	}
+
+	// Errors of the REST API are passed through
+	//    └── REST APIのエラーはそのまま渡される
+	_, err = rest.Projects.Commit(restProjectID, &dsapi.CommitRequest{
+		Mode:      "NON_TRANSACTIONAL",
+		Mutations: []*dsapi.Mutation{{Update: entity}},
+	}).Do()
+	if apiErr, ok := err.(*googleapi.Error); !ok || apiErr.Code != http.StatusBadRequest {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}
+
+// recordingTransport - http.RoundTripper that records request bodies and answers an empty lookup.
+//                        └── リクエストのボディを記録し、空のlookupを返すhttp.RoundTripper。
+type recordingTransport struct {
+	bodies []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	t.bodies = append(t.bodies, string(body))
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json; charset=UTF-8"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"missing": [], "unknownField": 1}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestTransport_UnknownFields(t *testing.T) {
+	base := &recordingTransport{}
+	c := fake.NewCache()
+	client := &http.Client{Transport: cache.NewTransport(cache.NewMiddleware(c), base)}
+
+	url := "https://datastore.googleapis.com/v1/projects/" + restProjectID + ":lookup"
+	body := `{"keys": [{"path": [{"kind": "test", "name": "foo"}]}], "futureOption": true}`
+
+	resp, err := client.Post(url, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("failed to post: %+v", err)
+	}
+	resp.Body.Close()
+
+	// The body with a field unknown to the proto is sent as it is, without the cache
+	//    └── protoが知らないフィールドを持つボディは、キャッシュを使わずにそのまま送られる
+	if len(base.bodies) != 1 || base.bodies[0] != body {
+		t.Errorf("body was modified: %q", base.bodies)
+	}
+	if calls := c.Calls(); len(calls) != 0 {
+		t.Errorf("cache was used: %v", calls)
+	}
+
+	// Unknown fields of responses are ignored
+	//    └── 応答の不明なフィールドは無視される
+	body = `{"keys": [{"path": [{"kind": "test", "name": "foo"}]}]}`
+
+	resp, err = client.Post(url, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("failed to post: %+v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(base.bodies) != 2 || len(c.Calls()) == 0 {
+		t.Errorf("known request was not cached: %d, %q, %v", resp.StatusCode, base.bodies, c.Calls())
+	}
+}
@@ -0,0 +1,340 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/keyenc"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+const (
+	// defaultWarmBatchSize - Default of Warmer.BatchSize.
+	//                          └── Warmer.BatchSizeのデフォルト値。
+	defaultWarmBatchSize = 100
+
+	// maxWarmBatchSize - Maximum number of keys in a single Lookup allowed by Datastore.
+	//                      └── Datastoreが1回のLookupで許可しているキーの最大数。
+	maxWarmBatchSize = 1000
+)
+
+// WarmProgress - Progress of warming up the cache.
+//                  └── キャッシュのウォームアップの進捗。
+type WarmProgress struct {
+	// Keys - Number of keys processed so far.
+	//          └── これまでに処理したキーの数。
+	Keys int
+	// Cached - Number of entities written to the cache.
+	//            └── キャッシュに書き込んだエンティティの数。
+	Cached int
+	// Skipped - Number of entities not written because the cache already holds the same or a newer version.
+	//             └── キャッシュが同じか新しいバージョンを保持していたため書き込まなかったエンティティの数。
+	Skipped int
+	// Missing - Number of keys not found in Datastore.
+	//             └── Datastoreに存在しなかったキーの数。
+	Missing int
+	// Rejected - Number of entities not written because of PropertyPolicies or Admission of Middleware.
+	//              └── MiddlewareのPropertyPoliciesやAdmissionにより書き込まなかったエンティティの数。
+	Rejected int
+	// Invalidated - Number of written entities deleted again because they were updated in Datastore meanwhile.
+	//                 └── その間にDatastoreで更新されたため、書き込んだ後に再び削除したエンティティの数。
+	Invalidated int
+}
+
+// Warmer - Preloads entities from Datastore into the cache.
+//            └── Datastoreからキャッシュにエンティティを事前に読み込む。
+// It is used to warm up a cold cache, for example after a deploy or a failover of the cache.
+// Entities are written through PropertyPolicies and Admission of Middleware, as if they were looked up through it.
+//    └── デプロイ後やキャッシュのフェイルオーバー後など、空のキャッシュを温めるために使う。
+//    └── エンティティは、Middlewareを通してLookupしたのと同様に、MiddlewareのPropertyPoliciesとAdmissionを通して書き込む。
+//
+// It is safe to run while entities are committed: written entities are looked up again,
+// and those updated in Datastore meanwhile are deleted from the cache, so each batch is looked up twice.
+//    └── エンティティのCommit中に実行しても安全。書き込んだエンティティを再度Lookupし、
+//    └── その間にDatastoreで更新されたものはキャッシュから削除するため、バッチごとに2回Lookupする。
+//
+// Pass a client whose connection is not hooked by Middleware, otherwise Lookups are cached twice.
+//    └── Middlewareでフックされていない接続のクライアントを渡すこと。そうでない場合は2重にキャッシュされる。
+type Warmer struct {
+	middleware *Middleware
+	client     datastore.DatastoreClient
+
+	// DatabaseID - Database the entities are looked up in. Empty means the default database.
+	//                └── エンティティをLookupするデータベース。空の場合はデフォルトのデータベース。
+	DatabaseID string
+	// BatchSize - Number of keys in a single Lookup.
+	//               └── 1回のLookupに含めるキーの数。
+	BatchSize int
+	// EntitiesPerSecond - Upper limit of keys looked up per second. Zero means unlimited.
+	//                       └── 1秒あたりにLookupするキーの上限。0は無制限。
+	EntitiesPerSecond float64
+	// Progress - Called after each batch. It must not block for long.
+	//              └── バッチごとに呼ばれる。長時間ブロックしてはいけない。
+	Progress func(progress WarmProgress)
+}
+
+// NewWarmer - Initialize Warmer.
+//               └── Warmerを初期化する。
+// m is the Middleware whose cache is warmed up.
+// client can be created from a gRPC connection with datastore.NewDatastoreClient.
+//    └── mはキャッシュを温めるMiddleware。
+//    └── clientはgRPCの接続からdatastore.NewDatastoreClientで作成できる。
+func NewWarmer(m *Middleware, client datastore.DatastoreClient) *Warmer {
+	return &Warmer{
+		middleware: m,
+		client:     client,
+		BatchSize:  defaultWarmBatchSize,
+	}
+}
+
+// WarmKeys - Preload the entities of keys.
+//              └── keysのエンティティを事前に読み込む。
+func (w *Warmer) WarmKeys(ctx context.Context, projectID string, keys []*datastore.Key) (WarmProgress, error) {
+	var progress WarmProgress
+
+	err := w.warm(ctx, projectID, keys, &progress)
+
+	return progress, err
+}
+
+// WarmQuery - Preload the entities matched by query.
+//               └── queryに一致するエンティティを事前に読み込む。
+// query is run as a keys-only query, and its results are paged through with cursors.
+//    └── queryはキーのみのクエリとして実行され、カーソルで結果を辿る。
+func (w *Warmer) WarmQuery(
+	ctx context.Context,
+	projectID string,
+	partitionID *datastore.PartitionId,
+	query *datastore.Query,
+) (WarmProgress, error) {
+	var progress WarmProgress
+
+	query = proto.Clone(query).(*datastore.Query)
+	query.Projection = []*datastore.Projection{
+		{Property: &datastore.PropertyReference{Name: "__key__"}},
+	}
+
+	for {
+		res, err := w.client.RunQuery(ctx, &datastore.RunQueryRequest{
+			ProjectId:   projectID,
+			DatabaseId:  w.DatabaseID,
+			PartitionId: partitionID,
+			QueryType:   &datastore.RunQueryRequest_Query{Query: query},
+		})
+		if err != nil {
+			return progress, xerrors.Errorf("RunQuery failed: %w", err)
+		}
+
+		batch := res.GetBatch()
+		keys := make([]*datastore.Key, 0, len(batch.GetEntityResults()))
+		for _, e := range batch.GetEntityResults() {
+			keys = append(keys, e.GetEntity().GetKey())
+		}
+
+		if err := w.warm(ctx, projectID, keys, &progress); err != nil {
+			return progress, err
+		}
+
+		if batch.GetMoreResults() != datastore.QueryResultBatch_NOT_FINISHED || len(batch.GetEndCursor()) == 0 {
+			return progress, nil
+		}
+		query.StartCursor = batch.GetEndCursor()
+	}
+}
+
+// warm - Preload the entities of keys in batches.
+//          └── keysのエンティティをバッチごとに事前に読み込む。
+func (w *Warmer) warm(ctx context.Context, projectID string, keys []*datastore.Key, progress *WarmProgress) error {
+	batchSize := w.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultWarmBatchSize
+	}
+	if batchSize > maxWarmBatchSize {
+		batchSize = maxWarmBatchSize
+	}
+
+	for len(keys) > 0 {
+		n := batchSize
+		if n > len(keys) {
+			n = len(keys)
+		}
+
+		started := time.Now()
+
+		deferred, err := w.warmBatch(ctx, projectID, keys[:n], progress)
+		if err != nil {
+			return err
+		}
+		progress.Keys += n - len(deferred)
+
+		if w.Progress != nil {
+			w.Progress(*progress)
+		}
+
+		// deferred keys are retried with the next batch
+		keys = append(deferred, keys[n:]...)
+
+		if err := w.wait(ctx, n, time.Since(started)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// warmBatch - Look up keys and write entities that are newer than the cached ones.
+//               └── keysをLookupし、キャッシュより新しいエンティティを書き込む。
+func (w *Warmer) warmBatch(
+	ctx context.Context,
+	projectID string,
+	keys []*datastore.Key,
+	progress *WarmProgress,
+) (deferred []*datastore.Key, err error) {
+	res, err := w.client.Lookup(ctx, &datastore.LookupRequest{
+		ProjectId:  projectID,
+		DatabaseId: w.DatabaseID,
+		Keys:       keys,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("Lookup failed: %w", err)
+	}
+	progress.Missing += len(res.GetMissing())
+
+	found := res.GetFound()
+	if len(found) == 0 {
+		return res.GetDeferred(), nil
+	}
+
+	// Read the cache right before writing so that newer versions cached meanwhile are not replaced.
+	// A Commit between Lookup and SetMulti is caught by invalidateChanged after writing.
+	//    └── 書き込む直前にキャッシュを読み、その間にキャッシュされた新しいバージョンを置き換えないようにする。
+	//    └── LookupとSetMultiの間のCommitは、書き込んだ後にinvalidateChangedで検出する。
+	foundKeys := make([]*datastore.Key, len(found))
+	for i := range found {
+		setDatabase(w.DatabaseID, found[i].GetEntity().GetKey())
+		foundKeys[i] = found[i].GetEntity().GetKey()
+	}
+
+	cached, err := w.middleware.cache.GetMulti(ctx, projectID, foundKeys)
+	if err != nil {
+		return nil, xerrors.Errorf("GetMulti failed: %w", err)
+	}
+	if len(cached) != len(found) {
+		return nil, xerrors.Errorf("cache should return %d, but returned %d", len(found), len(cached))
+	}
+
+	entities := make([]*datastore.EntityResult, 0, len(found))
+	for i := range found {
+		if cached[i] != nil && cached[i].Version >= found[i].Version {
+			progress.Skipped++
+			continue
+		}
+		entities = append(entities, found[i])
+	}
+
+	n := len(entities)
+	entities = w.middleware.admit(projectID, w.middleware.transformBeforeCache(entities))
+	progress.Rejected += n - len(entities)
+
+	if len(entities) == 0 {
+		return res.GetDeferred(), nil
+	}
+
+	if err := w.middleware.cache.SetMulti(ctx, projectID, entities); err != nil {
+		return nil, xerrors.Errorf("SetMulti failed: %w", err)
+	}
+	progress.Cached += len(entities)
+
+	invalidated, err := invalidateChanged(ctx, w.client, w.middleware.cache, projectID, w.DatabaseID, entities)
+	if err != nil {
+		return nil, err
+	}
+	progress.Invalidated += invalidated
+
+	return res.GetDeferred(), nil
+}
+
+// invalidateChanged - Look up entities written to c again and delete those updated in Datastore meanwhile.
+//                       └── cに書き込んだエンティティを再度Lookupし、その間にDatastoreで更新されたものを削除する。
+// A Commit that is not visible to this Lookup completes after the write, so its own deletion removes the entry.
+// Only with DeleteTimingBeforeCommit an old version can remain, as it can after Lookups through Middleware.
+//    └── このLookupから見えないCommitは書き込みの後に完了するため、そのCommit自身の削除がエントリを取り除く。
+//    └── DeleteTimingBeforeCommitの場合のみ、Middlewareを通したLookupの後と同様に古いバージョンが残り得る。
+func invalidateChanged(
+	ctx context.Context,
+	client datastore.DatastoreClient,
+	c Cache,
+	projectID, databaseID string,
+	written []*datastore.EntityResult,
+) (int, error) {
+	versions := make(map[string]int64, len(written))
+	keys := make([]*datastore.Key, 0, len(written))
+	for _, e := range written {
+		key := e.GetEntity().GetKey()
+		versions[keyenc.Encode(projectID, key)] = e.Version
+		keys = append(keys, key)
+	}
+
+	res, err := client.Lookup(ctx, &datastore.LookupRequest{
+		ProjectId:  projectID,
+		DatabaseId: databaseID,
+		Keys:       keys,
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("Lookup to verify the cache failed: %w", err)
+	}
+
+	// entities that were not found or deferred cannot be verified, so they are deleted as well
+	verified := make(map[string]bool, len(keys))
+	for _, e := range res.GetFound() {
+		key := e.GetEntity().GetKey()
+		setDatabase(databaseID, key)
+
+		encoded := keyenc.Encode(projectID, key)
+		if version, ok := versions[encoded]; ok && version == e.Version {
+			verified[encoded] = true
+		}
+	}
+
+	var changed []*datastore.Key
+	for _, key := range keys {
+		if !verified[keyenc.Encode(projectID, key)] {
+			changed = append(changed, key)
+		}
+	}
+
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	if err := c.DeleteMulti(ctx, projectID, changed); err != nil {
+		return 0, xerrors.Errorf("DeleteMulti failed: %w", err)
+	}
+
+	return len(changed), nil
+}
+
+// wait - Sleep to keep EntitiesPerSecond after looking up n keys in elapsed.
+//          └── elapsedの間にn個のキーをLookupした後、EntitiesPerSecondを守るためにスリープする。
+func (w *Warmer) wait(ctx context.Context, n int, elapsed time.Duration) error {
+	if w.EntitiesPerSecond <= 0 {
+		return nil
+	}
+
+	d := time.Duration(float64(n)/w.EntitiesPerSecond*float64(time.Second)) - elapsed
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+)
+
+type warmerClient struct {
+	datastore.DatastoreClient
+
+	entities   map[string]*datastore.EntityResult
+	lookups    int
+	databaseID string
+
+	// afterLookup - Called after each Lookup, such as to commit an entity concurrently.
+	afterLookup func()
+}
+
+func (c *warmerClient) Lookup(
+	_ context.Context,
+	in *datastore.LookupRequest,
+	_ ...grpc.CallOption,
+) (*datastore.LookupResponse, error) {
+	c.lookups++
+	c.databaseID = in.DatabaseId
+
+	res := new(datastore.LookupResponse)
+	for _, key := range in.Keys {
+		if e, ok := c.entities[KindOf(key)]; ok {
+			res.Found = append(res.Found, e)
+		} else {
+			res.Missing = append(res.Missing, &datastore.EntityResult{Entity: &datastore.Entity{Key: key}})
+		}
+	}
+
+	if c.afterLookup != nil {
+		c.afterLookup()
+	}
+
+	return res, nil
+}
+
+func (c *warmerClient) RunQuery(
+	_ context.Context,
+	in *datastore.RunQueryRequest,
+	_ ...grpc.CallOption,
+) (*datastore.RunQueryResponse, error) {
+	batch := &datastore.QueryResultBatch{
+		EntityResultType: datastore.EntityResult_KEY_ONLY,
+		MoreResults:      datastore.QueryResultBatch_NOT_FINISHED,
+		EndCursor:        []byte("next"),
+	}
+
+	// return one key per page
+	index := 0
+	if string(in.GetQuery().GetStartCursor()) == "next" {
+		index = 1
+		batch.MoreResults = datastore.QueryResultBatch_NO_MORE_RESULTS
+	}
+	batch.EntityResults = []*datastore.EntityResult{
+		{Entity: &datastore.Entity{Key: testKeys2[index]}},
+	}
+
+	return &datastore.RunQueryResponse{Batch: batch}, nil
+}
+
+func TestWarmer_WarmKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	a := &datastore.EntityResult{Entity: &datastore.Entity{Key: testKeys2[0]}, Version: 2}
+	b := &datastore.EntityResult{Entity: &datastore.Entity{Key: testKeys2[1]}, Version: 2}
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{"a": a, "b": b},
+	}
+
+	// a newer version of b was written to the cache meanwhile
+	m.EXPECT().
+		GetMulti(ctx, projectID, []*datastore.Key{testKeys2[0], testKeys2[1]}).
+		Return([]*datastore.EntityResult{nil, {Entity: b.Entity, Version: 3}}, nil)
+	m.EXPECT().
+		SetMulti(ctx, projectID, []*datastore.EntityResult{a}).
+		Return(nil)
+
+	progresses := 0
+
+	w := NewWarmer(NewMiddleware(m), client)
+	w.BatchSize = 2
+	w.Progress = func(progress WarmProgress) {
+		progresses++
+	}
+
+	progress, err := w.WarmKeys(ctx, projectID, testKeys2[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := WarmProgress{Keys: 3, Cached: 1, Skipped: 1, Missing: 1}
+	if progress != expected {
+		t.Errorf("progress differed: %+v (expected: %+v)", progress, expected)
+	}
+
+	// the written entity is looked up again
+	if client.lookups != 3 || progresses != 2 {
+		t.Errorf("keys were not batched: %d lookups, %d progress reports", client.lookups, progresses)
+	}
+}
+
+func TestWarmer_concurrentCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	old := &datastore.EntityResult{Entity: &datastore.Entity{Key: testKeys2[0]}, Version: 1}
+	unchanged := &datastore.EntityResult{Entity: &datastore.Entity{Key: testKeys2[1]}, Version: 1}
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{"a": old, "b": unchanged},
+	}
+
+	// a is committed, and deleted from the cache, between Lookup and SetMulti
+	client.afterLookup = func() {
+		client.entities["a"] = &datastore.EntityResult{Entity: &datastore.Entity{Key: testKeys2[0]}, Version: 2}
+		client.afterLookup = nil
+	}
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, testKeys2[:2]).
+		Return([]*datastore.EntityResult{nil, nil}, nil)
+	m.EXPECT().
+		SetMulti(ctx, projectID, []*datastore.EntityResult{old, unchanged}).
+		Return(nil)
+	m.EXPECT().
+		DeleteMulti(ctx, projectID, []*datastore.Key{testKeys2[0]}).
+		Return(nil)
+
+	progress, err := NewWarmer(NewMiddleware(m), client).WarmKeys(ctx, projectID, testKeys2[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := WarmProgress{Keys: 2, Cached: 2, Invalidated: 1}
+	if progress != expected {
+		t.Errorf("progress differed: %+v (expected: %+v)", progress, expected)
+	}
+}
+
+func TestWarmer_WarmQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	a := &datastore.EntityResult{Entity: &datastore.Entity{Key: testKeys2[0]}, Version: 1}
+	b := &datastore.EntityResult{Entity: &datastore.Entity{Key: testKeys2[1]}, Version: 1}
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{"a": a, "b": b},
+	}
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, gomock.Any()).
+		Return([]*datastore.EntityResult{nil}, nil).
+		Times(2)
+	m.EXPECT().
+		SetMulti(ctx, projectID, []*datastore.EntityResult{a}).
+		Return(nil)
+	m.EXPECT().
+		SetMulti(ctx, projectID, []*datastore.EntityResult{b}).
+		Return(nil)
+
+	query := &datastore.Query{
+		Kind: []*datastore.KindExpression{{Name: "a"}},
+	}
+
+	progress, err := NewWarmer(NewMiddleware(m), client).WarmQuery(ctx, projectID, nil, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Cached != 2 {
+		t.Errorf("cached entities differed: %d (expected: %d)", progress.Cached, 2)
+	}
+
+	if len(query.Projection) != 0 || query.StartCursor != nil {
+		t.Errorf("query passed by the caller was modified: %v", query)
+	}
+}
+
+func TestWarmer_policies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mock.NewMockCache(ctrl)
+
+	ctx := context.Background()
+
+	a := newEntityResult(testKeys2[0], 10)
+	a.Entity.Properties["token"] = &datastore.Value{
+		ValueType: &datastore.Value_StringValue{StringValue: "secret"},
+	}
+	b := newEntityResult(testKeys2[1], 2000)
+	client := &warmerClient{
+		entities: map[string]*datastore.EntityResult{"a": a, "b": b},
+	}
+
+	m.EXPECT().
+		GetMulti(ctx, projectID, gomock.Any()).
+		Return([]*datastore.EntityResult{nil, nil}, nil)
+	m.EXPECT().
+		SetMulti(ctx, projectID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, items []*datastore.EntityResult) error {
+			if len(items) != 1 || !proto.Equal(items[0].Entity.Key, testKeys2[0]) {
+				t.Fatalf("rejected entity was cached: %v", items)
+			}
+			if _, ok := items[0].Entity.Properties["token"]; ok {
+				t.Errorf("excluded property was cached: %v", items[0])
+			}
+			return nil
+		})
+
+	middleware := NewMiddleware(m)
+	middleware.PropertyPolicies = map[string]*PropertyPolicy{"a": {ExcludeProperties: []string{"token"}}}
+	middleware.Admission = NewAdmission()
+	middleware.Admission.MaxSize = 1000
+
+	progress, err := NewWarmer(middleware, client).WarmKeys(ctx, projectID, testKeys2[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := WarmProgress{Keys: 2, Cached: 1, Rejected: 1}
+	if progress != expected {
+		t.Errorf("progress differed: %+v (expected: %+v)", progress, expected)
+	}
+
+	if _, ok := a.Entity.Properties["token"]; !ok {
+		t.Errorf("entity of Datastore was modified: %v", a)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	redigo "github.com/gomodule/redigo/redis"
+	"golang.org/x/xerrors"
+)
+
+// healthTimeout - Timeout of a health check.
+//                   └── ヘルスチェックのタイムアウト。
+const healthTimeout = 3 * time.Second
+
+// admin - HTTP handler of /healthz and /metrics.
+//           └── /healthzと/metricsのHTTPハンドラ。
+type admin struct {
+	counters *cache.Counters
+	health   func(ctx context.Context) error
+}
+
+// handler - Route /healthz and /metrics.
+//             └── /healthzと/metricsを振り分ける。
+func (a *admin) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.serveHealth)
+	mux.HandleFunc("/metrics", a.serveMetrics)
+
+	return mux
+}
+
+// serveHealth - Respond 200 if the cache is reachable, and 503 otherwise.
+//                 └── キャッシュに到達できれば200、そうでなければ503を返す。
+func (a *admin) serveHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	if err := a.health(ctx); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// pingRedis - Health check that pings Redis of pool within the deadline of ctx.
+//               └── ctxの期限内にpoolのRedisにPINGするヘルスチェック。
+// Dialing a new connection does not take ctx, so the check gives up waiting for it when ctx is done.
+//    └── 新しい接続のダイヤルはctxを受け取らないため、ctxが終了した時点で待つのをやめる。
+func pingRedis(pool *redigo.Pool) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		timeout := healthTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			c, err := pool.GetContext(ctx)
+			if err != nil {
+				errs <- xerrors.Errorf("failed to connect to Redis: %w", err)
+				return
+			}
+			defer c.Close()
+
+			if _, err := redigo.DoWithTimeout(c, timeout, "PING"); err != nil {
+				errs <- xerrors.Errorf("failed to ping Redis: %w", err)
+				return
+			}
+			errs <- nil
+		}()
+
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return xerrors.Errorf("failed to ping Redis: %w", ctx.Err())
+		}
+	}
+}
+
+// serveMetrics - Write the counters in the Prometheus text format.
+//                  └── カウンタをPrometheusのテキスト形式で書き出す。
+func (a *admin) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	snapshot := a.counters.Snapshot()
+
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	for _, name := range names {
+		metric := "datastore_cache_" + name + "_total"
+
+		kinds := make([]string, 0, len(snapshot[name]))
+		for kind := range snapshot[name] {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+
+		fmt.Fprintf(w, "# TYPE %s counter\n", metric)
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "%s{kind=\"%s\"} %d\n", metric, escapeLabel(kind), snapshot[name][kind])
+		}
+	}
+}
+
+// escapeLabel - Escape a label value of the Prometheus text format.
+//                 └── Prometheusのテキスト形式のラベルの値をエスケープする。
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
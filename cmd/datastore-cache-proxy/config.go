@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"golang.org/x/xerrors"
+)
+
+const (
+	defaultListen      = ":8081"
+	defaultAdminListen = ":8082"
+	defaultEndpoint    = "datastore.googleapis.com:443"
+	defaultRedisAddr   = "127.0.0.1:6379"
+)
+
+// config - Settings of the proxy, loaded from a JSON file.
+//            └── JSONファイルから読み込むプロキシの設定。
+type config struct {
+	// Listen - Address of the gRPC server.
+	//            └── gRPCサーバーのアドレス。
+	Listen string `json:"listen"`
+	// AdminListen - Address of the HTTP server for health and metrics.
+	//                 └── ヘルスチェックとメトリクスのHTTPサーバーのアドレス。
+	AdminListen string `json:"admin_listen"`
+
+	Upstream upstreamConfig `json:"upstream"`
+	Redis    redisConfig    `json:"redis"`
+
+	// DeleteTiming - One of "none", "before_commit", "after_commit" and "before_and_after_commit".
+	//                  └── "none"、"before_commit"、"after_commit"、"before_and_after_commit"のいずれか。
+	DeleteTiming     string                     `json:"delete_timing"`
+	Admission        *admissionConfig           `json:"admission"`
+	ShadowKinds      []string                   `json:"shadow_kinds"`
+	PropertyPolicies map[string]*propertyConfig `json:"property_policies"`
+}
+
+// upstreamConfig - Datastore that requests are forwarded to.
+//                    └── リクエストの転送先のDatastore。
+type upstreamConfig struct {
+	Endpoint string `json:"endpoint"`
+	// Emulator - Connect without TLS and credentials.
+	//              └── TLSと認証情報を使わずに接続する。
+	Emulator        bool   `json:"emulator"`
+	CredentialsFile string `json:"credentials_file"`
+}
+
+// redisConfig - Redis used as the cache. signing_key can be given by $DATASTORE_CACHE_SIGNING_KEY instead.
+//                 └── キャッシュに使うRedis。signing_keyは$DATASTORE_CACHE_SIGNING_KEYでも指定できる。
+type redisConfig struct {
+	Addr          string `json:"addr"`
+	KeyPrefix     string `json:"key_prefix"`
+	SchemaVersion int    `json:"schema_version"`
+	SigningKey    string `json:"signing_key"`
+}
+
+// admissionConfig - Settings of cache.Admission.
+//                     └── cache.Admissionの設定。
+type admissionConfig struct {
+	MaxSize        int            `json:"max_size"`
+	MaxSizeByKind  map[string]int `json:"max_size_by_kind"`
+	MinAccessCount int            `json:"min_access_count"`
+	MaxTrackedKeys int            `json:"max_tracked_keys"`
+}
+
+// propertyConfig - Settings of cache.PropertyPolicy.
+//                    └── cache.PropertyPolicyの設定。
+type propertyConfig struct {
+	ExcludeProperties []string `json:"exclude_properties"`
+}
+
+var deleteTimings = map[string]cache.DeleteTiming{
+	"none":                    cache.DeleteTimingNone,
+	"before_commit":           cache.DeleteTimingBeforeCommit,
+	"after_commit":            cache.DeleteTimingAfterCommit,
+	"before_and_after_commit": cache.DeleteTimingBeforeAndAfterCommit,
+}
+
+// loadConfig - Load the config file at path and fill the defaults.
+//                └── pathの設定ファイルを読み込み、デフォルト値を埋める。
+func loadConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open config: %w", err)
+	}
+	defer f.Close()
+
+	cfg := &config{}
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, xerrors.Errorf("failed to decode config: %w", err)
+	}
+
+	if err := cfg.fill(); err != nil {
+		return nil, xerrors.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// fill - Fill the defaults and validate the settings.
+//          └── デフォルト値を埋め、設定を検証する。
+func (cfg *config) fill() error {
+	if cfg.Listen == "" {
+		cfg.Listen = defaultListen
+	}
+	if cfg.AdminListen == "" {
+		cfg.AdminListen = defaultAdminListen
+	}
+	if cfg.Upstream.Endpoint == "" {
+		if cfg.Upstream.Emulator {
+			return xerrors.New("upstream.endpoint is required for the emulator")
+		}
+		cfg.Upstream.Endpoint = defaultEndpoint
+	}
+	if cfg.Redis.Addr == "" {
+		cfg.Redis.Addr = defaultRedisAddr
+	}
+	if cfg.Redis.SigningKey == "" {
+		cfg.Redis.SigningKey = os.Getenv("DATASTORE_CACHE_SIGNING_KEY")
+	}
+	if cfg.DeleteTiming == "" {
+		cfg.DeleteTiming = "before_and_after_commit"
+	}
+	if _, ok := deleteTimings[cfg.DeleteTiming]; !ok {
+		return xerrors.Errorf("unknown delete_timing: %q", cfg.DeleteTiming)
+	}
+
+	return nil
+}
+
+// newMiddleware - Initialize Middleware with the policies of the config.
+//                   └── 設定のポリシーでMiddlewareを初期化する。
+func (cfg *config) newMiddleware(c cache.Cache, metrics cache.Metrics) *cache.Middleware {
+	m := cache.NewMiddleware(c)
+	m.CacheDeleteTiming = deleteTimings[cfg.DeleteTiming]
+	m.Metrics = metrics
+
+	if a := cfg.Admission; a != nil {
+		m.Admission = cache.NewAdmission()
+		m.Admission.MaxSize = a.MaxSize
+		m.Admission.MinAccessCount = a.MinAccessCount
+		for kind, size := range a.MaxSizeByKind {
+			m.Admission.MaxSizeByKind[kind] = size
+		}
+		if a.MaxTrackedKeys > 0 {
+			m.Admission.MaxTrackedKeys = a.MaxTrackedKeys
+		}
+	}
+
+	if len(cfg.ShadowKinds) > 0 {
+		m.ShadowKinds = map[string]bool{}
+		for _, kind := range cfg.ShadowKinds {
+			m.ShadowKinds[kind] = true
+		}
+	}
+
+	if len(cfg.PropertyPolicies) > 0 {
+		m.PropertyPolicies = map[string]*cache.PropertyPolicy{}
+		for kind, p := range cfg.PropertyPolicies {
+			m.PropertyPolicies[kind] = &cache.PropertyPolicy{ExcludeProperties: p.ExcludeProperties}
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "datastore-cache-proxy-*.json")
+	if err != nil {
+		t.Fatalf("failed to create config: %+v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("failed to write config: %+v", err)
+	}
+
+	return f.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `{
+		"upstream": {"endpoint": "localhost:8000", "emulator": true},
+		"delete_timing": "after_commit",
+		"admission": {"max_size": 1024, "max_size_by_kind": {"Log": 128}},
+		"shadow_kinds": ["User"],
+		"property_policies": {"User": {"exclude_properties": ["password"]}}
+	}`)
+	defer os.Remove(path)
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %+v", err)
+	}
+
+	if cfg.Listen != defaultListen || cfg.AdminListen != defaultAdminListen || cfg.Redis.Addr != defaultRedisAddr {
+		t.Errorf("defaults were not filled: %+v", cfg)
+	}
+
+	m := cfg.newMiddleware(fake.NewCache(), cache.NewCounters())
+
+	if m.CacheDeleteTiming != cache.DeleteTimingAfterCommit {
+		t.Errorf("unexpected delete timing: %v", m.CacheDeleteTiming)
+	}
+	if m.Admission.MaxSize != 1024 || m.Admission.MaxSizeByKind["Log"] != 128 || m.Admission.MaxTrackedKeys == 0 {
+		t.Errorf("unexpected admission: %+v", m.Admission)
+	}
+	if !m.ShadowKinds["User"] {
+		t.Errorf("unexpected shadow kinds: %v", m.ShadowKinds)
+	}
+	if p := m.PropertyPolicies["User"]; p == nil || len(p.ExcludeProperties) != 1 {
+		t.Errorf("unexpected property policies: %v", m.PropertyPolicies)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":         `{"listen": ":8081", "unknown": true}`,
+		"unknown delete timing": `{"delete_timing": "sometimes"}`,
+		"emulator endpoint":     `{"upstream": {"emulator": true}}`,
+		"malformed":             `{`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, content)
+			defer os.Remove(path)
+
+			if _, err := loadConfig(path); err == nil {
+				t.Errorf("invalid config was loaded")
+			}
+		})
+	}
+}
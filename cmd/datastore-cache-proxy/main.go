@@ -0,0 +1,184 @@
+/*
+Command datastore-cache-proxy - Serves google.datastore.v1.Datastore and caches Lookup in Redis.
+...
+google.datastore.v1.Datastoreを提供し、LookupをRedisにキャッシュするプロキシ。
+
+Every RPC is forwarded to Datastore or the emulator, and Lookup and Commit go through cache.Middleware.
+Clients of any language can use it as a sidecar by pointing DATASTORE_EMULATOR_HOST at the proxy.
+Routing headers of the client such as x-goog-request-params are forwarded with the RPC.
+    └── 全てのRPCはDatastoreまたはエミュレータに転送され、LookupとCommitはcache.Middlewareを通る。
+    └── DATASTORE_EMULATOR_HOSTをプロキシに向けることで、どの言語のクライアントもサイドカーとして利用できる。
+    └── x-goog-request-paramsなどのクライアントのルーティングのヘッダはRPCと共に転送される。
+
+Usage:
+
+	datastore-cache-proxy -config config.json
+
+The admin server answers /healthz, which pings Redis, and /metrics in the Prometheus text format.
+Clients that need properties excluded by property_policies list them in the
+x-datastore-cache-required-properties metadata header, separated by commas.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/redis"
+	redigo "github.com/gomodule/redigo/redis"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/option"
+	gtransport "google.golang.org/api/transport/grpc"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// datastoreScope - OAuth scope of Datastore.
+	//                    └── DatastoreのOAuthスコープ。
+	datastoreScope = "https://www.googleapis.com/auth/datastore"
+
+	// redisTimeout - Timeout of connecting to, reading from and writing to Redis.
+	//                  └── Redisへの接続、読み込み、書き込みのタイムアウト。
+	redisTimeout = 5 * time.Second
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "path of the config file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(2)
+	}
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run - Serve the proxy and the admin server until SIGINT or SIGTERM.
+//         └── SIGINTかSIGTERMまでプロキシと管理サーバーを提供する。
+func run(cfg *config) error {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+
+	pool := &redigo.Pool{
+		MaxIdle:     16,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", cfg.Redis.Addr,
+				redigo.DialConnectTimeout(redisTimeout),
+				redigo.DialReadTimeout(redisTimeout),
+				redigo.DialWriteTimeout(redisTimeout),
+			)
+		},
+	}
+	defer pool.Close()
+
+	opts := []redis.Option{
+		redis.WithKeyPrefix(cfg.Redis.KeyPrefix),
+		redis.WithSchemaVersion(cfg.Redis.SchemaVersion),
+	}
+	if cfg.Redis.SigningKey != "" {
+		opts = append(opts, redis.WithSigningKey([]byte(cfg.Redis.SigningKey)))
+	}
+
+	counters := cache.NewCounters()
+	opts = append(opts, redis.WithMetrics(counters))
+
+	middleware := cfg.newMiddleware(redis.NewRedis(pool, opts...), counters)
+	middleware.Logger = logger
+
+	ctx := context.Background()
+
+	conn, err := dialUpstream(ctx, &cfg.Upstream, grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return xerrors.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+	}
+
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(countStats(counters), requireProperties, forwardMetadata))
+	datastore.RegisterDatastoreServer(server, newProxy(conn))
+
+	a := &admin{
+		counters: counters,
+		health:   pingRedis(pool),
+	}
+	adminServer := &http.Server{Addr: cfg.AdminListen, Handler: a.handler()}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	go func() {
+		errs <- adminServer.ListenAndServe()
+	}()
+
+	logger.Printf("serving on %s, admin on %s, forwarding to %s", cfg.Listen, cfg.AdminListen, cfg.Upstream.Endpoint)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		return xerrors.Errorf("server stopped: %w", err)
+	case sig := <-signals:
+		logger.Printf("shutting down on %v", sig)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	server.GracefulStop()
+
+	return adminServer.Shutdown(shutdownCtx)
+}
+
+// dialUpstream - Connect to Datastore, or to the emulator without TLS and credentials.
+//                  └── Datastoreに接続する。エミュレータの場合はTLSと認証情報を使わない。
+func dialUpstream(ctx context.Context, cfg *upstreamConfig, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if cfg.Emulator {
+		opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+		conn, err := grpc.Dial(cfg.Endpoint, opts...)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to dial the emulator: %w", err)
+		}
+		return conn, nil
+	}
+
+	clientOpts := []option.ClientOption{
+		option.WithEndpoint(cfg.Endpoint),
+		option.WithScopes(datastoreScope),
+	}
+	if cfg.CredentialsFile != "" {
+		clientOpts = append(clientOpts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	for _, opt := range opts {
+		clientOpts = append(clientOpts, option.WithGRPCDialOption(opt))
+	}
+
+	conn, err := gtransport.Dial(ctx, clientOpts...)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to dial Datastore: %w", err)
+	}
+
+	return conn, nil
+}
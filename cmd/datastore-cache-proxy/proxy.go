@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// metricServed - Number of keys served from the cache.
+	//                  └── キャッシュから返したキーの数。
+	metricServed = "served"
+	// metricFetched - Number of keys looked up in Datastore.
+	//                   └── Datastoreで検索したキーの数。
+	metricFetched = "fetched"
+	// metricWritten - Number of keys written to the cache.
+	//                   └── キャッシュに書き込んだキーの数。
+	metricWritten = "written"
+	// metricInvalidated - Number of keys deleted from the cache.
+	//                       └── キャッシュから削除したキーの数。
+	metricInvalidated = "invalidated"
+)
+
+// requiredPropertiesHeader - gRPC metadata header listing properties the caller needs, separated by commas.
+//                              └── 呼び出し元が必要とするプロパティをカンマ区切りで列挙するgRPCメタデータのヘッダ。
+// It is the counterpart of cache.WithRequiredProperties for clients that are not written in Go.
+// Lookups that send it never get cached entities whose property_policies exclude one of the properties,
+// and Lookups that do not send it, even empty, never get cached entities of kinds with property_policies.
+//    └── Go以外で書かれたクライアントのための、cache.WithRequiredPropertiesに相当するもの。
+//    └── これを送ったLookupは、property_policiesでいずれかのプロパティを除外しているキャッシュを受け取らず、
+//    └── 空でもこれを送らないLookupは、property_policiesを持つkindのキャッシュを受け取らない。
+const requiredPropertiesHeader = "x-datastore-cache-required-properties"
+
+// forwardedHeaders - Incoming gRPC metadata headers forwarded to the upstream.
+//                      └── 転送先に転送する受信gRPCメタデータのヘッダ。
+// Datastore routes requests to the project and the database by them.
+// Hop-local headers such as cache.CacheControlHeader and requiredPropertiesHeader are consumed by the proxy.
+//    └── Datastoreはこれらでリクエストをプロジェクトとデータベースに振り分ける。
+//    └── cache.CacheControlHeaderやrequiredPropertiesHeaderのようなホップ内のヘッダはプロキシが消費する。
+var forwardedHeaders = []string{
+	"x-goog-request-params",
+	"google-cloud-resource-prefix",
+	"x-goog-api-client",
+}
+
+// proxy - google.datastore.v1.Datastore that forwards every RPC to the upstream.
+//           └── 全てのRPCを転送先に転送するgoogle.datastore.v1.Datastore。
+// Lookup and Commit go through Middleware installed on the connection to the upstream.
+//    └── LookupとCommitは転送先への接続に設定されたMiddlewareを通る。
+type proxy struct {
+	client datastore.DatastoreClient
+}
+
+var _ datastore.DatastoreServer = &proxy{}
+
+// newProxy - Initialize proxy forwarding to conn.
+//              └── connに転送するproxyを初期化する。
+func newProxy(conn *grpc.ClientConn) *proxy {
+	return &proxy{client: datastore.NewDatastoreClient(conn)}
+}
+
+func (p *proxy) Lookup(ctx context.Context, req *datastore.LookupRequest) (*datastore.LookupResponse, error) {
+	return p.client.Lookup(ctx, req)
+}
+
+func (p *proxy) RunQuery(ctx context.Context, req *datastore.RunQueryRequest) (*datastore.RunQueryResponse, error) {
+	return p.client.RunQuery(ctx, req)
+}
+
+func (p *proxy) RunAggregationQuery(
+	ctx context.Context,
+	req *datastore.RunAggregationQueryRequest,
+) (*datastore.RunAggregationQueryResponse, error) {
+	return p.client.RunAggregationQuery(ctx, req)
+}
+
+func (p *proxy) BeginTransaction(
+	ctx context.Context,
+	req *datastore.BeginTransactionRequest,
+) (*datastore.BeginTransactionResponse, error) {
+	return p.client.BeginTransaction(ctx, req)
+}
+
+func (p *proxy) Commit(ctx context.Context, req *datastore.CommitRequest) (*datastore.CommitResponse, error) {
+	return p.client.Commit(ctx, req)
+}
+
+func (p *proxy) Rollback(ctx context.Context, req *datastore.RollbackRequest) (*datastore.RollbackResponse, error) {
+	return p.client.Rollback(ctx, req)
+}
+
+func (p *proxy) AllocateIds(
+	ctx context.Context,
+	req *datastore.AllocateIdsRequest,
+) (*datastore.AllocateIdsResponse, error) {
+	return p.client.AllocateIds(ctx, req)
+}
+
+func (p *proxy) ReserveIds(
+	ctx context.Context,
+	req *datastore.ReserveIdsRequest,
+) (*datastore.ReserveIdsResponse, error) {
+	return p.client.ReserveIds(ctx, req)
+}
+
+// countStats - Server interceptor that adds the keys handled by Middleware to metrics.
+//                └── Middlewareが扱ったキーをmetricsに加算するサーバーインターセプタ。
+func countStats(metrics cache.Metrics) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, stats := cache.WithStats(ctx)
+
+		resp, err := handler(ctx, req)
+
+		for name, keys := range map[string][]*datastore.Key{
+			metricServed:      stats.Served(),
+			metricFetched:     stats.Fetched(),
+			metricWritten:     stats.Written(),
+			metricInvalidated: stats.Invalidated(),
+		} {
+			for _, key := range keys {
+				metrics.Add(name, cache.KindOf(key), 1)
+			}
+		}
+
+		return resp, err
+	}
+}
+
+// requireProperties - Server interceptor that declares the properties in requiredPropertiesHeader as required.
+//                       └── requiredPropertiesHeaderのプロパティを必要なものとして宣言するサーバーインターセプタ。
+func requireProperties(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(requiredPropertiesHeader)) == 0 {
+		return handler(ctx, req)
+	}
+
+	var properties []string
+	for _, value := range md.Get(requiredPropertiesHeader) {
+		for _, property := range strings.Split(value, ",") {
+			if property = strings.TrimSpace(property); property != "" {
+				properties = append(properties, property)
+			}
+		}
+	}
+
+	return handler(cache.WithRequiredProperties(ctx, properties...), req)
+}
+
+// forwardMetadata - Server interceptor that puts forwardedHeaders of the incoming metadata on the outgoing metadata.
+//                     └── 受信メタデータのforwardedHeadersを送信メタデータに載せるサーバーインターセプタ。
+func forwardMetadata(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	incoming, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	md := metadata.MD{}
+	for _, header := range forwardedHeaders {
+		if values := incoming.Get(header); len(values) != 0 {
+			md.Set(header, values...)
+		}
+	}
+
+	return handler(metadata.NewOutgoingContext(ctx, md.Copy()), req)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cds "cloud.google.com/go/datastore"
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/dstest"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	redigo "github.com/gomodule/redigo/redis"
+	"google.golang.org/api/option"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type User struct {
+	Name string
+}
+
+// startProxy - Start the proxy with cfg forwarding to dstest.Server, and return a connection to the proxy.
+//                └── dstest.Serverに転送するプロキシをcfgで起動し、プロキシへの接続を返す。
+func startProxy(
+	t *testing.T,
+	cfg *config,
+	counters *cache.Counters,
+) (upstream *dstest.Server, proxyConn *grpc.ClientConn, stop func()) {
+	t.Helper()
+
+	upstream = dstest.NewServer()
+
+	if err := cfg.fill(); err != nil {
+		t.Fatalf("failed to fill config: %+v", err)
+	}
+	middleware := cfg.newMiddleware(fake.NewCache(), counters)
+
+	conn, err := upstream.Dial(grpc.WithUnaryInterceptor(middleware.UnaryClientInterceptor))
+	if err != nil {
+		t.Fatalf("failed to dial upstream: %+v", err)
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(countStats(counters), requireProperties, forwardMetadata))
+	datastore.RegisterDatastoreServer(server, newProxy(conn))
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	proxyConn, err = grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial proxy: %+v", err)
+	}
+
+	return upstream, proxyConn, func() {
+		server.Stop()
+		upstream.Close()
+	}
+}
+
+// newClient - Initialize a Datastore client of the proxy.
+//               └── プロキシのDatastoreクライアントを初期化する。
+func newClient(t *testing.T, proxyConn *grpc.ClientConn) *cds.Client {
+	t.Helper()
+
+	client, err := cds.NewClient(context.Background(), "project-id", option.WithGRPCConn(proxyConn))
+	if err != nil {
+		t.Fatalf("failed to initialize datastore client: %+v", err)
+	}
+
+	return client
+}
+
+func TestProxy(t *testing.T) {
+	counters := cache.NewCounters()
+	upstream, proxyConn, stop := startProxy(t, &config{}, counters)
+	defer stop()
+
+	client := newClient(t, proxyConn)
+
+	ctx := context.Background()
+
+	key, err := client.Put(ctx, cds.NameKey("User", "foo", nil), &User{Name: "foo"})
+	if err != nil {
+		t.Fatalf("failed to put: %+v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		var user User
+		if err := client.Get(ctx, key, &user); err != nil {
+			t.Fatalf("failed to get: %+v", err)
+		}
+		if user.Name != "foo" {
+			t.Errorf("retrieved entity differed: %+v", user)
+		}
+	}
+
+	if calls := upstream.Calls("Lookup"); calls != 1 {
+		t.Errorf("Lookup reached upstream %d times", calls)
+	}
+
+	// Queries and transactions are forwarded as they are
+	//    └── クエリとトランザクションはそのまま転送される
+	var users []*User
+	if _, err := client.GetAll(ctx, cds.NewQuery("User"), &users); err != nil || len(users) != 1 {
+		t.Errorf("failed to query: %d, %+v", len(users), err)
+	}
+
+	_, err = client.RunInTransaction(ctx, func(tx *cds.Transaction) error {
+		_, err := tx.Put(key, &User{Name: "bar"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %+v", err)
+	}
+
+	var user User
+	if err := client.Get(ctx, key, &user); err != nil {
+		t.Fatalf("failed to get: %+v", err)
+	}
+	if user.Name != "bar" {
+		t.Errorf("cache was not invalidated: %+v", user)
+	}
+
+	expected := map[string]int64{metricServed: 2, metricFetched: 2, metricWritten: 2, metricInvalidated: 4}
+	for name, value := range expected {
+		if actual := counters.Get(name, "User"); actual != value {
+			t.Errorf("%s was %d, expected %d", name, actual, value)
+		}
+	}
+}
+
+func TestProxy_RequiredProperties(t *testing.T) {
+	cfg := &config{
+		PropertyPolicies: map[string]*propertyConfig{"User": {ExcludeProperties: []string{"Token"}}},
+	}
+	upstream, proxyConn, stop := startProxy(t, cfg, cache.NewCounters())
+	defer stop()
+
+	ctx := context.Background()
+
+	key := &datastore.Key{
+		PartitionId: &datastore.PartitionId{ProjectId: "project-id"},
+		Path:        []*datastore.Key_PathElement{{Kind: "User", IdType: &datastore.Key_PathElement_Name{Name: "foo"}}},
+	}
+
+	client := datastore.NewDatastoreClient(proxyConn)
+
+	_, err := client.Commit(ctx, &datastore.CommitRequest{
+		ProjectId: "project-id",
+		Mode:      datastore.CommitRequest_NON_TRANSACTIONAL,
+		Mutations: []*datastore.Mutation{{Operation: &datastore.Mutation_Upsert{Upsert: &datastore.Entity{
+			Key: key,
+			Properties: map[string]*datastore.Value{
+				"Name":  {ValueType: &datastore.Value_StringValue{StringValue: "foo"}},
+				"Token": {ValueType: &datastore.Value_StringValue{StringValue: "secret"}},
+			},
+		}}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %+v", err)
+	}
+
+	lookup := func(ctx context.Context) *datastore.Entity {
+		res, err := client.Lookup(ctx, &datastore.LookupRequest{ProjectId: "project-id", Keys: []*datastore.Key{key}})
+		if err != nil || len(res.Found) != 1 {
+			t.Fatalf("failed to lookup: %v, %+v", res, err)
+		}
+		return res.Found[0].Entity
+	}
+
+	// Clients that do not declare their properties always get complete entities
+	//    └── プロパティを宣言しないクライアントは常に完全なエンティティを受け取る
+	lookup(ctx)
+	if entity := lookup(ctx); upstream.Calls("Lookup") != 2 || entity.Properties["Token"].GetStringValue() != "secret" {
+		t.Fatalf("entity without the excluded property was served from the cache: %v", entity)
+	}
+
+	partial := metadata.AppendToOutgoingContext(ctx, requiredPropertiesHeader, "")
+
+	if entity := lookup(partial); upstream.Calls("Lookup") != 2 || entity.Properties["Token"] != nil {
+		t.Fatalf("entity without the excluded property was not served from the cache: %v", entity)
+	}
+
+	// Clients in any language require the excluded property with the header
+	//    └── どの言語のクライアントもヘッダで除外されたプロパティを要求する
+	required := metadata.AppendToOutgoingContext(ctx, requiredPropertiesHeader, "Name, Token")
+
+	if entity := lookup(required); entity.Properties["Token"].GetStringValue() != "secret" {
+		t.Errorf("excluded property was not returned: %v", entity)
+	}
+	if calls := upstream.Calls("Lookup"); calls != 3 {
+		t.Errorf("Lookup reached upstream %d times", calls)
+	}
+}
+
+func TestProxy_forwardMetadata(t *testing.T) {
+	upstream, proxyConn, stop := startProxy(t, &config{}, cache.NewCounters())
+	defer stop()
+
+	ctx := context.Background()
+
+	// Headers of the Datastore client reach the upstream
+	//    └── Datastoreクライアントのヘッダは転送先に届く
+	var user User
+	if err := newClient(t, proxyConn).Get(ctx, cds.NameKey("User", "foo", nil), &user); err != cds.ErrNoSuchEntity {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	md := upstream.Metadata("Lookup")
+	if values := md.Get("google-cloud-resource-prefix"); len(values) != 1 || values[0] != "projects/project-id" {
+		t.Errorf("resource prefix was not forwarded: %v", values)
+	}
+
+	// Hop-local headers are consumed by the proxy
+	//    └── ホップ内のヘッダはプロキシが消費する
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		"x-goog-request-params", "project_id=project-id",
+		cache.CacheControlHeader, string(cache.CacheControlBypass),
+		requiredPropertiesHeader, "Name",
+	)
+
+	_, err := datastore.NewDatastoreClient(proxyConn).Lookup(ctx, &datastore.LookupRequest{
+		ProjectId: "project-id",
+		Keys: []*datastore.Key{{
+			PartitionId: &datastore.PartitionId{ProjectId: "project-id"},
+			Path:        []*datastore.Key_PathElement{{Kind: "User", IdType: &datastore.Key_PathElement_Name{Name: "foo"}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to lookup: %+v", err)
+	}
+
+	md = upstream.Metadata("Lookup")
+	if values := md.Get("x-goog-request-params"); len(values) != 1 || values[0] != "project_id=project-id" {
+		t.Errorf("request params were not forwarded: %v", values)
+	}
+	for _, header := range []string{cache.CacheControlHeader, requiredPropertiesHeader} {
+		if values := md.Get(header); len(values) != 0 {
+			t.Errorf("%s was forwarded: %v", header, values)
+		}
+	}
+}
+
+func TestPingRedis(t *testing.T) {
+	// Redis that accepts connections but never answers
+	//    └── 接続を受け付けるが応答しないRedis
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	for name, dial := range map[string]func() (redigo.Conn, error){
+		"hung": func() (redigo.Conn, error) { return redigo.Dial("tcp", listener.Addr().String()) },
+		"dial": func() (redigo.Conn, error) {
+			<-block
+			return nil, errors.New("closed")
+		},
+	} {
+		pool := &redigo.Pool{Dial: dial}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		started := time.Now()
+
+		if err := pingRedis(pool)(ctx); err == nil {
+			t.Errorf("%s Redis must be unhealthy", name)
+		}
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Errorf("health check of %s Redis took %v", name, elapsed)
+		}
+
+		cancel()
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	counters := cache.NewCounters()
+	counters.Add(metricServed, "User", 3)
+	counters.Add(metricFetched, `Ki"nd`, 1)
+
+	var healthErr error
+	a := &admin{
+		counters: counters,
+		health:   func(context.Context) error { return healthErr },
+	}
+
+	server := httptest.NewServer(a.handler())
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("failed to get %s: %+v", path, err)
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read %s: %+v", path, err)
+		}
+
+		return resp.StatusCode, string(body)
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("unexpected status of a healthy proxy: %d", code)
+	}
+
+	healthErr = errors.New("connection refused")
+	if code, _ := get("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status of an unhealthy proxy: %d", code)
+	}
+
+	_, body := get("/metrics")
+	for _, line := range []string{
+		`datastore_cache_fetched_total{kind="Ki\"nd"} 1`,
+		`datastore_cache_served_total{kind="User"} 3`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics did not contain %q:\n%s", line, body)
+		}
+	}
+}
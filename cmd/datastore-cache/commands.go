@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/encrypt"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/option"
+	gtransport "google.golang.org/api/transport/grpc"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// getResult - Output of the get command for a key.
+//               └── getコマンドのキーごとの出力。
+type getResult struct {
+	Key     string          `json:"key"`
+	Found   bool            `json:"found"`
+	Version int64           `json:"version,omitempty"`
+	Entity  json.RawMessage `json:"entity,omitempty"`
+}
+
+func runGet(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+	database := flags.String("database", "", "database of the keys (the default database if omitted)")
+	namespace := flags.String("namespace", "", "namespace of the keys")
+	// nolint:errcheck
+	flags.Parse(args)
+
+	keys, err := parseKeys(cfg.projectID, *database, *namespace, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	items, err := cfg.newCache().GetMulti(ctx, cfg.projectID, keys)
+	if err != nil {
+		return xerrors.Errorf("GetMulti failed: %w", err)
+	}
+
+	encoder := json.NewEncoder(cfg.stdout)
+	encoder.SetIndent("", "  ")
+
+	for i := range keys {
+		result := getResult{Key: formatKey(keys[i])}
+
+		if i < len(items) && items[i] != nil {
+			// an encrypted entity would be printed as a single opaque property
+			if _, ok := items[i].GetEntity().GetProperties()[encrypt.PropertyName]; ok && cfg.keyring == nil {
+				return xerrors.Errorf("%s is encrypted: pass -encryption-key-file", result.Key)
+			}
+
+			entity := new(bytes.Buffer)
+			if err := new(jsonpb.Marshaler).Marshal(entity, items[i].Entity); err != nil {
+				return xerrors.Errorf("failed to marshal entity: %w", err)
+			}
+
+			result.Found = true
+			result.Version = items[i].Version
+			result.Entity = entity.Bytes()
+		}
+
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runDel(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("del", flag.ExitOnError)
+	database := flags.String("database", "", "database of the keys (the default database if omitted)")
+	namespace := flags.String("namespace", "", "namespace of the keys")
+	// nolint:errcheck
+	flags.Parse(args)
+
+	keys, err := parseKeys(cfg.projectID, *database, *namespace, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.newCache().DeleteMulti(ctx, cfg.projectID, keys); err != nil {
+		return xerrors.Errorf("DeleteMulti failed: %w", err)
+	}
+
+	fmt.Fprintf(cfg.stdout, "deleted %d keys\n", len(keys))
+
+	return nil
+}
+
+// filterFlags - Flags that build cache.FlushFilter.
+//                 └── cache.FlushFilterを組み立てるフラグ。
+type filterFlags struct {
+	database  *string
+	namespace *string
+	kind      *string
+	ancestor  *string
+}
+
+func newFilterFlags(flags *flag.FlagSet, withAncestor bool) *filterFlags {
+	f := &filterFlags{
+		database:  flags.String("database", "", "database of the entities (the default database if omitted)"),
+		namespace: flags.String("namespace", "", "namespace of the entities (all namespaces if omitted)"),
+		kind:      flags.String("kind", "", "kind of the entities (all kinds if omitted)"),
+	}
+	if withAncestor {
+		f.ancestor = flags.String("ancestor", "", "ancestor of the entities")
+	}
+	return f
+}
+
+func (f *filterFlags) filter(flags *flag.FlagSet, projectID string) (*cache.FlushFilter, error) {
+	filter := &cache.FlushFilter{
+		ProjectID:  projectID,
+		DatabaseID: *f.database,
+		Kind:       *f.kind,
+	}
+
+	// an empty -namespace means the default namespace only when it is given explicitly
+	flags.Visit(func(fl *flag.Flag) {
+		if fl.Name == "namespace" {
+			filter.Namespaces = []string{*f.namespace}
+		}
+	})
+
+	if f.ancestor != nil && *f.ancestor != "" {
+		ancestor, err := parseKey(projectID, *f.database, *f.namespace, *f.ancestor)
+		if err != nil {
+			return nil, err
+		}
+		filter.Ancestor = ancestor
+	}
+
+	return filter, nil
+}
+
+func runFlush(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("flush", flag.ExitOnError)
+	ff := newFilterFlags(flags, true)
+	dryRun := flags.Bool("dry-run", false, "count matching keys without deleting them")
+	// nolint:errcheck
+	flags.Parse(args)
+
+	filter, err := ff.filter(flags, cfg.projectID)
+	if err != nil {
+		return err
+	}
+
+	n, err := cfg.newRedis().Flush(ctx, filter, *dryRun)
+	if err != nil {
+		return xerrors.Errorf("Flush failed after %d keys: %w", n, err)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(cfg.stdout, "%d keys match\n", n)
+	} else {
+		fmt.Fprintf(cfg.stdout, "flushed %d keys\n", n)
+	}
+
+	return nil
+}
+
+func runStats(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	ff := newFilterFlags(flags, false)
+	// nolint:errcheck
+	flags.Parse(args)
+
+	filter, err := ff.filter(flags, cfg.projectID)
+	if err != nil {
+		return err
+	}
+
+	stats, err := cfg.newRedis().Stats(ctx, filter)
+	if err != nil {
+		return xerrors.Errorf("Stats failed: %w", err)
+	}
+
+	kinds := make([]string, 0, len(stats))
+	for kind := range stats {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	w := tabwriter.NewWriter(cfg.stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "KIND\tKEYS\tBYTES\t")
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "%s\t%d\t%d\t\n", kind, stats[kind].Keys, stats[kind].Bytes)
+	}
+
+	return w.Flush()
+}
+
+func runWarm(ctx context.Context, cfg *config, args []string) error {
+	flags := flag.NewFlagSet("warm", flag.ExitOnError)
+	database := flags.String("database", "", "database of the entities (the default database if omitted)")
+	namespace := flags.String("namespace", "", "namespace of the entities")
+	kind := flags.String("kind", "", "warm all entities of the kind instead of the given keys")
+	rate := flags.Float64("rate", 0, "maximum number of entities looked up per second (unlimited if 0)")
+	excluded := excludeFlag{}
+	flags.Var(excluded, "exclude", "property never written to the cache, as KIND.PROPERTY (repeatable)")
+	// nolint:errcheck
+	flags.Parse(args)
+
+	dial := cfg.dial
+	if dial == nil {
+		dial = dialDatastore
+	}
+
+	conn, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	middleware := cache.NewMiddleware(cfg.newCache())
+	middleware.PropertyPolicies = excluded.policies()
+
+	warmer := cache.NewWarmer(middleware, datastore.NewDatastoreClient(conn))
+	warmer.DatabaseID = *database
+	warmer.EntitiesPerSecond = *rate
+	warmer.Progress = func(progress cache.WarmProgress) {
+		fmt.Fprintf(os.Stderr, "keys: %d, cached: %d, skipped: %d, missing: %d, rejected: %d, invalidated: %d\n",
+			progress.Keys, progress.Cached, progress.Skipped, progress.Missing, progress.Rejected, progress.Invalidated)
+	}
+
+	if *kind != "" {
+		_, err = warmer.WarmQuery(ctx, cfg.projectID, &datastore.PartitionId{
+			ProjectId:   cfg.projectID,
+			DatabaseId:  *database,
+			NamespaceId: *namespace,
+		}, &datastore.Query{
+			Kind: []*datastore.KindExpression{{Name: *kind}},
+		})
+		return err
+	}
+
+	keys, err := parseKeys(cfg.projectID, *database, *namespace, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	_, err = warmer.WarmKeys(ctx, cfg.projectID, keys)
+	return err
+}
+
+// excludeFlag - Properties given by -exclude as KIND.PROPERTY, indexed by kind.
+//                 └── -excludeでKIND.PROPERTYとして与えられた、kindで索引したプロパティ。
+type excludeFlag map[string][]string
+
+func (f excludeFlag) String() string {
+	return fmt.Sprint(map[string][]string(f))
+}
+
+func (f excludeFlag) Set(value string) error {
+	i := strings.Index(value, ".")
+	if i <= 0 || i == len(value)-1 {
+		return xerrors.Errorf("invalid property %q: must be KIND.PROPERTY", value)
+	}
+
+	f[value[:i]] = append(f[value[:i]], value[i+1:])
+
+	return nil
+}
+
+// policies - PropertyPolicies that exclude the properties.
+//              └── プロパティを除外するPropertyPolicies。
+func (f excludeFlag) policies() map[string]*cache.PropertyPolicy {
+	if len(f) == 0 {
+		return nil
+	}
+
+	policies := make(map[string]*cache.PropertyPolicy, len(f))
+	for kind, properties := range f {
+		policies[kind] = &cache.PropertyPolicy{ExcludeProperties: properties}
+	}
+
+	return policies
+}
+
+// dialDatastore - Connect to Datastore, or to the emulator if $DATASTORE_EMULATOR_HOST is set.
+//                   └── Datastoreに接続する。$DATASTORE_EMULATOR_HOSTが設定されている場合はエミュレータに接続する。
+func dialDatastore(ctx context.Context) (*grpc.ClientConn, error) {
+	if host := os.Getenv("DATASTORE_EMULATOR_HOST"); host != "" {
+		return grpc.DialContext(ctx, host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	conn, err := gtransport.Dial(ctx,
+		option.WithEndpoint("datastore.googleapis.com:443"),
+		option.WithScopes("https://www.googleapis.com/auth/datastore"),
+	)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to connect to Datastore: %w", err)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/dstest"
+	"github.com/gcp-kit/datastore-cache-go/cache/encrypt"
+	"github.com/gcp-kit/datastore-cache-go/cache/fake"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+	"google.golang.org/grpc"
+)
+
+const projectID = "project-id"
+
+// newTestConfig - Config whose commands use c and write to stdout.
+//                   └── コマンドがcを使い、stdoutに書き込む設定。
+func newTestConfig(c *fake.Cache, stdout *bytes.Buffer) *config {
+	return &config{
+		projectID: projectID,
+		stdout:    stdout,
+		cache:     c,
+	}
+}
+
+func newUser(databaseID string, id int64, version int64) *datastore.EntityResult {
+	return &datastore.EntityResult{
+		Entity: &datastore.Entity{
+			Key: &datastore.Key{
+				PartitionId: &datastore.PartitionId{
+					ProjectId:   projectID,
+					DatabaseId:  databaseID,
+					NamespaceId: "ns",
+				},
+				Path: []*datastore.Key_PathElement{
+					{Kind: "User", IdType: &datastore.Key_PathElement_Id{Id: id}},
+				},
+			},
+			Properties: map[string]*datastore.Value{
+				"Name":  {ValueType: &datastore.Value_StringValue{StringValue: "name"}},
+				"Token": {ValueType: &datastore.Value_StringValue{StringValue: "secret"}},
+			},
+		},
+		Version: version,
+	}
+}
+
+func TestRunGet(t *testing.T) {
+	ctx := context.Background()
+
+	c := fake.NewCache()
+	if err := c.SetMulti(ctx, projectID, []*datastore.EntityResult{newUser("db", 1, 3)}); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(bytes.Buffer)
+	cfg := newTestConfig(c, stdout)
+
+	if err := runGet(ctx, cfg, []string{"-database", "db", "-namespace", "ns", "User:1", "User:2"}); err != nil {
+		t.Fatalf("get failed: %+v", err)
+	}
+
+	decoder := json.NewDecoder(stdout)
+
+	var found, missing getResult
+	if err := decoder.Decode(&found); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&missing); err != nil {
+		t.Fatal(err)
+	}
+
+	if found.Key != "User:1" || !found.Found || found.Version != 3 || !strings.Contains(string(found.Entity), "secret") {
+		t.Errorf("unexpected result of a cached key: %+v", found)
+	}
+	if missing.Key != "User:2" || missing.Found {
+		t.Errorf("unexpected result of a missing key: %+v", missing)
+	}
+
+	// The same key in the default database is not cached
+	//    └── デフォルトのデータベースの同じキーはキャッシュされていない
+	stdout.Reset()
+
+	if err := runGet(ctx, cfg, []string{"-namespace", "ns", "User:1"}); err != nil {
+		t.Fatalf("get failed: %+v", err)
+	}
+
+	var result getResult
+	if err := json.NewDecoder(stdout).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Found {
+		t.Errorf("entity of another database was returned: %+v", result)
+	}
+}
+
+func TestRunGet_encrypted(t *testing.T) {
+	ctx := context.Background()
+
+	keyring, err := encrypt.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 16)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := fake.NewCache()
+	users := []*datastore.EntityResult{newUser("", 1, 3)}
+	if err := encrypt.NewCache(c, keyring).SetMulti(ctx, projectID, users); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(bytes.Buffer)
+	cfg := newTestConfig(c, stdout)
+
+	// the ciphertext is never printed as an entity
+	//    └── 暗号文をエンティティとして表示しない
+	if err := runGet(ctx, cfg, []string{"-namespace", "ns", "User:1"}); err == nil {
+		t.Errorf("encrypted entity must be an error without the keyring: %s", stdout)
+	}
+
+	stdout.Reset()
+	cfg.keyring = keyring
+
+	if err := runGet(ctx, cfg, []string{"-namespace", "ns", "User:1"}); err != nil {
+		t.Fatalf("get failed: %+v", err)
+	}
+
+	var result getResult
+	if err := json.NewDecoder(stdout).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Found || !strings.Contains(string(result.Entity), "secret") {
+		t.Errorf("entity was not decrypted: %+v", result)
+	}
+}
+
+func TestRunDel(t *testing.T) {
+	ctx := context.Background()
+
+	c := fake.NewCache()
+	users := []*datastore.EntityResult{newUser("", 1, 1), newUser("db", 1, 1)}
+	if err := c.SetMulti(ctx, projectID, users); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(bytes.Buffer)
+
+	err := runDel(ctx, newTestConfig(c, stdout), []string{"-database", "db", "-namespace", "ns", "User:1"})
+	if err != nil {
+		t.Fatalf("del failed: %+v", err)
+	}
+
+	if s := stdout.String(); s != "deleted 1 keys\n" {
+		t.Errorf("unexpected output: %q", s)
+	}
+
+	items, err := c.GetMulti(ctx, projectID, []*datastore.Key{users[0].Entity.Key, users[1].Entity.Key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items[0] == nil || items[1] != nil {
+		t.Errorf("only the key in the database must be deleted: %v", items)
+	}
+}
+
+func TestRunWarm(t *testing.T) {
+	ctx := context.Background()
+
+	srv := dstest.NewServer()
+	defer srv.Close()
+
+	conn, err := srv.Dial()
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+	defer conn.Close()
+
+	users := []*datastore.EntityResult{newUser("db", 1, 0), newUser("db", 2, 0)}
+
+	_, err = datastore.NewDatastoreClient(conn).Commit(ctx, &datastore.CommitRequest{
+		ProjectId:  projectID,
+		DatabaseId: "db",
+		Mode:       datastore.CommitRequest_NON_TRANSACTIONAL,
+		Mutations: []*datastore.Mutation{
+			{Operation: &datastore.Mutation_Upsert{Upsert: users[0].Entity}},
+			{Operation: &datastore.Mutation_Upsert{Upsert: users[1].Entity}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %+v", err)
+	}
+
+	for _, args := range [][]string{
+		{"-database", "db", "-namespace", "ns", "-exclude", "User.Token", "User:1", "User:2"},
+		{"-database", "db", "-namespace", "ns", "-exclude", "User.Token", "-kind", "User"},
+	} {
+		c := fake.NewCache()
+
+		cfg := newTestConfig(c, new(bytes.Buffer))
+		cfg.dial = func(context.Context) (*grpc.ClientConn, error) {
+			return srv.Dial()
+		}
+
+		if err := runWarm(ctx, cfg, args); err != nil {
+			t.Fatalf("warm %v failed: %+v", args, err)
+		}
+
+		items, err := c.GetMulti(ctx, projectID, []*datastore.Key{users[0].Entity.Key, users[1].Entity.Key})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, item := range items {
+			if item == nil {
+				t.Errorf("warm %v did not cache %dth entity", args, i)
+				continue
+			}
+			if _, ok := item.Entity.Properties["Token"]; ok {
+				t.Errorf("warm %v cached an excluded property: %v", args, item)
+			}
+			if _, ok := item.Entity.Properties["Name"]; !ok {
+				t.Errorf("warm %v did not cache a property: %v", args, item)
+			}
+		}
+	}
+}
+
+func TestExcludeFlag(t *testing.T) {
+	f := excludeFlag{}
+
+	for _, value := range []string{"User.Token", "User.Password", "Session.ID"} {
+		if err := f.Set(value); err != nil {
+			t.Fatalf("failed to set %q: %+v", value, err)
+		}
+	}
+
+	policies := f.policies()
+	if len(policies) != 2 || len(policies["User"].ExcludeProperties) != 2 ||
+		policies["Session"].ExcludeProperties[0] != "ID" {
+		t.Errorf("unexpected policies: %v", policies)
+	}
+
+	for _, invalid := range []string{"User", "User.", ".Token"} {
+		if err := f.Set(invalid); err == nil {
+			t.Errorf("%q must be invalid", invalid)
+		}
+	}
+
+	if (excludeFlag{}).policies() != nil {
+		t.Errorf("no policies must be made without -exclude")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+// parseKey - Parse a key written as slash-separated path elements such as "Parent:1/Child:name".
+//              └── "Parent:1/Child:name" のようにスラッシュ区切りのパス要素で書かれたキーをパースする。
+func parseKey(projectID, databaseID, namespace, s string) (*datastore.Key, error) {
+	key := &datastore.Key{
+		PartitionId: &datastore.PartitionId{
+			ProjectId:   projectID,
+			DatabaseId:  databaseID,
+			NamespaceId: namespace,
+		},
+	}
+
+	for _, element := range strings.Split(s, "/") {
+		i := strings.Index(element, ":")
+		if i <= 0 || i == len(element)-1 {
+			return nil, xerrors.Errorf("invalid path element %q: must be KIND:ID", element)
+		}
+
+		kind, id := element[:i], element[i+1:]
+
+		pathElement := &datastore.Key_PathElement{Kind: kind}
+		if v, ok := parseInt(id); ok {
+			pathElement.IdType = &datastore.Key_PathElement_Id{Id: v}
+		} else {
+			pathElement.IdType = &datastore.Key_PathElement_Name{Name: id}
+		}
+
+		key.Path = append(key.Path, pathElement)
+	}
+
+	return key, nil
+}
+
+// parseKeys - Parse keys given as arguments.
+//               └── 引数で与えられたキーをパースする。
+func parseKeys(projectID, databaseID, namespace string, args []string) ([]*datastore.Key, error) {
+	keys := make([]*datastore.Key, 0, len(args))
+
+	for _, arg := range args {
+		key, err := parseKey(projectID, databaseID, namespace, arg)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// formatKey - Format key in the syntax accepted by parseKey.
+//               └── parseKeyが受け付ける形式でkeyを整形する。
+func formatKey(key *datastore.Key) string {
+	elements := make([]string, 0, len(key.GetPath()))
+
+	for _, p := range key.GetPath() {
+		switch id := p.GetIdType().(type) {
+		case *datastore.Key_PathElement_Id:
+			elements = append(elements, p.Kind+":"+formatInt(id.Id))
+		case *datastore.Key_PathElement_Name:
+			elements = append(elements, p.Kind+":"+id.Name)
+		default:
+			elements = append(elements, p.Kind+":?")
+		}
+	}
+
+	return strings.Join(elements, "/")
+}
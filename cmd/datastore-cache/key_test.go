@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/datastore/v1"
+)
+
+func TestParseKey(t *testing.T) {
+	key, err := parseKey("project", "", "ns", "Parent:1/Child:name")
+	if err != nil {
+		t.Fatalf("failed to parse key: %+v", err)
+	}
+
+	if key.PartitionId.ProjectId != "project" || key.PartitionId.NamespaceId != "ns" {
+		t.Errorf("partition differed: %v", key.PartitionId)
+	}
+
+	if id := key.Path[0].GetIdType().(*datastore.Key_PathElement_Id); key.Path[0].Kind != "Parent" || id.Id != 1 {
+		t.Errorf("first path element differed: %v", key.Path[0])
+	}
+
+	name := key.Path[1].GetIdType().(*datastore.Key_PathElement_Name)
+	if key.Path[1].Kind != "Child" || name.Name != "name" {
+		t.Errorf("second path element differed: %v", key.Path[1])
+	}
+
+	if s := formatKey(key); s != "Parent:1/Child:name" {
+		t.Errorf("formatted key differed: %s", s)
+	}
+
+	for _, invalid := range []string{"Kind", "Kind:", ":1", "Parent:1/"} {
+		if _, err := parseKey("project", "", "", invalid); err == nil {
+			t.Errorf("%q must be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Command datastore-cache - Inspects and manages the cache of Datastore entities in Redis.
+...
+RedisにあるDatastoreのエンティティのキャッシュを確認・管理するコマンド。
+
+Usage:
+
+	datastore-cache [global flags] <command> [flags] [args]
+
+Commands:
+
+	get    Print cached entities as JSON
+	del    Delete cached entities
+	flush  Delete cached entities by namespace, kind or ancestor
+	stats  Print the number of keys and memory usage per kind
+	warm   Preload entities from Datastore
+
+Keys are written as slash-separated path elements, such as "Parent:1/Child:name".
+An ID that is an integer is a numeric ID, and anything else is a name.
+Entities in a database other than the default one are selected with -database.
+warm caches entities without the properties given by -exclude, which should match PropertyPolicies of the services.
+
+The signing key is read from the file given by -signing-key-file or from $DATASTORE_CACHE_SIGNING_KEY,
+and never from a flag value. get, del and warm read and write entities of an encrypted cache
+with the keyring given by -encryption-key-file.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gcp-kit/datastore-cache-go/cache"
+	"github.com/gcp-kit/datastore-cache-go/cache/encrypt"
+	"github.com/gcp-kit/datastore-cache-go/cache/redis"
+	redigo "github.com/gomodule/redigo/redis"
+	"google.golang.org/grpc"
+)
+
+// config - Global flags shared by all commands.
+//            └── 全てのコマンドで共通のフラグ。
+type config struct {
+	redisAddr     string
+	keyPrefix     string
+	schemaVersion int
+	signingKey    []byte
+	keyring       *encrypt.Keyring
+	projectID     string
+
+	// stdout - Where the results of commands are written.
+	//            └── コマンドの結果の書き込み先。
+	stdout io.Writer
+	// cache - Cache used by get, del and warm instead of Redis, for tests.
+	//           └── テストのために、get、del、warmでRedisの代わりに使うキャッシュ。
+	cache cache.Cache
+	// dial - Connect to Datastore. dialDatastore is used if nil.
+	//          └── Datastoreに接続する。nilの場合はdialDatastoreを使う。
+	dial func(ctx context.Context) (*grpc.ClientConn, error)
+}
+
+// command - Subcommand of datastore-cache.
+//             └── datastore-cacheのサブコマンド。
+type command struct {
+	usage string
+	run   func(ctx context.Context, cfg *config, args []string) error
+}
+
+var commands = map[string]*command{
+	"get": {
+		usage: "get [-database DB] [-namespace NS] KEY...",
+		run:   runGet,
+	},
+	"del": {
+		usage: "del [-database DB] [-namespace NS] KEY...",
+		run:   runDel,
+	},
+	"flush": {
+		usage: "flush [-database DB] [-namespace NS] [-kind KIND] [-ancestor KEY] [-dry-run]",
+		run:   runFlush,
+	},
+	"stats": {
+		usage: "stats [-database DB] [-namespace NS] [-kind KIND]",
+		run:   runStats,
+	},
+	"warm": {
+		usage: "warm [-database DB] [-namespace NS] [-kind KIND] [-rate N] [-exclude KIND.PROPERTY]... [KEY...]",
+		run:   runWarm,
+	},
+}
+
+func main() {
+	cfg := &config{stdout: os.Stdout}
+
+	var signingKeyFile, encryptionKeyFile string
+
+	flags := flag.NewFlagSet("datastore-cache", flag.ExitOnError)
+	flags.StringVar(&cfg.redisAddr, "redis-addr", envOr("REDIS_ADDR", "127.0.0.1:6379"), "address of Redis")
+	flags.StringVar(&cfg.keyPrefix, "key-prefix", "", "key prefix passed to redis.WithKeyPrefix")
+	flags.IntVar(&cfg.schemaVersion, "schema-version", 0, "schema version passed to redis.WithSchemaVersion")
+	flags.StringVar(&signingKeyFile, "signing-key-file", "",
+		"file holding the key passed to redis.WithSigningKey ($"+signingKeyEnv+" if omitted)")
+	flags.StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		`JSON file of the keyring of encrypt.Cache: {"primary": ID, "keys": {ID: base64}}`)
+	flags.StringVar(&cfg.projectID, "project", os.Getenv("DATASTORE_PROJECT_ID"), "project ID of Datastore")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: datastore-cache [global flags] <command> [flags] [args]\n\nCommands:\n")
+		for _, name := range []string{"get", "del", "flush", "stats", "warm"} {
+			fmt.Fprintf(flags.Output(), "  %s\n", commands[name].usage)
+		}
+		fmt.Fprintf(flags.Output(), "\nGlobal flags:\n")
+		flags.PrintDefaults()
+	}
+
+	// nolint:errcheck
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if cfg.projectID == "" {
+		fmt.Fprintln(os.Stderr, "-project or $DATASTORE_PROJECT_ID is required")
+		os.Exit(2)
+	}
+
+	var err error
+	if cfg.signingKey, err = loadSigningKey(signingKeyFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(2)
+	}
+	if cfg.keyring, err = loadKeyring(encryptionKeyFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(2)
+	}
+
+	if err := cmd.run(context.Background(), cfg, flags.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %+v\n", flags.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+// newCache - Initialize the cache of entities, which is Redis unless it is replaced for tests.
+//              └── エンティティのキャッシュを初期化する。テストで置き換えない限りRedisになる。
+// It is wrapped in encrypt.Cache when a keyring is given.
+//    └── キーリングが指定された場合はencrypt.Cacheでラップする。
+func (cfg *config) newCache() cache.Cache {
+	c := cfg.cache
+	if c == nil {
+		c = cfg.newRedis()
+	}
+
+	if cfg.keyring != nil {
+		c = encrypt.NewCache(c, cfg.keyring)
+	}
+
+	return c
+}
+
+// newRedis - Initialize the Redis cache from the global flags.
+//              └── グローバルフラグからRedisのキャッシュを初期化する。
+func (cfg *config) newRedis() *redis.Redis {
+	pool := &redigo.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial:        func() (redigo.Conn, error) { return redigo.Dial("tcp", cfg.redisAddr) },
+	}
+
+	opts := []redis.Option{
+		redis.WithKeyPrefix(cfg.keyPrefix),
+		redis.WithSchemaVersion(cfg.schemaVersion),
+	}
+	if cfg.signingKey != nil {
+		opts = append(opts, redis.WithSigningKey(cfg.signingKey))
+	}
+
+	return redis.NewRedis(pool, opts...)
+}
+
+func envOr(key, defaultValue string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+func parseInt(s string) (int64, bool) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	return v, err == nil
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/gcp-kit/datastore-cache-go/cache/encrypt"
+	"golang.org/x/xerrors"
+)
+
+// signingKeyEnv - Environment variable holding the signing key when -signing-key-file is not given.
+//                   └── -signing-key-fileが指定されない場合に署名鍵を保持する環境変数。
+const signingKeyEnv = "DATASTORE_CACHE_SIGNING_KEY"
+
+// keyringFile - Content of the file given by -encryption-key-file.
+//                 └── -encryption-key-fileで指定するファイルの内容。
+//
+//	{"primary": "k2", "keys": {"k1": "<base64>", "k2": "<base64>"}}
+type keyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// loadSigningKey - Read the signing key from path, or from $DATASTORE_CACHE_SIGNING_KEY if path is empty.
+//                    └── pathから署名鍵を読む。pathが空の場合は$DATASTORE_CACHE_SIGNING_KEYから読む。
+// Secrets are never taken as flag values, which would be visible in ps and the shell history.
+// A trailing newline of the file is ignored.
+//    └── psやシェルの履歴から見えるため、秘密はフラグの値として受け取らない。ファイル末尾の改行は無視する。
+func loadSigningKey(path string) ([]byte, error) {
+	if path == "" {
+		if key := os.Getenv(signingKeyEnv); key != "" {
+			return []byte(key), nil
+		}
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read signing key: %w", err)
+	}
+
+	b = bytes.TrimRight(b, "\r\n")
+	if len(b) == 0 {
+		return nil, xerrors.Errorf("signing key file %s is empty", path)
+	}
+
+	return b, nil
+}
+
+// loadKeyring - Read the keyring of the encrypted cache from path. nil is returned if path is empty.
+//                 └── pathから暗号化したキャッシュのキーリングを読む。pathが空の場合はnilを返す。
+func loadKeyring(path string) (*encrypt.Keyring, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read keyring: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, xerrors.Errorf("failed to parse keyring %s: %w", path, err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, xerrors.Errorf("key %q is not base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	return encrypt.NewKeyring(file.Primary, keys)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	t.Setenv(signingKeyEnv, "from-env")
+
+	key, err := loadSigningKey(writeFile(t, "signing-key", "from-file\n"))
+	if err != nil || string(key) != "from-file" {
+		t.Errorf("unexpected key from the file: %q, %+v", key, err)
+	}
+
+	key, err = loadSigningKey("")
+	if err != nil || string(key) != "from-env" {
+		t.Errorf("unexpected key from the environment: %q, %+v", key, err)
+	}
+
+	if _, err := loadSigningKey(writeFile(t, "empty", "\n")); err == nil {
+		t.Errorf("empty signing key file must be an error")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	keyring, err := loadKeyring(writeFile(t, "keyring.json",
+		`{"primary": "k2", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ==", "k2": "AgICAgICAgICAgICAgICAg=="}}`))
+	if err != nil || keyring == nil {
+		t.Fatalf("failed to load keyring: %+v", err)
+	}
+
+	sealed, err := keyring.Seal([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := keyring.Open(sealed, nil); err != nil || string(opened) != "plaintext" {
+		t.Errorf("keyring did not round trip: %q, %+v", opened, err)
+	}
+
+	for _, invalid := range []string{
+		`{"primary": "k3", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ=="}}`,
+		`{"primary": "k1", "keys": {"k1": "not base64"}}`,
+		`not json`,
+	} {
+		if _, err := loadKeyring(writeFile(t, "keyring.json", invalid)); err == nil {
+			t.Errorf("%s must be an error", invalid)
+		}
+	}
+
+	if keyring, err := loadKeyring(""); keyring != nil || err != nil {
+		t.Errorf("keyring must be nil without a file: %v, %+v", keyring, err)
+	}
+}